@@ -0,0 +1,234 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+)
+
+// Anomaly kinds reported by Summarize.
+const (
+	// Burst is reported if a time bucket contains considerably more accesses than the other buckets on average.
+	Burst = "burst"
+	// NewTool is reported if a tool accessed data which is not listed in Config.KnownTools.
+	NewTool = "newTool"
+)
+
+// Config configures the aggregation and the anomaly detection of Summarize.
+type Config struct {
+	// BucketSize is the size of a time bucket in the unit of AccessLog.Timestamp. Defaults to 3600.
+	BucketSize int
+	// BurstFactor is the factor a bucket needs to exceed the average of all other buckets by to be reported as Burst.
+	// Defaults to 3.
+	BurstFactor float64
+	// BurstMinimum is the minimum number of accesses within a bucket to be reported as Burst. Defaults to 5.
+	BurstMinimum int
+	// MaxBuckets limits the number of buckets between the first and the last log which are used to compute the
+	// average of a Burst, such that single logs with outlying timestamps do not turn every bucket into a Burst.
+	// Defaults to 8760, i.e. a year of the default BucketSize.
+	MaxBuckets int
+	// KnownTools lists the tools which are expected to access data, e.g. the tools of a previous Summary.
+	// If it is nil, no NewTool anomalies are reported.
+	KnownTools []string
+}
+
+func (config Config) withDefaults() Config {
+	if config.BucketSize <= 0 {
+		config.BucketSize = 3600
+	}
+	if config.BurstFactor <= 0 {
+		config.BurstFactor = 3
+	}
+	if config.BurstMinimum <= 0 {
+		config.BurstMinimum = 5
+	}
+	if config.MaxBuckets <= 0 {
+		config.MaxBuckets = 8760
+	}
+	return config
+}
+
+// TimeBucket counts the accesses with Start <= Timestamp < Start + BucketSize. Summaries only contain buckets with
+// at least one access.
+type TimeBucket struct {
+	Start int `json:"start"`
+	Count int `json:"count"`
+}
+
+// Anomaly describes an unusual access pattern.
+type Anomaly struct {
+	Kind        string `json:"kind"`
+	Bucket      int    `json:"bucket"`
+	Tool        string `json:"tool,omitempty"`
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+}
+
+// Summary aggregates a set of logs of an owner.
+type Summary struct {
+	Total        int            `json:"total"`
+	ByMonitor    map[string]int `json:"byMonitor"`
+	ByTool       map[string]int `json:"byTool"`
+	ByAccessKind map[string]int `json:"byAccessKind"`
+	ByDataType   map[string]int `json:"byDataType"`
+	ByTime       []TimeBucket   `json:"byTime"`
+	Anomalies    []Anomaly      `json:"anomalies"`
+}
+
+// Summarize aggregates the given logs by monitor, tool, access kind, data type and time bucket and detects anomalies.
+// *NOTE*: The logs are expected to be verified, e.g. by decrypting them or by reading them from a logstore.LogStore.
+func Summarize(accessLogs []logs.AccessLog, config Config) Summary {
+	config = config.withDefaults()
+	summary := Summary{
+		Total:        len(accessLogs),
+		ByMonitor:    map[string]int{},
+		ByTool:       map[string]int{},
+		ByAccessKind: map[string]int{},
+		ByDataType:   map[string]int{},
+		ByTime:       []TimeBucket{},
+		Anomalies:    []Anomaly{},
+	}
+
+	// Process logs in chronological order, such that first occurrences are detected correctly
+	sorted := append([]logs.AccessLog{}, accessLogs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	buckets := map[int]int{}
+	for _, log := range sorted {
+		bucket := bucketStart(log.Timestamp, config.BucketSize)
+		buckets[bucket]++
+		summary.ByMonitor[log.Monitor]++
+		summary.ByAccessKind[log.AccessKind]++
+		for _, dataType := range log.DataType {
+			summary.ByDataType[dataType]++
+		}
+
+		if _, seen := summary.ByTool[log.Tool]; !seen && config.KnownTools != nil && !slices.Contains(config.KnownTools, log.Tool) {
+			summary.Anomalies = append(summary.Anomalies, Anomaly{
+				Kind:        NewTool,
+				Bucket:      bucket,
+				Tool:        log.Tool,
+				Count:       1,
+				Description: fmt.Sprintf("Tool %s accessed data for the first time", log.Tool),
+			})
+		}
+		summary.ByTool[log.Tool]++
+	}
+
+	if len(sorted) == 0 {
+		return summary
+	}
+
+	for start, count := range buckets {
+		summary.ByTime = append(summary.ByTime, TimeBucket{Start: start, Count: count})
+	}
+	sort.Slice(summary.ByTime, func(i, j int) bool { return summary.ByTime[i].Start < summary.ByTime[j].Start })
+
+	// Compare each bucket with the average of all other buckets within the time range, including empty buckets
+	span := spanBuckets(summary.ByTime[0].Start, summary.ByTime[len(summary.ByTime)-1].Start, config.BucketSize)
+	if span > config.MaxBuckets {
+		span = config.MaxBuckets
+	}
+	if span < len(summary.ByTime) {
+		span = len(summary.ByTime)
+	}
+	for _, bucket := range summary.ByTime {
+		if span == 1 {
+			continue
+		}
+		average := float64(len(sorted)-bucket.Count) / float64(span-1)
+		if bucket.Count >= config.BurstMinimum && float64(bucket.Count) > config.BurstFactor*average {
+			summary.Anomalies = append(summary.Anomalies, Anomaly{
+				Kind:        Burst,
+				Bucket:      bucket.Start,
+				Count:       bucket.Count,
+				Description: fmt.Sprintf("%d accesses compared to %.1f on average", bucket.Count, average),
+			})
+		}
+	}
+	sort.SliceStable(summary.Anomalies, func(i, j int) bool { return summary.Anomalies[i].Bucket < summary.Anomalies[j].Bucket })
+	return summary
+}
+
+// Tools returns all tools contained in the summary. It can be used as Config.KnownTools of a later Summary.
+func (summary Summary) Tools() []string {
+	return sortedKeys(summary.ByTool)
+}
+
+// WriteJSON writes the json-encoded summary to w.
+func (summary Summary) WriteJSON(w io.Writer) error {
+	err := json.NewEncoder(w).Encode(summary)
+	if err != nil {
+		return ItCryptoError{Des: "Could not serialize summary", Err: err}
+	}
+	return nil
+}
+
+// WriteCSV writes the aggregated counts of the summary to w. Each row consists of the dimension, the value and
+// the count, e.g. "tool,Crm,3". Time buckets use the dimension "time" and their start as value.
+func (summary Summary) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{{"dimension", "value", "count"}, {"total", "", strconv.Itoa(summary.Total)}}
+	dimensions := []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"monitor", summary.ByMonitor},
+		{"tool", summary.ByTool},
+		{"accessKind", summary.ByAccessKind},
+		{"dataType", summary.ByDataType},
+	}
+	for _, dimension := range dimensions {
+		for _, key := range sortedKeys(dimension.counts) {
+			rows = append(rows, []string{dimension.name, key, strconv.Itoa(dimension.counts[key])})
+		}
+	}
+	for _, bucket := range summary.ByTime {
+		rows = append(rows, []string{"time", strconv.Itoa(bucket.Start), strconv.Itoa(bucket.Count)})
+	}
+
+	err := writer.WriteAll(rows)
+	if err != nil {
+		return ItCryptoError{Des: "Could not write csv", Err: err}
+	}
+	return nil
+}
+
+// bucketStart returns the start of the bucket containing the timestamp. Negative timestamps are rounded down unless
+// the start of their bucket can not be represented.
+func bucketStart(timestamp int, size int) int {
+	start := timestamp - timestamp%size
+	if timestamp < 0 && timestamp%size != 0 && start >= math.MinInt+size {
+		start -= size
+	}
+	return start
+}
+
+// spanBuckets returns the number of buckets from the bucket starting at first to the bucket starting at last.
+// The result is capped at math.MaxInt.
+func spanBuckets(first int, last int, size int) int {
+	// The difference of the starts may exceed math.MaxInt, but always fits into an uint64
+	buckets := (uint64(last)-uint64(first))/uint64(size) + 1
+	if buckets == 0 || buckets > math.MaxInt {
+		return math.MaxInt
+	}
+	return int(buckets)
+}
+
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,151 @@
+// Command migrate re-encrypts an archive of tokens to new keys of their receiver, e.g. after a key rotation.
+// The archive is a newline-delimited JSON file whose objects contain a "token" field, e.g. the file of a
+// logstore.FileBackend. Each token is decrypted with the old keys, verified with the certificates of the directory
+// and encrypted for the new encryption certificate. A report of all successes and failures is written as JSON.
+// The migrated archive only replaces -out if the migration completed, so -in and -out can be the same file.
+//
+//	go run ./cmd/migrate -id owner -encryption-certificate old.pem -verification-certificate sign.pem \
+//		-decryption-key old.key -signing-key sign.key -new-encryption-certificate new.pem \
+//		-directory https://directory.example.com -ca ca.pem -in archive.ndjson -out migrated.ndjson
+//
+// The command exits with status 2 if some tokens could not be migrated.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/haggj/go-it-crypto/directory"
+	"github.com/haggj/go-it-crypto/migration"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+type config struct {
+	id                       string
+	encryptionCertificate    string
+	verificationCertificate  string
+	decryptionKey            string
+	signingKey               string
+	newEncryptionCertificate string
+	directory                string
+	trustedCertificate       string
+	in                       string
+	out                      string
+	report                   string
+}
+
+func main() {
+	var c config
+	flag.StringVar(&c.id, "id", "", "id of the user the tokens are encrypted for")
+	flag.StringVar(&c.encryptionCertificate, "encryption-certificate", "", "path of the old encryption certificate")
+	flag.StringVar(&c.verificationCertificate, "verification-certificate", "", "path of the verification certificate")
+	flag.StringVar(&c.decryptionKey, "decryption-key", "", "path of the old decryption key")
+	flag.StringVar(&c.signingKey, "signing-key", "", "path of the signing key")
+	flag.StringVar(&c.newEncryptionCertificate, "new-encryption-certificate", "", "path of the new encryption certificate")
+	flag.StringVar(&c.directory, "directory", "", "URL of the key directory which resolves the signers of the tokens")
+	flag.StringVar(&c.trustedCertificate, "ca", "", "path of the trusted CA certificate")
+	flag.StringVar(&c.in, "in", "", "path of the archive to migrate")
+	flag.StringVar(&c.out, "out", "", "path of the migrated archive")
+	flag.StringVar(&c.report, "report", "", "path of the migration report (default: stdout)")
+	flag.Parse()
+
+	report, err := run(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if report.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d tokens could not be migrated\n", report.Failed, report.Failed+report.Migrated)
+		os.Exit(2)
+	}
+}
+
+func run(c config) (migration.Report, error) {
+	for _, value := range []string{c.id, c.encryptionCertificate, c.verificationCertificate, c.decryptionKey, c.signingKey,
+		c.newEncryptionCertificate, c.directory, c.trustedCertificate, c.in, c.out} {
+		if value == "" {
+			return migration.Report{}, fmt.Errorf("missing arguments, see -help")
+		}
+	}
+
+	files, err := readFiles(c.encryptionCertificate, c.verificationCertificate, c.decryptionKey, c.signingKey, c.newEncryptionCertificate, c.trustedCertificate)
+	if err != nil {
+		return migration.Report{}, err
+	}
+	receiver, err := user.ImportAuthenticatedUser(c.id, files[0], files[1], files[2], files[3])
+	if err != nil {
+		return migration.Report{}, err
+	}
+	newKeys, err := user.ImportRemoteUser(c.id, files[4], files[1], false, files[5])
+	if err != nil {
+		return migration.Report{}, err
+	}
+	migrator := migration.Migrator{
+		Receiver:  receiver,
+		NewKeys:   newKeys,
+		FetchUser: directory.Client{BaseURL: c.directory, TrustedCertificate: files[5]}.FetchUser(),
+	}
+
+	report, err := migrateFile(migrator, c.in, c.out)
+	if err != nil {
+		return report, err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return report, err
+	}
+	data = append(data, '\n')
+	if c.report == "" {
+		_, err = os.Stdout.Write(data)
+		return report, err
+	}
+	return report, os.WriteFile(c.report, data, 0600)
+}
+
+// migrateFile migrates the archive at the path in and writes it to the path out. The migrated archive is written to a
+// temporary file next to out, which replaces out only if the migration completed. Thus, in and out can be the same
+// file and an aborted migration never leaves a truncated archive.
+func migrateFile(migrator migration.Migrator, in string, out string) (migration.Report, error) {
+	input, err := os.Open(in)
+	if err != nil {
+		return migration.Report{}, err
+	}
+	defer input.Close()
+	output, err := os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*")
+	if err != nil {
+		return migration.Report{}, err
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	report, err := migrator.MigrateNDJSON(input, output)
+	if err != nil {
+		return report, err
+	}
+	err = output.Sync()
+	if err != nil {
+		return report, err
+	}
+	err = output.Close()
+	if err != nil {
+		return report, err
+	}
+	return report, os.Rename(output.Name(), out)
+}
+
+// readFiles reads the given PEM files.
+func readFiles(paths ...string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, string(data))
+	}
+	return files, nil
+}
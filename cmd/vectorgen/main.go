@@ -0,0 +1,48 @@
+// Command vectorgen generates the conformance test vectors of this implementation.
+// It replaces the vectors of the go-it-crypto keyset in the corpus and keeps the vectors of other implementations.
+//
+//	go run ./cmd/vectorgen -corpus vectors/v1.json
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/haggj/go-it-crypto/vectors"
+)
+
+func main() {
+	path := flag.String("corpus", "vectors/v1.json", "path of the corpus to update")
+	flag.Parse()
+
+	err := run(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(path string) error {
+	corpus, err := vectors.Load(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		corpus = vectors.Corpus{Version: vectors.Version}
+	} else if err != nil {
+		return err
+	}
+
+	keyset, generated, err := vectors.Generate()
+	if err != nil {
+		return err
+	}
+	corpus = corpus.Merge(keyset, generated)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return corpus.Write(file)
+}
@@ -0,0 +1,113 @@
+package directory
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// Client resolves users by requesting their entries from a directory Server.
+// All certificates are validated against the TrustedCertificate before they are used.
+//
+// *NOTE*: By default, the certificate authority only certifies the keys of an entry. The directory is trusted to map
+// ids to certificates and to assign the monitor role. Set VerifySubject and Monitors to limit this trust.
+type Client struct {
+	// BaseURL is the URL of the directory Server, e.g. https://directory.example.com
+	BaseURL string
+	// TrustedCertificate is the PEM-encoded certificate of the trusted certificate authority.
+	TrustedCertificate string
+	// HTTPClient is used to send requests. The http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+	// VerifySubject requires the common name of both certificates of an entry to equal its id, such that the
+	// directory can not assign the certificates of one user to another.
+	VerifySubject bool
+	// Monitors lists the ids of the users which are accepted as monitors. If it is nil, the isMonitor flag of the
+	// directory entries is trusted.
+	Monitors []string
+}
+
+// Fetch requests the entry of the given user and imports it as RemoteUser.
+func (client Client) Fetch(id string) (user.RemoteUser, error) {
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Get(strings.TrimSuffix(client.BaseURL, "/") + UsersPath + url.PathEscape(id))
+	if err != nil {
+		return user.RemoteUser{}, ItCryptoError{Des: "Could not request directory", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return user.RemoteUser{}, ErrUnknownUser
+	}
+	if response.StatusCode != http.StatusOK {
+		return user.RemoteUser{}, ItCryptoError{Des: fmt.Sprintf("Directory responded with status %d", response.StatusCode)}
+	}
+
+	var entry Entry
+	err = json.NewDecoder(response.Body).Decode(&entry)
+	if err != nil {
+		return user.RemoteUser{}, ItCryptoError{Des: "Could not deserialize directory entry", Err: err}
+	}
+	if entry.Id != id {
+		return user.RemoteUser{}, ItCryptoError{Des: "Directory returned entry of another user"}
+	}
+
+	if entry.IsMonitor && client.Monitors != nil && !slices.Contains(client.Monitors, entry.Id) {
+		return user.RemoteUser{}, ItCryptoError{Des: "Directory entry claims the monitor role of an unknown monitor", Class: ClassAuthorization}
+	}
+
+	remoteUser, err := user.ImportRemoteUser(entry.Id, entry.EncryptionCertificate, entry.VerificationCertificate, entry.IsMonitor, client.TrustedCertificate)
+	if err != nil {
+		return user.RemoteUser{}, err
+	}
+	if client.VerifySubject {
+		for _, certificate := range []string{entry.EncryptionCertificate, entry.VerificationCertificate} {
+			err = verifySubject(certificate, entry.Id)
+			if err != nil {
+				return user.RemoteUser{}, err
+			}
+		}
+	}
+	remoteUser.Versions = entry.Versions
+	return remoteUser, nil
+}
+
+// FetchUser returns a user.FetchUser function backed by this client. Users which can not be resolved are returned
+// without certificates, such that all cryptographic operations involving them fail.
+func (client Client) FetchUser() user.FetchUser {
+	return func(id string) user.RemoteUser {
+		remoteUser, err := client.Fetch(id)
+		if err != nil {
+			return user.RemoteUser{Id: id}
+		}
+		return remoteUser
+	}
+}
+
+// verifySubject checks that the common name of the PEM-encoded certificate equals the id.
+func verifySubject(certificate string, id string) error {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return ItCryptoError{Des: "Could not decode certificate", Class: ClassCertificate}
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return ItCryptoError{Des: "Could not parse certificate", Err: err, Class: ClassCertificate}
+	}
+	if parsed.Subject.CommonName != id {
+		return ItCryptoError{Des: "Certificate subject does not match the id of the directory entry", Class: ClassCertificate}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package directory
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UsersPath is the path under which the Server publishes the directory entries. The entry of a user is
+// available at UsersPath + url.PathEscape(id).
+const UsersPath = "/users/"
+
+// Server publishes the entries of a Store via HTTP.
+type Server struct {
+	Store Store
+}
+
+// ServeHTTP answers GET requests for UsersPath + id with the json-encoded entry of the user.
+func (server Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.EscapedPath(), UsersPath) {
+		http.NotFound(w, r)
+		return
+	}
+
+	id, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), UsersPath))
+	if err != nil || id == "" {
+		http.Error(w, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := server.Store.Lookup(id)
+	if err == ErrUnknownUser {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not lookup user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entry)
+}
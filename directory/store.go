@@ -0,0 +1,98 @@
+package directory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// ErrUnknownUser is returned by a Store if no entry exists for the requested id.
+var ErrUnknownUser = ItCryptoError{Des: "Unknown user"}
+
+// Entry represents the public information of a user which is published in the directory.
+// The certificates are PEM-encoded and need to be signed by the trusted certificate authority.
+// Versions lists the protocol versions the user supports. Senders use it to select the protocol version of the
+// tokens they create for the user. If it is empty, the user is assumed to support all versions.
+type Entry struct {
+	Id                      string `json:"id"`
+	EncryptionCertificate   string `json:"encryptionCertificate"`
+	VerificationCertificate string `json:"verificationCertificate"`
+	IsMonitor               bool   `json:"isMonitor"`
+	Versions                []int  `json:"versions,omitempty"`
+}
+
+// Store resolves the id of a user to its directory entry.
+type Store interface {
+	Lookup(id string) (Entry, error)
+}
+
+// MemoryStore is a Store which holds all entries in memory.
+type MemoryStore map[string]Entry
+
+// Lookup returns the entry of the given user.
+func (store MemoryStore) Lookup(id string) (Entry, error) {
+	entry, ok := store[id]
+	if !ok {
+		return Entry{}, ErrUnknownUser
+	}
+	return entry, nil
+}
+
+// LoadFileStore reads a json file containing a list of entries into a MemoryStore.
+func LoadFileStore(path string) (MemoryStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not read directory file", Err: err}
+	}
+
+	var entries []Entry
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not deserialize directory file", Err: err}
+	}
+
+	store := MemoryStore{}
+	for _, entry := range entries {
+		store[entry.Id] = entry
+	}
+	return store, nil
+}
+
+// SQLStore is a Store which reads entries from a SQL database, e.g. SQLite.
+// The database driver needs to be registered by the caller. The entries are read from the following table:
+//
+//	CREATE TABLE users (
+//		id TEXT PRIMARY KEY,
+//		encryption_certificate TEXT NOT NULL,
+//		verification_certificate TEXT NOT NULL,
+//		is_monitor BOOLEAN NOT NULL,
+//		versions TEXT
+//	)
+//
+// The column versions contains the supported protocol versions as json array, e.g. [1,2]. It may be NULL.
+type SQLStore struct {
+	DB *sql.DB
+}
+
+// Lookup returns the entry of the given user.
+func (store SQLStore) Lookup(id string) (Entry, error) {
+	entry := Entry{Id: id}
+	var versions sql.NullString
+	row := store.DB.QueryRow("SELECT encryption_certificate, verification_certificate, is_monitor, versions FROM users WHERE id = ?", id)
+	err := row.Scan(&entry.EncryptionCertificate, &entry.VerificationCertificate, &entry.IsMonitor, &versions)
+	if err == sql.ErrNoRows {
+		return Entry{}, ErrUnknownUser
+	}
+	if err != nil {
+		return Entry{}, ItCryptoError{Des: "Could not query directory database", Err: err}
+	}
+	if versions.Valid && versions.String != "" {
+		err = json.Unmarshal([]byte(versions.String), &entry.Versions)
+		if err != nil {
+			return Entry{}, ItCryptoError{Des: "Could not deserialize versions of directory entry", Err: err}
+		}
+	}
+	return entry, nil
+}
@@ -2,9 +2,29 @@ package error
 
 import "fmt"
 
+// Class groups errors by the reason why an operation failed. Classes are independent of the error descriptions,
+// such that they can be compared across the implementations of the protocol, e.g. in test vectors.
+type Class string
+
+const (
+	// ClassDecryption is used if a token can not be parsed or decrypted with the keys of the receiver.
+	ClassDecryption Class = "decryption"
+	// ClassSignature is used if a signature is invalid or missing.
+	ClassSignature Class = "signature"
+	// ClassCertificate is used if a certificate can not be resolved, parsed or verified.
+	ClassCertificate Class = "certificate"
+	// ClassAuthorization is used if a user performed an operation it is not allowed to.
+	ClassAuthorization Class = "authorization"
+	// ClassMalformed is used if the content of a token is inconsistent or can not be deserialized.
+	ClassMalformed Class = "malformed"
+	// ClassVersion is used if a token uses a protocol version which is not supported.
+	ClassVersion Class = "version"
+)
+
 type ItCryptoError struct {
-	Des string
-	Err error
+	Des   string
+	Err   error
+	Class Class
 }
 
 func (e ItCryptoError) Error() string {
@@ -14,3 +34,25 @@ func (e ItCryptoError) Error() string {
 	}
 	return e.Des
 }
+
+// Unwrap returns the error which caused this error.
+func (e ItCryptoError) Unwrap() error {
+	return e.Err
+}
+
+// ClassOf returns the Class of the most specific ItCryptoError in the chain of the given error.
+// It returns an empty Class if no error in the chain is classified.
+func ClassOf(err error) Class {
+	var class Class
+	for err != nil {
+		if itCryptoError, ok := err.(ItCryptoError); ok && itCryptoError.Class != "" {
+			class = itCryptoError.Class
+		}
+		unwrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = unwrapper.Unwrap()
+	}
+	return class
+}
@@ -3,8 +3,10 @@ module github.com/haggj/go-it-crypto
 go 1.18
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/google/uuid v1.3.0
 	github.com/stretchr/testify v1.8.1
+	golang.org/x/exp v0.0.0-20221114191408-850992195362
 	gopkg.in/square/go-jose.v2 v2.6.0
 )
 
@@ -13,6 +15,5 @@ require (
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/crypto v0.1.0 // indirect
-	golang.org/x/exp v0.0.0-20221114191408-850992195362 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
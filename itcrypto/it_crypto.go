@@ -1,6 +1,8 @@
 package itcrypto
 
 import (
+	"time"
+
 	. "github.com/haggj/go-it-crypto/error"
 	"github.com/haggj/go-it-crypto/logs"
 	"github.com/haggj/go-it-crypto/user"
@@ -11,6 +13,7 @@ import (
 type ItCrypto struct {
 	FetchUser user.FetchUser
 	User      *user.AuthenticatedUser
+	Options   user.Options
 }
 
 // Login logs a user in with its keys and certificates.
@@ -30,7 +33,10 @@ func (obj *ItCrypto) EncryptLog(log logs.SingedLog, receivers []user.RemoteUser)
 	if obj.User == nil {
 		return "", ItCryptoError{Des: "Before you can encrypt you need to login a user"}
 	}
-	return obj.User.EncryptLog(log, receivers)
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to provide FetchUser function"}
+	}
+	return obj.User.EncryptLogWithOptions(log, receivers, obj.FetchUser, obj.Options)
 }
 
 // DecryptLog decrypts the given JWE token. This requires a logged-in user.
@@ -41,13 +47,229 @@ func (obj *ItCrypto) DecryptLog(jwe string) (logs.SingedLog, error) {
 	if obj.FetchUser == nil {
 		return logs.SingedLog{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
 	}
-	return obj.User.DecryptLog(jwe, obj.FetchUser)
+	return obj.User.DecryptLogWithOptions(jwe, obj.FetchUser, obj.Options)
+}
+
+// VerifyLog verifies a log which was received without encryption and returns the AccessLog with its signers.
+// This requires a FetchUser function but no logged-in user.
+func (obj *ItCrypto) VerifyLog(log logs.SingedLog) (user.VerifiedAccessLog, error) {
+	if obj.FetchUser == nil {
+		return user.VerifiedAccessLog{}, ItCryptoError{Des: "Before you can verify you need to provide FetchUser function"}
+	}
+	return user.VerifyLogWithOptions(log, obj.FetchUser, obj.Options)
+}
+
+// DecryptVerifiedLog decrypts the given JWE token and returns the verified log together with its provenance:
+// the signing monitors, the creator of the token, the algorithms and the checks which passed.
+// This requires a logged-in user.
+func (obj *ItCrypto) DecryptVerifiedLog(jwe string) (user.VerifiedLog, error) {
+	if obj.User == nil {
+		return user.VerifiedLog{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return user.VerifiedLog{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.DecryptVerifiedLog(jwe, obj.FetchUser, obj.Options)
+}
+
+// DecryptDelegatedLog decrypts the given JWE token in delegation mode. This requires a logged-in user.
+// The returned DelegatedLog can be forwarded to others with ForwardLog.
+func (obj *ItCrypto) DecryptDelegatedLog(jwe string) (user.DelegatedLog, error) {
+	if obj.User == nil {
+		return user.DelegatedLog{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return user.DelegatedLog{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.DecryptDelegatedLog(jwe, obj.FetchUser, obj.Options)
+}
+
+// ForwardLog forwards the given DelegatedLog to the given receivers. This requires a logged-in user.
+// The function returns a JWE token encoded as string.
+func (obj *ItCrypto) ForwardLog(log user.DelegatedLog, receivers []user.RemoteUser) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can forward you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can forward you need to provide FetchUser function"}
+	}
+	return obj.User.ForwardLog(log, receivers, obj.FetchUser, obj.Options)
+}
+
+// MigrateToken re-encrypts the given JWE token, which was encrypted for the logged-in user, to the new keys of
+// this user. This requires a logged-in user with the keys the token was encrypted with.
+func (obj *ItCrypto) MigrateToken(jwe string, newKeys user.RemoteUser) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can migrate you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can migrate you need to provide FetchUser function"}
+	}
+	return obj.User.MigrateToken(jwe, newKeys, obj.FetchUser, obj.Options)
+}
+
+// NewReEncryptionKey creates a ReEncryptionKey which allows a proxy, e.g. a mailbox, to re-encrypt the tokens of
+// the logged-in user for the delegate. If lifetime is not zero, the delegate only accepts re-encrypted tokens within
+// this lifetime.
+func (obj *ItCrypto) NewReEncryptionKey(delegate user.RemoteUser, lifetime time.Duration) (user.ReEncryptionKey, error) {
+	if obj.User == nil {
+		return user.ReEncryptionKey{}, ItCryptoError{Des: "Before you can delegate you need to login a user"}
+	}
+	return obj.User.NewReEncryptionKey(delegate, lifetime)
+}
+
+// PartialDecrypt decrypts the key share of the logged-in user of a token, which requires a quorum, and encrypts it
+// for the combiner. This requires a logged-in user.
+func (obj *ItCrypto) PartialDecrypt(jwe string, combiner user.RemoteUser) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	return obj.User.PartialDecrypt(jwe, combiner)
+}
+
+// CombineDecrypt decrypts a token, which requires a quorum, with the partial decryptions the recipients created for
+// the logged-in user. This requires a logged-in user and a FetchUser function.
+func (obj *ItCrypto) CombineDecrypt(jwe string, partials []string) (user.VerifiedLog, error) {
+	if obj.User == nil {
+		return user.VerifiedLog{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return user.VerifiedLog{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.CombineDecrypt(jwe, partials, obj.FetchUser, obj.Options)
 }
 
 // SignLog signs the provided raw log data (encoded as AccessLog). This requires a logged-in user.
+// If a Timestamper is configured in the Options, the signature is timestamped.
 func (obj *ItCrypto) SignLog(log logs.AccessLog) (logs.SingedLog, error) {
 	if obj.User == nil {
 		return logs.SingedLog{}, ItCryptoError{Des: "Before you can sign data you need to login a user"}
 	}
-	return obj.User.SignLog(log)
+	return obj.User.SignLogWithOptions(log, obj.Options)
+}
+
+// CountersignLog adds the signature of the logged-in user to a log which is already signed by another monitor.
+func (obj *ItCrypto) CountersignLog(log logs.SingedLog) (logs.SingedLog, error) {
+	if obj.User == nil {
+		return logs.SingedLog{}, ItCryptoError{Des: "Before you can sign data you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SingedLog{}, ItCryptoError{Des: "Before you can sign data you need to provide FetchUser function"}
+	}
+	return obj.User.CountersignLog(log, obj.FetchUser)
+}
+
+// SignLogDisclosable signs the provided raw log data in selective disclosure mode. This requires a logged-in user.
+func (obj *ItCrypto) SignLogDisclosable(log logs.AccessLog) (logs.DisclosableLog, error) {
+	if obj.User == nil {
+		return logs.DisclosableLog{}, ItCryptoError{Des: "Before you can sign data you need to login a user"}
+	}
+	return obj.User.SignLogDisclosable(log)
+}
+
+// EncryptDisclosableLog encrypts the given DisclosableLog for the given receivers. Receivers only see the fields
+// disclosed by the DisclosableLog. This requires a logged-in user.
+func (obj *ItCrypto) EncryptDisclosableLog(log logs.DisclosableLog, receivers []user.RemoteUser) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to provide FetchUser function"}
+	}
+	return obj.User.EncryptDisclosableLog(log, receivers, obj.FetchUser, obj.Options)
+}
+
+// DecryptDisclosableLog decrypts the given JWE token and returns the log with its disclosures.
+// This requires a logged-in user.
+func (obj *ItCrypto) DecryptDisclosableLog(jwe string) (logs.DisclosableLog, error) {
+	if obj.User == nil {
+		return logs.DisclosableLog{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.DisclosableLog{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.DecryptDisclosableLog(jwe, obj.FetchUser, obj.Options)
+}
+
+// InspectToken returns the public metadata of the given JWE token. This does not require a logged-in user.
+// *NOTE*: The returned metadata is not verified. Use DecryptLog to verify it.
+func (obj *ItCrypto) InspectToken(jwe string) (user.UnverifiedMetadata, error) {
+	return user.InspectToken(jwe)
+}
+
+// CreateReceipt decrypts the given JWE token and returns a receipt signed by the logged-in user.
+func (obj *ItCrypto) CreateReceipt(jwe string) (logs.SignedReceipt, error) {
+	if obj.User == nil {
+		return logs.SignedReceipt{}, ItCryptoError{Des: "Before you can create a receipt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SignedReceipt{}, ItCryptoError{Des: "Before you can create a receipt you need to provide FetchUser function"}
+	}
+	return obj.User.CreateReceipt(jwe, obj.FetchUser, obj.Options)
+}
+
+// EncryptReceipt encrypts a receipt of the logged-in user for the sharer of the acknowledged token.
+func (obj *ItCrypto) EncryptReceipt(receipt logs.SignedReceipt) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to provide FetchUser function"}
+	}
+	return obj.User.EncryptReceipt(receipt, obj.FetchUser)
+}
+
+// DecryptReceipt decrypts a receipt which was encrypted for the logged-in user.
+func (obj *ItCrypto) DecryptReceipt(jwe string) (logs.SignedReceipt, logs.Receipt, error) {
+	if obj.User == nil {
+		return logs.SignedReceipt{}, logs.Receipt{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SignedReceipt{}, logs.Receipt{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.DecryptReceipt(jwe, obj.FetchUser)
+}
+
+// CreateObjection creates an objection of the logged-in user against a log the user owns.
+func (obj *ItCrypto) CreateObjection(log logs.SingedLog, reason string) (logs.SignedObjection, error) {
+	if obj.User == nil {
+		return logs.SignedObjection{}, ItCryptoError{Des: "Before you can object you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SignedObjection{}, ItCryptoError{Des: "Before you can object you need to provide FetchUser function"}
+	}
+	return obj.User.CreateObjection(log, reason, obj.FetchUser)
+}
+
+// EncryptObjection encrypts an objection of the logged-in user for the monitor of the log and the given officers.
+func (obj *ItCrypto) EncryptObjection(objection logs.SignedObjection, officers ...user.RemoteUser) (string, error) {
+	if obj.User == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return "", ItCryptoError{Des: "Before you can encrypt you need to provide FetchUser function"}
+	}
+	return obj.User.EncryptObjection(objection, obj.FetchUser, officers...)
+}
+
+// DecryptObjection decrypts an objection which was encrypted for the logged-in user.
+func (obj *ItCrypto) DecryptObjection(jwe string) (logs.SignedObjection, logs.Objection, error) {
+	if obj.User == nil {
+		return logs.SignedObjection{}, logs.Objection{}, ItCryptoError{Des: "Before you can decrypt you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SignedObjection{}, logs.Objection{}, ItCryptoError{Des: "Before you can decrypt you need to provide FetchUser function"}
+	}
+	return obj.User.DecryptObjection(jwe, obj.FetchUser)
+}
+
+// RespondToObjection creates the response of the logged-in user to an objection against a log the user monitored.
+func (obj *ItCrypto) RespondToObjection(objection logs.SignedObjection, decision string, message string) (logs.SignedObjectionResponse, error) {
+	if obj.User == nil {
+		return logs.SignedObjectionResponse{}, ItCryptoError{Des: "Before you can respond you need to login a user"}
+	}
+	if obj.FetchUser == nil {
+		return logs.SignedObjectionResponse{}, ItCryptoError{Des: "Before you can respond you need to provide FetchUser function"}
+	}
+	return obj.User.RespondToObjection(objection, decision, message, obj.FetchUser)
 }
@@ -1,7 +1,6 @@
 package logs
 
 import (
-	b64 "encoding/base64"
 	"encoding/json"
 )
 
@@ -43,7 +42,7 @@ func AccessLogFromJson(data []byte) (AccessLog, error) {
 // FromSingedLog tries to extract an AccessLog from the given SignedAccessLog.
 // This does not involve any verification checks.
 func FromSingedLog(signedLog SingedLog) (AccessLog, error) {
-	jsonData, err := b64.RawURLEncoding.DecodeString(signedLog.Payload)
+	jsonData, err := JWS(signedLog).PayloadBytes()
 	if err != nil {
 		return AccessLog{}, err
 	}
@@ -0,0 +1,197 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// CanonicalJson serializes the given value into its canonical JSON form as defined by the JSON Canonicalization
+// Scheme (RFC 8785). The canonical form only depends on the logical content of the value, such that all
+// implementations of the protocol sign the same bytes for the same AccessLog or SharedLog.
+func CanonicalJson(value interface{}) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize value", Err: err}
+	}
+	return Canonicalize(data)
+}
+
+// Canonicalize transforms the given JSON document into its canonical form (RFC 8785): Object members are sorted by
+// the UTF-16 code units of their names, whitespace is removed and strings and numbers are serialized like
+// ECMAScript does. Documents with duplicate member names or numbers which are not finite are rejected.
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buffer bytes.Buffer
+	err := canonicalizeValue(decoder, &buffer)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not canonicalize JSON", Err: err, Class: ClassMalformed}
+	}
+	if _, err = decoder.Token(); err != io.EOF {
+		return nil, ItCryptoError{Des: "Could not canonicalize JSON", Err: fmt.Errorf("unexpected data after JSON value"), Class: ClassMalformed}
+	}
+	return buffer.Bytes(), nil
+}
+
+// canonicalizeValue reads the next JSON value from the decoder and writes its canonical form to the buffer.
+func canonicalizeValue(decoder *json.Decoder, buffer *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '[' {
+			return canonicalizeArray(decoder, buffer)
+		}
+		return canonicalizeObject(decoder, buffer)
+	case string:
+		writeCanonicalString(buffer, value)
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		formatted, err := formatCanonicalNumber(number)
+		if err != nil {
+			return err
+		}
+		buffer.WriteString(formatted)
+	case bool:
+		buffer.WriteString(strconv.FormatBool(value))
+	case nil:
+		buffer.WriteString("null")
+	}
+	return nil
+}
+
+func canonicalizeArray(decoder *json.Decoder, buffer *bytes.Buffer) error {
+	buffer.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		err := canonicalizeValue(decoder, buffer)
+		if err != nil {
+			return err
+		}
+	}
+	buffer.WriteByte(']')
+	_, err := decoder.Token()
+	return err
+}
+
+func canonicalizeObject(decoder *json.Decoder, buffer *bytes.Buffer) error {
+	members := map[string][]byte{}
+	var names []string
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		name := token.(string)
+		if _, ok := members[name]; ok {
+			return fmt.Errorf("duplicate member %q", name)
+		}
+
+		var member bytes.Buffer
+		err = canonicalizeValue(decoder, &member)
+		if err != nil {
+			return err
+		}
+		members[name] = member.Bytes()
+		names = append(names, name)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	// Members are sorted by the UTF-16 code units of their names
+	sort.Slice(names, func(i, j int) bool {
+		return lessUtf16(names[i], names[j])
+	})
+	buffer.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		writeCanonicalString(buffer, name)
+		buffer.WriteByte(':')
+		buffer.Write(members[name])
+	}
+	buffer.WriteByte('}')
+	return nil
+}
+
+// lessUtf16 compares two strings by their UTF-16 code units.
+func lessUtf16(a string, b string) bool {
+	unitsA, unitsB := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(unitsA) && i < len(unitsB); i++ {
+		if unitsA[i] != unitsB[i] {
+			return unitsA[i] < unitsB[i]
+		}
+	}
+	return len(unitsA) < len(unitsB)
+}
+
+// writeCanonicalString writes the given string as JSON string. Only quotation marks, backslashes and control
+// characters are escaped.
+func writeCanonicalString(buffer *bytes.Buffer, value string) {
+	buffer.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '"':
+			buffer.WriteString(`\"`)
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\b':
+			buffer.WriteString(`\b`)
+		case '\f':
+			buffer.WriteString(`\f`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		case '\t':
+			buffer.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buffer, `\u%04x`, r)
+			} else {
+				buffer.WriteRune(r)
+			}
+		}
+	}
+	buffer.WriteByte('"')
+}
+
+// formatCanonicalNumber formats the given number like the ECMAScript Number.prototype.toString method.
+func formatCanonicalNumber(value float64) (string, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", fmt.Errorf("number %v is not finite", value)
+	}
+	if value == 0 {
+		return "0", nil
+	}
+
+	abs := math.Abs(value)
+	if abs >= 1e21 || abs < 1e-6 {
+		// ECMAScript omits the leading zeros of the exponent, e.g. 1e-7 instead of 1e-07
+		formatted := strconv.FormatFloat(value, 'e', -1, 64)
+		index := strings.IndexByte(formatted, 'e')
+		mantissa, sign, exponent := formatted[:index], formatted[index+1], strings.TrimLeft(formatted[index+2:], "0")
+		return mantissa + "e" + string(sign) + exponent, nil
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), nil
+}
@@ -0,0 +1,183 @@
+package logs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// DisclosableFields lists the json names of all AccessLog fields which can be disclosed selectively.
+// The monitor and the owner of a log are always visible since they are required to verify the log.
+var DisclosableFields = []string{"tool", "justification", "timestamp", "accessKind", "dataType"}
+
+// DisclosureAlgorithm is the hash algorithm used to digest disclosures. It is stored as _sd_alg in the payload.
+const DisclosureAlgorithm = "sha-256"
+
+// Disclosure reveals a single field of a selectively disclosable log. Similar to SD-JWT, a disclosure is the
+// base64url-encoded json array [salt, name, value]. The signed log only contains the digest of each disclosure.
+type Disclosure string
+
+// NewDisclosure creates a disclosure with a random salt for the given field.
+func NewDisclosure(name string, value interface{}) (Disclosure, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not generate salt", Err: err}
+	}
+
+	data, err := json.Marshal([]interface{}{base64.RawURLEncoding.EncodeToString(salt), name, value})
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize disclosure", Err: err}
+	}
+	return Disclosure(base64.RawURLEncoding.EncodeToString(data)), nil
+}
+
+// Digest returns the base64url-encoded SHA-256 digest of the disclosure.
+func (disclosure Disclosure) Digest() string {
+	digest := sha256.Sum256([]byte(disclosure))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// Decode returns the name and the json-encoded value of the disclosed field.
+func (disclosure Disclosure) Decode() (string, json.RawMessage, error) {
+	data, err := base64.RawURLEncoding.DecodeString(string(disclosure))
+	if err != nil {
+		return "", nil, ItCryptoError{Des: "Could not base64 decode disclosure", Err: err, Class: ClassMalformed}
+	}
+
+	var parts []json.RawMessage
+	err = json.Unmarshal(data, &parts)
+	if err != nil || len(parts) != 3 {
+		return "", nil, ItCryptoError{Des: "Could not deserialize disclosure", Err: err, Class: ClassMalformed}
+	}
+
+	var name string
+	err = json.Unmarshal(parts[1], &name)
+	if err != nil {
+		return "", nil, ItCryptoError{Des: "Could not deserialize name of disclosure", Err: err, Class: ClassMalformed}
+	}
+	return name, parts[2], nil
+}
+
+// DisclosablePayload turns the given AccessLog into the payload of a selectively disclosable log.
+// The payload contains the monitor, the owner and the digests of all disclosures.
+func DisclosablePayload(log AccessLog) ([]byte, []Disclosure, error) {
+	rawLog, err := json.Marshal(log)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(rawLog, &fields)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var disclosures []Disclosure
+	var digests []string
+	for _, name := range DisclosableFields {
+		disclosure, err := NewDisclosure(name, fields[name])
+		if err != nil {
+			return nil, nil, err
+		}
+		disclosures = append(disclosures, disclosure)
+		digests = append(digests, disclosure.Digest())
+	}
+
+	// Sort digests, such that their order does not reveal which field they belong to
+	sort.Strings(digests)
+	payload, err := json.Marshal(map[string]interface{}{
+		"monitor": log.Monitor,
+		"owner":   log.Owner,
+		"_sd":     digests,
+		"_sd_alg": DisclosureAlgorithm,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, disclosures, nil
+}
+
+// DisclosableLog is a SingedLog which was signed in selective disclosure mode together with disclosures of its
+// fields. Only fields with a disclosure are revealed.
+type DisclosableLog struct {
+	Log         SingedLog
+	Disclosures []Disclosure
+}
+
+// Reveal returns a copy of the DisclosableLog which only contains the disclosures of the given fields.
+// The signature of the monitor stays valid.
+func (log DisclosableLog) Reveal(fields ...string) (DisclosableLog, error) {
+	revealed := DisclosableLog{Log: log.Log}
+	for _, disclosure := range log.Disclosures {
+		name, _, err := disclosure.Decode()
+		if err != nil {
+			return DisclosableLog{}, err
+		}
+		if slices.Contains(fields, name) {
+			revealed.Disclosures = append(revealed.Disclosures, disclosure)
+		}
+	}
+	return revealed, nil
+}
+
+// Extract tries to extract the AccessLog from the DisclosableLog. Fields which are not disclosed are empty.
+// This verifies that all disclosures belong to the log but does not verify the signature of the log.
+func (log DisclosableLog) Extract() (AccessLog, error) {
+	rawJson, err := JWS(log.Log).PayloadBytes()
+	if err != nil {
+		return AccessLog{}, ItCryptoError{Des: "Could not decode payload in jwsAccessLog", Err: err, Class: ClassMalformed}
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(rawJson, &fields)
+	if err != nil {
+		return AccessLog{}, ItCryptoError{Des: "Could not deserialize payload in jwsAccessLog", Err: err, Class: ClassMalformed}
+	}
+
+	var digests []string
+	if rawDigests, ok := fields["_sd"]; ok {
+		err = json.Unmarshal(rawDigests, &digests)
+		if err != nil {
+			return AccessLog{}, ItCryptoError{Des: "Could not deserialize digests in jwsAccessLog", Err: err, Class: ClassMalformed}
+		}
+	}
+
+	// Disclosures are only digested with DisclosureAlgorithm
+	_, hasDigests := fields["_sd"]
+	rawAlgorithm, hasAlgorithm := fields["_sd_alg"]
+	if hasDigests || hasAlgorithm {
+		var algorithm string
+		err = json.Unmarshal(rawAlgorithm, &algorithm)
+		if err != nil || algorithm != DisclosureAlgorithm {
+			return AccessLog{}, ItCryptoError{Des: "Malformed data: Unsupported disclosure algorithm.", Err: err, Class: ClassMalformed}
+		}
+	}
+
+	disclosed := map[string]bool{}
+	for _, disclosure := range log.Disclosures {
+		if !slices.Contains(digests, disclosure.Digest()) {
+			return AccessLog{}, ItCryptoError{Des: "Malformed data: Disclosure does not belong to the log.", Class: ClassMalformed}
+		}
+		name, value, err := disclosure.Decode()
+		if err != nil {
+			return AccessLog{}, err
+		}
+		if !slices.Contains(DisclosableFields, name) || disclosed[name] {
+			return AccessLog{}, ItCryptoError{Des: "Malformed data: Invalid disclosure for field " + name + ".", Class: ClassMalformed}
+		}
+		disclosed[name] = true
+		fields[name] = value
+	}
+
+	rawLog, err := json.Marshal(fields)
+	if err != nil {
+		return AccessLog{}, ItCryptoError{Des: "Could not serialize disclosed log", Err: err}
+	}
+	return AccessLogFromJson(rawLog)
+}
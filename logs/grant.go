@@ -0,0 +1,21 @@
+package logs
+
+// ReEncryptionGrant authorizes a proxy to re-encrypt the tokens of the owner for the delegate. Precursor binds the
+// grant to a single re-encryption key. Expires is a unix timestamp; grants without Expires do not expire.
+type ReEncryptionGrant struct {
+	Owner     string `json:"owner"`
+	Delegate  string `json:"delegate"`
+	Precursor string `json:"precursor"`
+	Expires   int64  `json:"expires,omitempty"`
+}
+
+// SignedGrant is a ReEncryptionGrant signed by its owner.
+type SignedGrant JWS
+
+// Extract tries to extract the ReEncryptionGrant from the SignedGrant.
+// This does not involve any verification checks.
+func (grant SignedGrant) Extract() (ReEncryptionGrant, error) {
+	var result ReEncryptionGrant
+	err := extractPayload(JWS(grant), &result)
+	return result, err
+}
@@ -0,0 +1,69 @@
+package logs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// Decisions a monitor can take on an Objection.
+const (
+	ObjectionAccepted = "accepted"
+	ObjectionRejected = "rejected"
+)
+
+// Objection is raised by the owner of a log to object to an illegitimate access.
+// It references the SingedLog by its digest and contains the log itself, such that the monitor and data-protection
+// officers can verify it.
+type Objection struct {
+	Log       SingedLog `json:"log"`
+	LogDigest string    `json:"logDigest"`
+	Owner     string    `json:"owner"`
+	Reason    string    `json:"reason"`
+	Timestamp int64     `json:"timestamp"`
+}
+
+// SignedObjection is an Objection signed by the owner of the log.
+type SignedObjection JWS
+
+// Extract tries to extract the Objection from the SignedObjection.
+// This does not involve any verification checks.
+func (objection SignedObjection) Extract() (Objection, error) {
+	var result Objection
+	err := extractPayload(JWS(objection), &result)
+	return result, err
+}
+
+// ObjectionResponse is the answer of the monitor to an Objection. It references the SignedObjection by its digest.
+type ObjectionResponse struct {
+	Objection string `json:"objection"`
+	Monitor   string `json:"monitor"`
+	Decision  string `json:"decision"`
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// SignedObjectionResponse is an ObjectionResponse signed by the monitor.
+type SignedObjectionResponse JWS
+
+// Extract tries to extract the ObjectionResponse from the SignedObjectionResponse.
+// This does not involve any verification checks.
+func (response SignedObjectionResponse) Extract() (ObjectionResponse, error) {
+	var result ObjectionResponse
+	err := extractPayload(JWS(response), &result)
+	return result, err
+}
+
+// extractPayload deserializes the payload of the JWS token into value without verifying the token.
+func extractPayload(jws JWS, value interface{}) error {
+	rawJson, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return ItCryptoError{Des: "Could not base64 decode payload", Err: err, Class: ClassMalformed}
+	}
+	err = json.Unmarshal(rawJson, value)
+	if err != nil {
+		return ItCryptoError{Des: "Could not deserialize payload", Err: err, Class: ClassMalformed}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package logs
+
+// Receipt confirms that a recipient received and decrypted a JWE token.
+// Token is the digest of the JWE token (see user.TokenDigest) and Sharer the creator of the decrypted SharedLog.
+type Receipt struct {
+	Token     string `json:"token"`
+	Recipient string `json:"recipient"`
+	Sharer    string `json:"sharer"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// SignedReceipt is a Receipt signed by its recipient.
+type SignedReceipt JWS
+
+// Extract tries to extract the Receipt from the SignedReceipt.
+// This does not involve any verification checks.
+func (receipt SignedReceipt) Extract() (Receipt, error) {
+	var result Receipt
+	err := extractPayload(JWS(receipt), &result)
+	return result, err
+}
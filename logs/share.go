@@ -0,0 +1,22 @@
+package logs
+
+// KeyShare is the share of the content encryption key of a token which requires a quorum of recipients.
+// Token is the digest of the JWE token (see user.TokenDigest), Index the x-coordinate of the share and Share the
+// base64url-encoded share itself.
+type KeyShare struct {
+	Token     string `json:"token"`
+	Recipient string `json:"recipient"`
+	Index     int    `json:"index"`
+	Share     string `json:"share"`
+}
+
+// SignedKeyShare is a KeyShare signed by its recipient. It is a partial decryption of the token.
+type SignedKeyShare JWS
+
+// Extract tries to extract the KeyShare from the SignedKeyShare.
+// This does not involve any verification checks.
+func (share SignedKeyShare) Extract() (KeyShare, error) {
+	var result KeyShare
+	err := extractPayload(JWS(share), &result)
+	return result, err
+}
@@ -6,10 +6,16 @@ import (
 
 // SharedLog represents a shared log. It contains a nested log (which is singed by a monitor) and information
 // about the creator and intended receivers. A json-encoded SharedLog is encrypted within a JWE token.
+// If the log was forwarded by a recipient, Parent contains the signed SharedLog the log was forwarded from.
+// If the log was signed in selective disclosure mode, Disclosures reveal the fields the receivers can see.
+// If Quorum is set, the log can only be decrypted if this number of recipients combine their partial decryptions.
 type SharedLog struct {
-	Log        SingedLog `json:"log"`
-	Recipients []string  `json:"recipients"`
-	Creator    string    `json:"creator"`
+	Log         SingedLog    `json:"log"`
+	Recipients  []string     `json:"recipients"`
+	Creator     string       `json:"creator"`
+	Parent      *JWS         `json:"parent,omitempty"`
+	Disclosures []Disclosure `json:"disclosures,omitempty"`
+	Quorum      int          `json:"quorum,omitempty"`
 }
 
 func SharedLogFromJson(data []byte) (SharedLog, error) {
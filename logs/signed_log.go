@@ -1,6 +1,7 @@
 package logs
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 
@@ -13,38 +14,135 @@ import (
 type SingedLog JWS
 
 // JWS represents a basic JSON Web Signature token.
+// A token with a single signature uses the flattened JSON serialization. A token with multiple signatures uses the
+// general JSON serialization, where all signatures are listed in Signatures.
 type JWS struct {
-	Payload   string `json:"payload"`
-	Signature string `json:"signature"`
-	Header    string `json:"header,omitempty"`
-	Protected string `json:"protected"`
+	Payload    string                 `json:"payload"`
+	Signature  string                 `json:"signature,omitempty"`
+	Header     map[string]interface{} `json:"header,omitempty"`
+	Protected  string                 `json:"protected,omitempty"`
+	Signatures []Signature            `json:"signatures,omitempty"`
+}
+
+// Signature is a single signature of a JWS token in general JSON serialization.
+type Signature struct {
+	Protected string                 `json:"protected"`
+	Header    map[string]interface{} `json:"header,omitempty"`
+	Signature string                 `json:"signature"`
+}
+
+// AllSignatures returns all signatures of the JWS token, independent of its serialization.
+// The first signature is the original signature of the token.
+func (jws JWS) AllSignatures() []Signature {
+	if len(jws.Signatures) > 0 {
+		return jws.Signatures
+	}
+	return []Signature{{Protected: jws.Protected, Header: jws.Header, Signature: jws.Signature}}
+}
+
+// WithSignatures returns a copy of the JWS token with the given signatures. A single signature is stored in
+// flattened JSON serialization, multiple signatures in general JSON serialization.
+func (jws JWS) WithSignatures(signatures []Signature) JWS {
+	if len(signatures) == 1 {
+		return JWS{Payload: jws.Payload, Protected: signatures[0].Protected, Header: signatures[0].Header, Signature: signatures[0].Signature}
+	}
+	return JWS{Payload: jws.Payload, Signatures: signatures}
 }
 
 func JwsFromBytes(data []byte) (JWS, error) {
 	var obj JWS
 	err := json.Unmarshal(data, &obj)
 	if err != nil {
-		return JWS{}, ItCryptoError{Des: "Failed to deserialized provided data", Err: err}
+		return JWS{}, ItCryptoError{Des: "Failed to deserialized provided data", Err: err, Class: ClassMalformed}
 	}
 	return obj, nil
 }
 
+// ToJsonWebSignature parses the JWS token with go-jose. The payload of a token with an unencoded payload is not
+// parsed, such that its signatures need to be verified with DetachedVerify and the result of PayloadBytes.
 func (jws JWS) ToJsonWebSignature() (jose.JSONWebSignature, error) {
+	if jws.Unencoded() {
+		jws.Payload = ""
+	}
 	rawJson, err := json.Marshal(jws)
 	if err != nil {
 		return jose.JSONWebSignature{}, ItCryptoError{Des: "Failed to serialize JWS", Err: err}
 	}
 	sig, err := jose.ParseSigned(string(rawJson))
 	if err != nil {
-		return jose.JSONWebSignature{}, ItCryptoError{Des: "Failed to parse into JSONWebSignature", Err: err}
+		return jose.JSONWebSignature{}, ItCryptoError{Des: "Failed to parse into JSONWebSignature", Err: err, Class: ClassMalformed}
 	}
 	return *sig, nil
 }
 
+// Unencoded reports whether the payload of the JWS token is not base64url-encoded ("b64": false, RFC 7797).
+// All signatures of a token need to agree on this, so the protected header of the first signature decides.
+func (jws JWS) Unencoded() bool {
+	rawHeader, err := base64.RawURLEncoding.DecodeString(jws.AllSignatures()[0].Protected)
+	if err != nil {
+		return false
+	}
+	var header struct {
+		B64 *bool `json:"b64"`
+	}
+	err = json.Unmarshal(rawHeader, &header)
+	return err == nil && header.B64 != nil && !*header.B64
+}
+
+// PayloadBytes returns the signed payload of the JWS token, independent of whether it is base64url-encoded.
+// It fails if the payload is detached.
+func (jws JWS) PayloadBytes() ([]byte, error) {
+	if jws.Payload == "" {
+		return nil, ItCryptoError{Des: "Payload of JWS is detached", Class: ClassMalformed}
+	}
+	if jws.Unencoded() {
+		return []byte(jws.Payload), nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not base64 decode payload", Err: err, Class: ClassMalformed}
+	}
+	return payload, nil
+}
+
+// Digest returns the base64url-encoded SHA-256 digest of the JWS token. The digest covers the protected headers,
+// the payload and the signatures and is used to reference a signed object from another one.
+func (jws JWS) Digest() string {
+	signatures := jws.AllSignatures()
+	data := signatures[0].Protected + "." + jws.Payload + "." + signatures[0].Signature
+	for _, signature := range signatures[1:] {
+		data += "." + signature.Protected + "." + signature.Signature
+	}
+	digest := sha256.Sum256([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
 func (jwsAccessLog SingedLog) Extract() (AccessLog, error) {
-	rawJson, err := base64.RawURLEncoding.DecodeString(jwsAccessLog.Payload)
+	rawJson, err := JWS(jwsAccessLog).PayloadBytes()
 	if err != nil {
-		return AccessLog{}, ItCryptoError{Des: "Could not base64 decode payload in jwsAccessLog", Err: err}
+		return AccessLog{}, ItCryptoError{Des: "Could not decode payload in jwsAccessLog", Err: err, Class: ClassMalformed}
 	}
 	return AccessLogFromJson(rawJson)
 }
+
+// Detach removes the payload from the signed log, e.g. to store or transmit the signature next to the AccessLog
+// without duplicating it. Use Attach to restore the payload.
+func (jwsAccessLog SingedLog) Detach() SingedLog {
+	jwsAccessLog.Payload = ""
+	return jwsAccessLog
+}
+
+// Attach restores the payload of a detached log from the given AccessLog. The signatures of the returned log are
+// only valid if the log was signed over the canonical JSON form of the AccessLog (see CanonicalJson).
+func (jwsAccessLog SingedLog) Attach(log AccessLog) (SingedLog, error) {
+	payload, err := CanonicalJson(log)
+	if err != nil {
+		return SingedLog{}, err
+	}
+	if JWS(jwsAccessLog).Unencoded() {
+		jwsAccessLog.Payload = string(payload)
+	} else {
+		jwsAccessLog.Payload = base64.RawURLEncoding.EncodeToString(payload)
+	}
+	return jwsAccessLog, nil
+}
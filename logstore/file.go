@@ -0,0 +1,79 @@
+package logstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// FileBackend is a Backend which appends records as NDJSON to a single file.
+// It is safe for concurrent use within a single process.
+type FileBackend struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// NewFileBackend creates a FileBackend which stores records in the file at the given path.
+// The file is created on the first write.
+func NewFileBackend(path string) *FileBackend {
+	return &FileBackend{Path: path}
+}
+
+// Append adds the record to the end of the file.
+func (backend *FileBackend) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return ItCryptoError{Des: "Could not serialize record", Err: err}
+	}
+
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	file, err := os.OpenFile(backend.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return ItCryptoError{Des: "Could not open log file", Err: err}
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		return ItCryptoError{Des: "Could not write log file", Err: err}
+	}
+	return nil
+}
+
+// Scan returns all records stored for the owner of the query.
+func (backend *FileBackend) Scan(query Query) ([]Record, error) {
+	backend.mutex.Lock()
+	defer backend.mutex.Unlock()
+	file, err := os.Open(backend.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not open log file", Err: err}
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var record Record
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not deserialize record", Err: err}
+		}
+		if record.AccessLog.Owner == query.Owner {
+			records = append(records, record)
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, ItCryptoError{Des: "Could not read log file", Err: scanner.Err()}
+	}
+	return records, nil
+}
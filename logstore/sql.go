@@ -0,0 +1,116 @@
+package logstore
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// SQLSchema creates the table used by SQLBackend. It is compatible with SQLite.
+const SQLSchema = `CREATE TABLE IF NOT EXISTS logs (
+	id TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	monitor TEXT NOT NULL,
+	tool TEXT NOT NULL,
+	access_kind TEXT NOT NULL,
+	timestamp INTEGER NOT NULL,
+	log TEXT NOT NULL,
+	disclosures TEXT,
+	token TEXT NOT NULL
+)`
+
+// SQLBackend is a Backend which stores records in a SQL database, e.g. SQLite.
+// The database driver needs to be registered by the caller. Use Init to create the table.
+// Tables created before disclosures were stored need the column "disclosures TEXT" to be added.
+type SQLBackend struct {
+	DB *sql.DB
+}
+
+// Init creates the table described by SQLSchema if it does not exist.
+func (backend SQLBackend) Init() error {
+	_, err := backend.DB.Exec(SQLSchema)
+	if err != nil {
+		return ItCryptoError{Des: "Could not create logs table", Err: err}
+	}
+	return nil
+}
+
+// Append inserts the record.
+func (backend SQLBackend) Append(record Record) error {
+	log, err := json.Marshal(record.Log)
+	if err != nil {
+		return ItCryptoError{Des: "Could not serialize log", Err: err}
+	}
+	var disclosures sql.NullString
+	if len(record.Disclosures) > 0 {
+		data, err := json.Marshal(record.Disclosures)
+		if err != nil {
+			return ItCryptoError{Des: "Could not serialize disclosures", Err: err}
+		}
+		disclosures = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err = backend.DB.Exec(
+		"INSERT INTO logs (id, owner, monitor, tool, access_kind, timestamp, log, disclosures, token) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		record.Id, record.AccessLog.Owner, record.AccessLog.Monitor, record.AccessLog.Tool,
+		record.AccessLog.AccessKind, record.AccessLog.Timestamp, string(log), disclosures, record.Token,
+	)
+	if err != nil {
+		return ItCryptoError{Des: "Could not insert log", Err: err}
+	}
+	return nil
+}
+
+// Scan selects the records matching the query. Data types are not filtered by the database.
+func (backend SQLBackend) Scan(query Query) ([]Record, error) {
+	statement := "SELECT id, log, disclosures, token FROM logs WHERE owner = ?"
+	args := []interface{}{query.Owner}
+	if query.From != 0 {
+		statement += " AND timestamp >= ?"
+		args = append(args, query.From)
+	}
+	if query.To != 0 {
+		statement += " AND timestamp <= ?"
+		args = append(args, query.To)
+	}
+	columns := []string{"monitor", "tool", "access_kind"}
+	for i, value := range []string{query.Monitor, query.Tool, query.AccessKind} {
+		if value != "" {
+			statement += " AND " + columns[i] + " = ?"
+			args = append(args, value)
+		}
+	}
+
+	rows, err := backend.DB.Query(statement+" ORDER BY timestamp, id", args...)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not query logs", Err: err}
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var record Record
+		var log string
+		var disclosures sql.NullString
+		err = rows.Scan(&record.Id, &log, &disclosures, &record.Token)
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not read log", Err: err}
+		}
+		err = json.Unmarshal([]byte(log), &record.Log)
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not deserialize log", Err: err}
+		}
+		if disclosures.Valid {
+			err = json.Unmarshal([]byte(disclosures.String), &record.Disclosures)
+			if err != nil {
+				return nil, ItCryptoError{Des: "Could not deserialize disclosures", Err: err}
+			}
+		}
+		records = append(records, record)
+	}
+	if rows.Err() != nil {
+		return nil, ItCryptoError{Des: "Could not read logs", Err: rows.Err()}
+	}
+	return records, nil
+}
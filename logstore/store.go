@@ -0,0 +1,143 @@
+package logstore
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// Record is a decrypted and verified log together with the JWE token it was received in.
+// If the log was signed in selective disclosure mode, Disclosures hold the fields which were disclosed to the owner.
+type Record struct {
+	Id          string            `json:"id"`
+	Log         logs.SingedLog    `json:"log"`
+	Disclosures []logs.Disclosure `json:"disclosures,omitempty"`
+	Token       string            `json:"token"`
+	AccessLog   logs.AccessLog    `json:"accessLog"`
+}
+
+// Query selects records of a single owner. Empty fields match all records.
+type Query struct {
+	// Owner is the owner of the selected logs. It is mandatory.
+	Owner string
+	// From and To select logs with From <= Timestamp <= To. A zero value does not restrict the range.
+	From int
+	To   int
+	// Monitor, Tool and AccessKind select logs with the given values.
+	Monitor    string
+	Tool       string
+	AccessKind string
+	// DataType selects logs which contain the given data type.
+	DataType string
+}
+
+// Matches returns true if the given AccessLog is selected by the query.
+func (query Query) Matches(log logs.AccessLog) bool {
+	return log.Owner == query.Owner &&
+		(query.From == 0 || log.Timestamp >= query.From) &&
+		(query.To == 0 || log.Timestamp <= query.To) &&
+		(query.Monitor == "" || log.Monitor == query.Monitor) &&
+		(query.Tool == "" || log.Tool == query.Tool) &&
+		(query.AccessKind == "" || log.AccessKind == query.AccessKind) &&
+		(query.DataType == "" || slices.Contains(log.DataType, query.DataType))
+}
+
+// Backend persists records. Scan may return more records than selected by the query, the LogStore filters
+// all records after verifying them.
+type Backend interface {
+	Append(record Record) error
+	Scan(query Query) ([]Record, error)
+}
+
+// Verifier verifies the signature of a log and its disclosures and returns the disclosed AccessLog.
+type Verifier func(log logs.DisclosableLog) (logs.AccessLog, error)
+
+// MonitorVerifier returns a Verifier which checks that a log is signed by the monitor it specifies and that all
+// disclosures belong to the log. Logs which are countersigned by further monitors are accepted as well.
+func MonitorVerifier(fetchUser user.FetchUser) Verifier {
+	return func(log logs.DisclosableLog) (logs.AccessLog, error) {
+		_, err := user.VerifyLog(log.Log, fetchUser)
+		if err != nil {
+			return logs.AccessLog{}, err
+		}
+		return log.Extract()
+	}
+}
+
+// LogStore stores verified logs in a Backend. Every log is verified before it is stored and again when it is read,
+// such that modifications of the Backend are detected.
+type LogStore struct {
+	Backend Backend
+	Verify  Verifier
+}
+
+// Put verifies the given log and stores it together with the JWE token it was received in.
+// Use the log returned by Decrypt, since this ensures that the token was shared with the owner.
+func (store LogStore) Put(log logs.SingedLog, jwe string) (Record, error) {
+	return store.PutDisclosable(logs.DisclosableLog{Log: log}, jwe)
+}
+
+// PutDisclosable works like Put but additionally stores the disclosures of a log which was signed in selective
+// disclosure mode. Use the log returned by DecryptDisclosable.
+func (store LogStore) PutDisclosable(log logs.DisclosableLog, jwe string) (Record, error) {
+	accessLog, err := store.Verify(log)
+	if err != nil {
+		return Record{}, ItCryptoError{Des: "Could not verify log", Err: err}
+	}
+
+	record := Record{Id: uuid.New().String(), Log: log.Log, Disclosures: log.Disclosures, Token: jwe, AccessLog: accessLog}
+	err = store.Backend.Append(record)
+	if err != nil {
+		return Record{}, ItCryptoError{Des: "Could not store log", Err: err}
+	}
+	return record, nil
+}
+
+// Query returns all records selected by the query. The AccessLog of each record is re-verified together with its
+// disclosures.
+// Records which can not be verified result in an error.
+func (store LogStore) Query(query Query) ([]Record, error) {
+	if query.Owner == "" {
+		return nil, ItCryptoError{Des: "Queries need to specify an owner"}
+	}
+
+	candidates, err := store.Backend.Scan(query)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not read logs", Err: err}
+	}
+
+	var records []Record
+	for _, record := range candidates {
+		record.AccessLog, err = store.Verify(logs.DisclosableLog{Log: record.Log, Disclosures: record.Disclosures})
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not verify stored log " + record.Id, Err: err}
+		}
+		if query.Matches(record.AccessLog) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// ExportNDJSON writes all records selected by the query to w. Each line contains a json-encoded Record.
+func (store LogStore) ExportNDJSON(w io.Writer, query Query) error {
+	records, err := store.Query(query)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		err = encoder.Encode(record)
+		if err != nil {
+			return ItCryptoError{Des: "Could not export log " + record.Id, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+const (
+	// ChallengeType identifies a signed ChallengeResponse.
+	ChallengeType = "mailbox-challenge"
+	// ChallengeSize is the number of random bytes of a challenge. Challenges are base64url-encoded without padding.
+	ChallengeSize = 32
+)
+
+// ChallengeResponse is signed by a user to authenticate a single request against a mailbox Server.
+// It binds the challenge to the server and the request, such that the signature can not be used as signature of a
+// log or any other data.
+type ChallengeResponse struct {
+	Type      string `json:"typ"`
+	Challenge string `json:"challenge"`
+	Server    string `json:"server"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+}
+
+// NewChallengeResponse creates the ChallengeResponse for a request to the given server.
+// It fails if the challenge is not a nonce issued by a Server.
+func NewChallengeResponse(challenge string, server string, method string, path string) (ChallengeResponse, error) {
+	if !validChallenge(challenge) {
+		return ChallengeResponse{}, ItCryptoError{Des: "Malformed data: Invalid challenge.", Class: ClassMalformed}
+	}
+	return ChallengeResponse{
+		Type:      ChallengeType,
+		Challenge: challenge,
+		Server:    strings.TrimSuffix(server, "/"),
+		Method:    method,
+		Path:      path,
+	}, nil
+}
+
+// Sign signs the ChallengeResponse and returns the value of the Authorization header.
+func (response ChallengeResponse) Sign(signer user.AuthenticatedUser) (string, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize challenge response", Err: err}
+	}
+	signature, err := signer.SignData(data)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not sign challenge", Err: err}
+	}
+	return "Signature " + base64.RawURLEncoding.EncodeToString([]byte(signature)), nil
+}
+
+// parseChallengeResponse deserializes a signed ChallengeResponse and verifies that it was created for the request.
+func parseChallengeResponse(data []byte, r *http.Request) (ChallengeResponse, error) {
+	var response ChallengeResponse
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&response)
+	if err != nil {
+		return ChallengeResponse{}, ItCryptoError{Des: "Could not deserialize challenge response", Err: err, Class: ClassMalformed}
+	}
+	if response.Type != ChallengeType || !validChallenge(response.Challenge) {
+		return ChallengeResponse{}, ItCryptoError{Des: "Malformed data: Invalid challenge response.", Class: ClassMalformed}
+	}
+
+	server, err := url.Parse(response.Server)
+	if err != nil || server.Host != r.Host || response.Method != r.Method || response.Path != r.URL.Path {
+		return ChallengeResponse{}, ItCryptoError{Des: "Malformed data: Challenge response was created for another request.", Err: err, Class: ClassAuthorization}
+	}
+	return response, nil
+}
+
+// validChallenge checks if the challenge is a base64url-encoded nonce of ChallengeSize bytes.
+func validChallenge(challenge string) bool {
+	nonce, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(nonce) == ChallengeSize
+}
@@ -0,0 +1,179 @@
+package mailbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// Client sends and receives logs via a mailbox Server. It uses the logged-in user of ItCrypto to encrypt and
+// decrypt logs and to authenticate against the server.
+type Client struct {
+	// BaseURL is the URL of the mailbox Server, e.g. https://mailbox.example.com
+	BaseURL string
+	// ItCrypto is used to encrypt, decrypt and sign data.
+	ItCrypto *itcrypto.ItCrypto
+	// HTTPClient is used to send requests. The http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// Submit submits the given JWE token to the mailbox and returns the id of the stored message.
+func (client Client) Submit(jwe string) (string, error) {
+	var response struct {
+		Id string `json:"id"`
+	}
+	err := client.do(http.MethodPost, TokensPath, strings.NewReader(jwe), false, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.Id, nil
+}
+
+// Send encrypts the given log for the given receivers and submits it to the mailbox.
+func (client Client) Send(log logs.SingedLog, receivers []user.RemoteUser) (string, error) {
+	jwe, err := client.ItCrypto.EncryptLog(log, receivers)
+	if err != nil {
+		return "", err
+	}
+	return client.Submit(jwe)
+}
+
+// Pending lists the pending messages of the logged-in user. The returned messages do not contain tokens.
+func (client Client) Pending() ([]Message, error) {
+	var messages []Message
+	err := client.do(http.MethodGet, TokensPath, nil, true, &messages)
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Fetch returns the JWE token of a pending message of the logged-in user.
+func (client Client) Fetch(id string) (string, error) {
+	var message Message
+	err := client.do(http.MethodGet, TokensPath+"/"+url.PathEscape(id), nil, true, &message)
+	if err != nil {
+		return "", err
+	}
+	return message.Token, nil
+}
+
+// Receive fetches a pending message of the logged-in user and decrypts it.
+// The message is not acknowledged, use Ack after the log was processed.
+func (client Client) Receive(id string) (logs.SingedLog, error) {
+	jwe, err := client.Fetch(id)
+	if err != nil {
+		return logs.SingedLog{}, err
+	}
+	return client.ItCrypto.DecryptLog(jwe)
+}
+
+// Ack acknowledges a pending message of the logged-in user, which removes it from the mailbox.
+func (client Client) Ack(id string) error {
+	return client.do(http.MethodDelete, TokensPath+"/"+url.PathEscape(id), nil, true, nil)
+}
+
+// Delegate creates a ReEncryptionKey of the logged-in user for the delegate and uploads it to the mailbox.
+// Afterwards, the mailbox forwards tokens in proxy re-encryption mode, which are submitted for the logged-in user,
+// to the delegate. If lifetime is not zero, the delegate only accepts these tokens within this lifetime.
+func (client Client) Delegate(delegate user.RemoteUser, lifetime time.Duration) error {
+	key, err := client.ItCrypto.NewReEncryptionKey(delegate, lifetime)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		return ItCryptoError{Des: "Could not serialize re-encryption key", Err: err}
+	}
+	return client.do(http.MethodPost, DelegationsPath, bytes.NewReader(data), true, nil)
+}
+
+// Revoke revokes the delegation of the logged-in user to the delegate. Tokens which were already forwarded stay
+// available to the delegate.
+func (client Client) Revoke(delegate string) error {
+	return client.do(http.MethodDelete, DelegationsPath+"/"+url.PathEscape(delegate), nil, true, nil)
+}
+
+// authenticate requests a new challenge and returns the headers which authenticate the logged-in user for a single
+// request with the given method and path.
+func (client Client) authenticate(method string, path string) (http.Header, error) {
+	if client.ItCrypto == nil || client.ItCrypto.User == nil {
+		return nil, ItCryptoError{Des: "Before you can authenticate you need to login a user"}
+	}
+
+	var response struct {
+		Challenge string `json:"challenge"`
+	}
+	err := client.do(http.MethodPost, ChallengesPath, nil, false, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeResponse, err := NewChallengeResponse(response.Challenge, client.BaseURL, method, path)
+	if err != nil {
+		return nil, err
+	}
+	authorization, err := challengeResponse.Sign(*client.ItCrypto.User)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set(UserHeader, client.ItCrypto.User.Id)
+	header.Set("Authorization", authorization)
+	return header, nil
+}
+
+// do sends a request to the mailbox and deserializes the json response into result.
+func (client Client) do(method string, path string, body io.Reader, authenticate bool, result interface{}) error {
+	request, err := http.NewRequest(method, strings.TrimSuffix(client.BaseURL, "/")+path, body)
+	if err != nil {
+		return ItCryptoError{Des: "Could not create request", Err: err}
+	}
+	if authenticate {
+		header, err := client.authenticate(request.Method, request.URL.Path)
+		if err != nil {
+			return err
+		}
+		for key := range header {
+			request.Header.Set(key, header.Get(key))
+		}
+	}
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return ItCryptoError{Des: "Could not request mailbox", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound && strings.HasPrefix(path, TokensPath+"/") {
+		return ErrUnknownMessage
+	}
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return ItCryptoError{Des: fmt.Sprintf("Mailbox responded with status %d: %s", response.StatusCode, bytes.TrimSpace(message))}
+	}
+	if result == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return ItCryptoError{Des: "Could not deserialize mailbox response", Err: err}
+	}
+	return nil
+}
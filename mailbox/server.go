@@ -0,0 +1,372 @@
+package mailbox
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// ChallengesPath is used to request a new challenge.
+	ChallengesPath = "/challenges"
+	// TokensPath is used to submit tokens and to list pending tokens. A single token is available at
+	// TokensPath + "/" + id.
+	TokensPath = "/tokens"
+	// UserHeader holds the id of the user who signed the challenge.
+	UserHeader = "X-Mailbox-User"
+	// ChallengeLifetime is the duration a challenge can be used to authenticate a request.
+	ChallengeLifetime = time.Minute
+	// MaxTokenSize is the maximum size of a submitted token in bytes.
+	MaxTokenSize = 1 << 20
+	// DelegationsPath is used to upload a ReEncryptionKey of the authenticated user. A delegation is revoked at
+	// DelegationsPath + "/" + delegate.
+	DelegationsPath = "/delegations"
+	// DefaultMaxChallenges is the default number of challenges a Server issues within the ChallengeLifetime.
+	DefaultMaxChallenges = 10000
+	// DefaultMaxPendingTokens is the default number of pending tokens a Server stores for a single recipient.
+	DefaultMaxPendingTokens = 1000
+)
+
+// Server is a store-and-forward service for JWE tokens. Tokens are submitted by anybody and stored for each
+// recipient listed in the public header of the token. Recipients authenticate each request by signing a
+// ChallengeResponse with their verification key, which allows them to list, fetch and acknowledge their pending tokens.
+//
+// Recipients can delegate their tokens by uploading a user.ReEncryptionKey, which is persisted in the Store.
+// Tokens in proxy re-encryption mode, which are submitted for the recipient afterwards, are additionally
+// re-encrypted and stored for the delegate.
+// The server can not decrypt the tokens unless it colludes with a delegate (see user.ReEncryptionKey).
+//
+// **NOTE**: The server only reads the unverified metadata of the tokens. Recipients need to decrypt the tokens to
+// verify them. Tokens with hidden recipients can not be routed and are rejected.
+type Server struct {
+	// MaxChallenges is the number of challenges the server issues within the ChallengeLifetime. Further requests
+	// for challenges are rejected until the oldest challenges expired.
+	MaxChallenges int
+	// MaxPendingTokens is the number of pending tokens the server stores for a single recipient. Tokens for
+	// recipients whose mailbox is full are rejected until the recipient acknowledged its tokens.
+	MaxPendingTokens int
+
+	store      Store
+	fetchUser  user.FetchUser
+	mutex      sync.Mutex
+	challenges map[string]time.Time
+	issued     []issuedChallenge
+	storeMutex sync.Mutex
+}
+
+// issuedChallenge is an entry of the queue of issued challenges, which is ordered by expiry.
+type issuedChallenge struct {
+	challenge string
+	expiry    time.Time
+}
+
+// NewServer creates a Server which stores tokens in the given Store and resolves users with fetchUser.
+func NewServer(store Store, fetchUser user.FetchUser) *Server {
+	return &Server{
+		MaxChallenges:    DefaultMaxChallenges,
+		MaxPendingTokens: DefaultMaxPendingTokens,
+		store:            store,
+		fetchUser:        fetchUser,
+		challenges:       map[string]time.Time{},
+	}
+}
+
+// ServeHTTP implements the following endpoints:
+//
+//	POST   /challenges    returns a new challenge
+//	POST   /tokens        submits a token
+//	GET    /tokens        lists the pending tokens of the authenticated user
+//	GET    /tokens/{id}   fetches a pending token of the authenticated user
+//	DELETE /tokens/{id}   acknowledges a pending token of the authenticated user
+//	POST   /delegations   uploads a ReEncryptionKey of the authenticated user
+//	DELETE /delegations/{delegate}   revokes a delegation of the authenticated user
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	switch {
+	case path == ChallengesPath && r.Method == http.MethodPost:
+		server.newChallenge(w)
+	case path == TokensPath && r.Method == http.MethodPost:
+		server.submit(w, r)
+	case path == TokensPath && r.Method == http.MethodGet:
+		server.authenticated(w, r, func(recipient string) {
+			server.list(w, recipient)
+		})
+	case strings.HasPrefix(path, TokensPath+"/") && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		id := strings.TrimPrefix(path, TokensPath+"/")
+		server.authenticated(w, r, func(recipient string) {
+			if r.Method == http.MethodGet {
+				server.fetch(w, recipient, id)
+			} else {
+				server.acknowledge(w, recipient, id)
+			}
+		})
+	case path == DelegationsPath && r.Method == http.MethodPost:
+		server.authenticated(w, r, func(owner string) {
+			server.delegate(w, r, owner)
+		})
+	case strings.HasPrefix(path, DelegationsPath+"/") && r.Method == http.MethodDelete:
+		delegate := strings.TrimPrefix(path, DelegationsPath+"/")
+		server.authenticated(w, r, func(owner string) {
+			server.revoke(w, owner, delegate)
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (server *Server) newChallenge(w http.ResponseWriter) {
+	nonce := make([]byte, ChallengeSize)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		http.Error(w, "Could not generate challenge", http.StatusInternalServerError)
+		return
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(nonce)
+
+	// All challenges have the same lifetime, so the queue is ordered by expiry and only its head needs to be checked.
+	server.mutex.Lock()
+	now := time.Now()
+	expired := 0
+	for expired < len(server.issued) && now.After(server.issued[expired].expiry) {
+		delete(server.challenges, server.issued[expired].challenge)
+		expired++
+	}
+	server.issued = server.issued[expired:]
+	if len(server.issued) >= server.MaxChallenges {
+		server.mutex.Unlock()
+		http.Error(w, "Too many challenges", http.StatusTooManyRequests)
+		return
+	}
+	expiry := now.Add(ChallengeLifetime)
+	server.challenges[challenge] = expiry
+	server.issued = append(server.issued, issuedChallenge{challenge: challenge, expiry: expiry})
+	server.mutex.Unlock()
+
+	writeJson(w, http.StatusOK, map[string]string{"challenge": challenge})
+}
+
+// authenticated verifies the signed ChallengeResponse of the request and calls next with the id of the authenticated
+// user. The response needs to be created for this request and each challenge can only be used once.
+func (server *Server) authenticated(w http.ResponseWriter, r *http.Request, next func(recipient string)) {
+	id := r.Header.Get(UserHeader)
+	rawSignature, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(r.Header.Get("Authorization"), "Signature "))
+	if id == "" || err != nil || len(rawSignature) == 0 {
+		http.Error(w, "Missing signed challenge", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := server.fetchUser(id).VerifyData(string(rawSignature))
+	if err != nil {
+		http.Error(w, "Invalid signed challenge", http.StatusUnauthorized)
+		return
+	}
+	response, err := parseChallengeResponse(data, r)
+	if err != nil {
+		http.Error(w, "Invalid signed challenge", http.StatusUnauthorized)
+		return
+	}
+
+	server.mutex.Lock()
+	expiry, ok := server.challenges[response.Challenge]
+	delete(server.challenges, response.Challenge)
+	server.mutex.Unlock()
+	if !ok || time.Now().After(expiry) {
+		http.Error(w, "Unknown or expired challenge", http.StatusUnauthorized)
+		return
+	}
+
+	next(id)
+}
+
+func (server *Server) submit(w http.ResponseWriter, r *http.Request) {
+	token, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxTokenSize))
+	if err != nil {
+		http.Error(w, "Could not read token", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := user.InspectToken(string(token))
+	if err != nil {
+		http.Error(w, "Could not parse token", http.StatusBadRequest)
+		return
+	}
+	if metadata.RecipientsHidden || len(metadata.Recipients) == 0 {
+		http.Error(w, "Token does not list its recipients", http.StatusBadRequest)
+		return
+	}
+
+	message := Message{
+		Id:        uuid.New().String(),
+		Owner:     metadata.Owner,
+		Submitted: time.Now().Unix(),
+		Token:     string(token),
+	}
+	err = server.put(metadata.Recipients, message)
+	if err == errMailboxFull {
+		http.Error(w, "Mailbox of a recipient is full", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not store token", http.StatusInternalServerError)
+		return
+	}
+
+	// Forward the token to the delegates of its recipients. Tokens which are not in proxy re-encryption mode can
+	// not be re-encrypted and are only stored for their recipients. Delegates whose mailbox is full are skipped.
+	delegations, err := server.delegationsOf(metadata.Recipients)
+	if err != nil {
+		http.Error(w, "Could not read delegations", http.StatusInternalServerError)
+		return
+	}
+	for _, key := range delegations {
+		if slices.Contains(metadata.Recipients, key.Delegate) {
+			continue
+		}
+		reEncrypted, err := user.ReEncrypt(message.Token, key)
+		if err != nil {
+			continue
+		}
+		forwarded := message
+		forwarded.Token = reEncrypted
+		forwarded.Delegator = key.Owner
+		err = server.put([]string{key.Delegate}, forwarded)
+		if err != nil && err != errMailboxFull {
+			http.Error(w, "Could not store token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJson(w, http.StatusCreated, map[string]string{"id": message.Id})
+}
+
+// errMailboxFull is returned by put if a recipient has MaxPendingTokens pending tokens.
+var errMailboxFull = ItCryptoError{Des: "Mailbox is full"}
+
+// put stores the message for all recipients. It fails without storing the message if the mailbox of any recipient
+// is full.
+func (server *Server) put(recipients []string, message Message) error {
+	server.storeMutex.Lock()
+	defer server.storeMutex.Unlock()
+
+	for _, recipient := range recipients {
+		count, err := server.store.Count(recipient)
+		if err != nil {
+			return err
+		}
+		if count >= server.MaxPendingTokens {
+			return errMailboxFull
+		}
+	}
+	for _, recipient := range recipients {
+		err := server.store.Put(recipient, message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delegationsOf returns the ReEncryptionKeys of the given recipients, sorted by recipient and delegate.
+func (server *Server) delegationsOf(recipients []string) ([]user.ReEncryptionKey, error) {
+	var keys []user.ReEncryptionKey
+	for _, recipient := range recipients {
+		delegations, err := server.store.Delegations(recipient)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, delegations...)
+	}
+	return keys, nil
+}
+
+func (server *Server) delegate(w http.ResponseWriter, r *http.Request, owner string) {
+	var key user.ReEncryptionKey
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxTokenSize)).Decode(&key)
+	if err != nil {
+		http.Error(w, "Could not parse re-encryption key", http.StatusBadRequest)
+		return
+	}
+	if key.Owner != owner || key.Delegate == "" || key.Delegate == owner {
+		http.Error(w, "Re-encryption key does not belong to the authenticated user", http.StatusForbidden)
+		return
+	}
+	err = user.VerifyReEncryptionKey(key, server.fetchUser(owner))
+	if err != nil {
+		http.Error(w, "Invalid re-encryption key", http.StatusBadRequest)
+		return
+	}
+
+	err = server.store.PutDelegation(key)
+	if err != nil {
+		http.Error(w, "Could not store re-encryption key", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) revoke(w http.ResponseWriter, owner string, delegate string) {
+	err := server.store.DeleteDelegation(owner, delegate)
+	if err == ErrUnknownDelegation {
+		http.Error(w, "Unknown delegation", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not revoke delegation", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) list(w http.ResponseWriter, recipient string) {
+	messages, err := server.store.List(recipient)
+	if err != nil {
+		http.Error(w, "Could not list tokens", http.StatusInternalServerError)
+		return
+	}
+	for i := range messages {
+		messages[i].Token = ""
+	}
+	writeJson(w, http.StatusOK, messages)
+}
+
+func (server *Server) fetch(w http.ResponseWriter, recipient string, id string) {
+	message, err := server.store.Get(recipient, id)
+	if err == ErrUnknownMessage {
+		http.Error(w, "Unknown token", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not fetch token", http.StatusInternalServerError)
+		return
+	}
+	writeJson(w, http.StatusOK, message)
+}
+
+func (server *Server) acknowledge(w http.ResponseWriter, recipient string, id string) {
+	err := server.store.Delete(recipient, id)
+	if err == ErrUnknownMessage {
+		http.Error(w, "Unknown token", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Could not acknowledge token", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJson(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
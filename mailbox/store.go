@@ -0,0 +1,147 @@
+package mailbox
+
+import (
+	"sort"
+	"sync"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// ErrUnknownMessage is returned by a Store if the requested message does not exist for the recipient.
+var ErrUnknownMessage = ItCryptoError{Des: "Unknown message"}
+
+// ErrUnknownDelegation is returned by a DelegationStore if the requested delegation does not exist.
+var ErrUnknownDelegation = ItCryptoError{Des: "Unknown delegation"}
+
+// Message is a JWE token which was submitted to the mailbox and waits to be fetched by its recipient.
+type Message struct {
+	Id        string `json:"id"`
+	Owner     string `json:"owner"`
+	Submitted int64  `json:"submitted"`
+	Token     string `json:"token,omitempty"`
+	// Delegator is the recipient who delegated the message to the recipient of this copy. It is empty if the
+	// message was submitted for the recipient.
+	Delegator string `json:"delegator,omitempty"`
+}
+
+// Store persists the pending messages and the delegations of all recipients.
+// A message which is stored for multiple recipients needs to be acknowledged by each of them separately.
+type Store interface {
+	DelegationStore
+
+	// Put stores the message for the given recipient.
+	Put(recipient string, message Message) error
+	// List returns all pending messages of the recipient in the order they were stored.
+	List(recipient string) ([]Message, error)
+	// Count returns the number of pending messages of the recipient.
+	Count(recipient string) (int, error)
+	// Get returns a pending message of the recipient.
+	Get(recipient string, id string) (Message, error)
+	// Delete removes a pending message of the recipient.
+	Delete(recipient string, id string) error
+}
+
+// DelegationStore persists the ReEncryptionKeys recipients uploaded to delegate their tokens.
+type DelegationStore interface {
+	// PutDelegation stores the key. It replaces the key of the same owner for the same delegate.
+	PutDelegation(key user.ReEncryptionKey) error
+	// Delegations returns all keys of the owner sorted by delegate.
+	Delegations(owner string) ([]user.ReEncryptionKey, error)
+	// DeleteDelegation removes the key of the owner for the delegate.
+	DeleteDelegation(owner string, delegate string) error
+}
+
+// MemoryStore is a Store which holds all messages and delegations in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mutex       sync.Mutex
+	messages    map[string][]Message
+	delegations map[string]map[string]user.ReEncryptionKey
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{messages: map[string][]Message{}, delegations: map[string]map[string]user.ReEncryptionKey{}}
+}
+
+// Put stores the message for the given recipient.
+func (store *MemoryStore) Put(recipient string, message Message) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.messages[recipient] = append(store.messages[recipient], message)
+	return nil
+}
+
+// List returns all pending messages of the recipient in the order they were stored.
+func (store *MemoryStore) List(recipient string) ([]Message, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return append([]Message{}, store.messages[recipient]...), nil
+}
+
+// Count returns the number of pending messages of the recipient.
+func (store *MemoryStore) Count(recipient string) (int, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return len(store.messages[recipient]), nil
+}
+
+// Get returns a pending message of the recipient.
+func (store *MemoryStore) Get(recipient string, id string) (Message, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, message := range store.messages[recipient] {
+		if message.Id == id {
+			return message, nil
+		}
+	}
+	return Message{}, ErrUnknownMessage
+}
+
+// Delete removes a pending message of the recipient.
+func (store *MemoryStore) Delete(recipient string, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	messages := store.messages[recipient]
+	for i, message := range messages {
+		if message.Id == id {
+			store.messages[recipient] = append(messages[:i:i], messages[i+1:]...)
+			return nil
+		}
+	}
+	return ErrUnknownMessage
+}
+
+// PutDelegation stores the key. It replaces the key of the same owner for the same delegate.
+func (store *MemoryStore) PutDelegation(key user.ReEncryptionKey) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.delegations[key.Owner] == nil {
+		store.delegations[key.Owner] = map[string]user.ReEncryptionKey{}
+	}
+	store.delegations[key.Owner][key.Delegate] = key
+	return nil
+}
+
+// Delegations returns all keys of the owner sorted by delegate.
+func (store *MemoryStore) Delegations(owner string) ([]user.ReEncryptionKey, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var keys []user.ReEncryptionKey
+	for _, key := range store.delegations[owner] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Delegate < keys[j].Delegate })
+	return keys, nil
+}
+
+// DeleteDelegation removes the key of the owner for the delegate.
+func (store *MemoryStore) DeleteDelegation(owner string, delegate string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.delegations[owner][delegate]; !ok {
+		return ErrUnknownDelegation
+	}
+	delete(store.delegations[owner], delegate)
+	return nil
+}
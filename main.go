@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"net/http/httptest"
+
+	"github.com/haggj/go-it-crypto/directory"
 	"github.com/haggj/go-it-crypto/itcrypto"
 	"github.com/haggj/go-it-crypto/logs"
 	"github.com/haggj/go-it-crypto/user"
@@ -33,27 +36,23 @@ KP6IxRk1DYjHS6pYC8tXacYkizyhRANCAAQGyEX9jjRMAdF1wtzwJT2K75knPxbr
 1CuZu227+L1YAxHyxf6wX+CVw5LkGaW0rF8vj0HmMFmZV6ebJqNPq18h
 -----END PRIVATE KEY-----`
 
-func fetchUser(id string) user.RemoteUser {
-	/*
-	   Resolve id to RemoteUser object.
-	   Usually this function requests your API to fetch user keys.
-	*/
-
-	if id == "monitor" {
-		monitor, err := user.ImportRemoteUser("monitor", PubA, PubA, true, PubCa)
-
-		if err == nil {
-			return monitor
-		}
-		panic("Can not import user: " + err.Error())
-	}
-	panic("No user found: " + id)
+// newDirectory publishes the certificates of the monitor. Usually the directory runs as a separate service and
+// serves the entries from a json file or a SQL database, see directory.LoadFileStore and directory.SQLStore.
+func newDirectory() *httptest.Server {
+	return httptest.NewServer(directory.Server{Store: directory.MemoryStore{
+		"monitor": {Id: "monitor", EncryptionCertificate: PubA, VerificationCertificate: PubA, IsMonitor: true},
+	}})
 }
 
 func main() {
 
+	// Users are resolved via the directory, which validates all certificates against the trusted CA.
+	server := newDirectory()
+	defer server.Close()
+	client := directory.Client{BaseURL: server.URL, TrustedCertificate: PubCa, Monitors: []string{"monitor"}}
+
 	// This code initializes the it-crypto library with the private key pubA and secret key privA.
-	itCrypto := itcrypto.ItCrypto{FetchUser: fetchUser}
+	itCrypto := itcrypto.ItCrypto{FetchUser: client.FetchUser()}
 	itCrypto.Login("monitor", PubA, PubA, PrivA, PrivA)
 
 	// The logged-in user can create singed logs.
@@ -0,0 +1,131 @@
+// Package migration re-encrypts archived tokens to new keys of their receiver, e.g. after the receiver rotated its
+// encryption key or when an algorithm is retired. Each token is fully verified before it is migrated and the
+// signatures it contains are preserved. The outcome of each token is listed in a Report.
+package migration
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// Result is the outcome of the migration of a single token.
+type Result struct {
+	// Id identifies the token within the archive.
+	Id string `json:"id"`
+	// Token is the migrated token. It is empty if the migration failed.
+	Token      string `json:"-"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass Class  `json:"errorClass,omitempty"`
+}
+
+// Report lists the outcome of a migration.
+type Report struct {
+	Receiver string   `json:"receiver"`
+	Migrated int      `json:"migrated"`
+	Failed   int      `json:"failed"`
+	Results  []Result `json:"results"`
+}
+
+// Migrator re-encrypts tokens which were encrypted for the Receiver to its NewKeys.
+type Migrator struct {
+	// Receiver holds the keys the archived tokens were encrypted with.
+	Receiver user.AuthenticatedUser
+	// NewKeys holds the certificates the tokens are migrated to. It needs to have the id of the Receiver.
+	NewKeys user.RemoteUser
+	// FetchUser resolves the signers of the tokens.
+	FetchUser user.FetchUser
+	// Options are used to verify the tokens, e.g. their SharingPolicy.
+	Options user.Options
+}
+
+// Migrate migrates a single token.
+func (migrator Migrator) Migrate(id string, jwe string) Result {
+	migrated, err := user.MigrateToken(jwe, migrator.Receiver, migrator.NewKeys, migrator.FetchUser, migrator.Options)
+	if err != nil {
+		return Result{Id: id, Error: err.Error(), ErrorClass: ClassOf(err)}
+	}
+	return Result{Id: id, Token: migrated}
+}
+
+// MigrateAll migrates all given tokens, which are identified by their keys. The results are sorted by id.
+func (migrator Migrator) MigrateAll(tokens map[string]string) Report {
+	var ids []string
+	for id := range tokens {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	report := Report{Receiver: migrator.Receiver.Id}
+	for _, id := range ids {
+		report.add(migrator.Migrate(id, tokens[id]))
+	}
+	return report
+}
+
+// MigrateNDJSON migrates an archive of newline-delimited JSON objects, e.g. the file of a logstore.FileBackend.
+// Each object needs to contain the token in its "token" field and may contain an "id". Objects without id are
+// identified by their line number. All other fields are kept. Objects whose token could not be migrated are
+// written unchanged, such that the archive stays complete and they can be migrated again later.
+func (migrator Migrator) MigrateNDJSON(in io.Reader, out io.Writer) (Report, error) {
+	report := Report{Receiver: migrator.Receiver.Id}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record map[string]json.RawMessage
+		err := json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return report, ItCryptoError{Des: fmt.Sprintf("Could not deserialize line %d of archive", line), Err: err, Class: ClassMalformed}
+		}
+		id := fmt.Sprintf("line %d", line)
+		if rawId, ok := record["id"]; ok {
+			_ = json.Unmarshal(rawId, &id)
+		}
+
+		var jwe string
+		err = json.Unmarshal(record["token"], &jwe)
+		if err != nil {
+			report.add(Result{Id: id, Error: "Record does not contain a token", ErrorClass: ClassMalformed})
+		} else {
+			result := migrator.Migrate(id, jwe)
+			report.add(result)
+			if result.Error == "" {
+				record["token"], err = json.Marshal(result.Token)
+				if err != nil {
+					return report, ItCryptoError{Des: "Could not serialize token", Err: err}
+				}
+			}
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return report, ItCryptoError{Des: "Could not serialize record", Err: err}
+		}
+		_, err = out.Write(append(data, '\n'))
+		if err != nil {
+			return report, ItCryptoError{Des: "Could not write archive", Err: err}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, ItCryptoError{Des: "Could not read archive", Err: err}
+	}
+	return report, nil
+}
+
+func (report *Report) add(result Result) {
+	if result.Error == "" {
+		report.Migrated++
+	} else {
+		report.Failed++
+	}
+	report.Results = append(report.Results, result)
+}
@@ -0,0 +1,154 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the latency histograms.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// Metrics is an Observer which aggregates events into Prometheus-style counters and histograms:
+//
+//	it_crypto_operations_total{operation, outcome, error_class}
+//	it_crypto_operation_duration_seconds{operation}
+//	it_crypto_stage_duration_seconds{operation, stage, outcome}
+//
+// The metrics are exposed in the Prometheus text format by WritePrometheus and ServeHTTP.
+type Metrics struct {
+	buckets    []float64
+	mutex      sync.Mutex
+	counters   map[string]uint64
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewMetrics creates empty metrics. The DefaultBuckets are used if no buckets are provided.
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{buckets: buckets, counters: map[string]uint64{}, histograms: map[string]*histogram{}}
+}
+
+// Observe adds the event to the metrics.
+func (metrics *Metrics) Observe(event Event) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	seconds := event.Duration.Seconds()
+	if event.Stage == "" {
+		metrics.counters[series("it_crypto_operations_total", "operation", event.Operation, "outcome", string(event.Outcome), "error_class", string(event.ErrorClass))]++
+		metrics.observe(series("it_crypto_operation_duration_seconds", "operation", event.Operation), seconds)
+	} else {
+		metrics.observe(series("it_crypto_stage_duration_seconds", "operation", event.Operation, "stage", string(event.Stage), "outcome", string(event.Outcome)), seconds)
+	}
+}
+
+// Count returns the number of operations with the given outcome.
+func (metrics *Metrics) Count(operation string, outcome Outcome) uint64 {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	var count uint64
+	prefix := series("it_crypto_operations_total", "operation", operation, "outcome", string(outcome))
+	prefix = strings.TrimSuffix(prefix, "}") + ","
+	for key, value := range metrics.counters {
+		if strings.HasPrefix(key, prefix) {
+			count += value
+		}
+	}
+	return count
+}
+
+func (metrics *Metrics) observe(key string, value float64) {
+	h, ok := metrics.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(metrics.buckets))}
+		metrics.histograms[key] = h
+	}
+	for i, bound := range metrics.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition format.
+func (metrics *Metrics) WritePrometheus(w io.Writer) error {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	var lines []string
+	for key, value := range metrics.counters {
+		lines = append(lines, fmt.Sprintf("%s %d", key, value))
+	}
+	for key, h := range metrics.histograms {
+		name, labels := splitSeries(key)
+		for i, bound := range metrics.buckets {
+			lines = append(lines, fmt.Sprintf("%s_bucket{%sle=\"%g\"} %d", name, labels, bound, h.counts[i]))
+		}
+		lines = append(lines, fmt.Sprintf("%s_bucket{%sle=\"+Inf\"} %d", name, labels, h.count))
+		lines = append(lines, fmt.Sprintf("%s_sum{%s} %g", name, strings.TrimSuffix(labels, ","), h.sum))
+		lines = append(lines, fmt.Sprintf("%s_count{%s} %d", name, strings.TrimSuffix(labels, ","), h.count))
+	}
+	sort.Strings(lines)
+
+	for _, name := range []string{"it_crypto_operation_duration_seconds", "it_crypto_operations_total", "it_crypto_stage_duration_seconds"} {
+		kind := "histogram"
+		if strings.HasSuffix(name, "_total") {
+			kind = "counter"
+		}
+		_, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if strings.HasPrefix(line, name+"{") || strings.HasPrefix(line, name+"_") {
+				_, err = fmt.Fprintln(w, line)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP exposes the metrics, such that Metrics can be registered as handler of a /metrics endpoint.
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = metrics.WritePrometheus(w)
+}
+
+// series returns the identifier of a time series, e.g. name{key="value"}.
+func series(name string, labels ...string) string {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// splitSeries splits a series into its name and its labels. The labels end with a comma if they are not empty.
+func splitSeries(key string) (string, string) {
+	index := strings.Index(key, "{")
+	labels := strings.TrimSuffix(key[index+1:], "}")
+	if labels != "" {
+		labels += ","
+	}
+	return key[:index], labels
+}
@@ -0,0 +1,116 @@
+// Package observability provides hooks to instrument the cryptographic operations of this library.
+// An Observer receives an Event for each operation and each of its stages, containing the outcome, the class of
+// the error and the latency. Events never contain key material, plaintext or the identities of users.
+//
+// The package contains adapters for structured logging with log/slog (SlogObserver), Prometheus-style metrics
+// (Metrics) and tracing (TraceObserver).
+package observability
+
+import (
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// Stage is a step of an operation.
+type Stage string
+
+const (
+	// StageJweDecrypt decrypts the JWE token with the key of the receiver.
+	StageJweDecrypt Stage = "jwe_decrypt"
+	// StageJweEncrypt encrypts the JWE token for the receivers.
+	StageJweEncrypt Stage = "jwe_encrypt"
+	// StageFetchUser resolves a user with the FetchUser function.
+	StageFetchUser Stage = "fetch_user"
+	// StageVerifySignature verifies the signatures of the SharedLog and the AccessLog.
+	StageVerifySignature Stage = "verify_signature"
+	// StagePolicy evaluates the SharingPolicy.
+	StagePolicy Stage = "policy"
+	// StageSign signs data with the key of the user.
+	StageSign Stage = "sign"
+	// StageTimestamp obtains a trusted timestamp for a signed log.
+	StageTimestamp Stage = "timestamp"
+)
+
+// Outcome is the result of an operation or a stage.
+type Outcome string
+
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// Event describes a finished operation or stage. Stage is empty for the operation itself.
+type Event struct {
+	Operation  string
+	Stage      Stage
+	Start      time.Time
+	Duration   time.Duration
+	Outcome    Outcome
+	ErrorClass Class
+}
+
+// Observer receives the events of instrumented operations. Implementations need to be safe for concurrent use.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc is an adapter to use ordinary functions as Observer.
+type ObserverFunc func(event Event)
+
+// Observe calls fn(event).
+func (fn ObserverFunc) Observe(event Event) {
+	fn(event)
+}
+
+// Observers combines the given observers into a single Observer which forwards all events.
+func Observers(observers ...Observer) Observer {
+	return ObserverFunc(func(event Event) {
+		for _, observer := range observers {
+			observer.Observe(event)
+		}
+	})
+}
+
+// Operation measures an operation and its stages. A nil Operation discards all measurements.
+type Operation struct {
+	observer Observer
+	name     string
+	start    time.Time
+}
+
+// Begin starts the measurement of an operation. It returns nil if observer is nil.
+func Begin(observer Observer, operation string) *Operation {
+	if observer == nil {
+		return nil
+	}
+	return &Operation{observer: observer, name: operation, start: time.Now()}
+}
+
+// Stage starts the measurement of a stage. The returned function finishes the stage with the given error.
+func (operation *Operation) Stage(stage Stage) func(err error) {
+	if operation == nil {
+		return func(error) {}
+	}
+	start := time.Now()
+	return func(err error) {
+		operation.observer.Observe(newEvent(operation.name, stage, start, err))
+	}
+}
+
+// End finishes the operation with the given error.
+func (operation *Operation) End(err error) {
+	if operation == nil {
+		return
+	}
+	operation.observer.Observe(newEvent(operation.name, "", operation.start, err))
+}
+
+func newEvent(operation string, stage Stage, start time.Time, err error) Event {
+	event := Event{Operation: operation, Stage: stage, Start: start, Duration: time.Since(start), Outcome: Success}
+	if err != nil {
+		event.Outcome = Failure
+		event.ErrorClass = ClassOf(err)
+	}
+	return event
+}
@@ -0,0 +1,43 @@
+//go:build go1.21
+
+package observability
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogObserver writes events as structured log records. Stages are logged at debug level, successful operations
+// at info level and failed operations at warn level.
+type SlogObserver struct {
+	// Logger receives the records. The slog.Default logger is used if it is nil.
+	Logger *slog.Logger
+}
+
+// Observe logs the event.
+func (observer SlogObserver) Observe(event Event) {
+	logger := observer.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	level := slog.LevelInfo
+	if event.Stage != "" {
+		level = slog.LevelDebug
+	} else if event.Outcome == Failure {
+		level = slog.LevelWarn
+	}
+
+	attributes := []slog.Attr{
+		slog.String("operation", event.Operation),
+		slog.String("outcome", string(event.Outcome)),
+		slog.Duration("duration", event.Duration),
+	}
+	if event.Stage != "" {
+		attributes = append(attributes, slog.String("stage", string(event.Stage)))
+	}
+	if event.ErrorClass != "" {
+		attributes = append(attributes, slog.String("error_class", string(event.ErrorClass)))
+	}
+	logger.LogAttrs(context.Background(), level, "it-crypto", attributes...)
+}
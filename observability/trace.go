@@ -0,0 +1,48 @@
+package observability
+
+import "time"
+
+// Tracer creates spans. It is implemented by a thin wrapper around a tracing library, e.g. OpenTelemetry:
+//
+//	func (tracer otelTracer) StartSpan(name string, start time.Time) Span {
+//		_, span := tracer.Tracer.Start(context.Background(), name, trace.WithTimestamp(start))
+//		return otelSpan{span}
+//	}
+//
+// where otelSpan maps SetAttribute to span.SetAttributes, SetError to span.SetStatus and End to
+// span.End(trace.WithTimestamp(end)).
+type Tracer interface {
+	StartSpan(name string, start time.Time) Span
+}
+
+// Span is a single span created by a Tracer.
+type Span interface {
+	SetAttribute(key string, value string)
+	SetError(class string)
+	End(end time.Time)
+}
+
+// TraceObserver is an Observer which records each event as span. Spans are named after the operation and stage,
+// e.g. "it-crypto.decrypt" or "it-crypto.decrypt.jwe_decrypt".
+type TraceObserver struct {
+	Tracer Tracer
+}
+
+// Observe records the event as span.
+func (observer TraceObserver) Observe(event Event) {
+	name := "it-crypto." + event.Operation
+	if event.Stage != "" {
+		name += "." + string(event.Stage)
+	}
+
+	span := observer.Tracer.StartSpan(name, event.Start)
+	span.SetAttribute("it_crypto.operation", event.Operation)
+	if event.Stage != "" {
+		span.SetAttribute("it_crypto.stage", string(event.Stage))
+	}
+	span.SetAttribute("it_crypto.outcome", string(event.Outcome))
+	if event.Outcome == Failure {
+		span.SetError(string(event.ErrorClass))
+	}
+	span.End(event.Start.Add(event.Duration))
+}
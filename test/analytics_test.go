@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/haggj/go-it-crypto/analytics"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/stretchr/testify/assert"
+)
+
+func analyticsLogs() []logs.AccessLog {
+	var accessLogs []logs.AccessLog
+	add := func(timestamp int, monitor string, tool string, dataTypes ...string) {
+		accessLogs = append(accessLogs, logs.AccessLog{
+			Monitor:    monitor,
+			Owner:      "owner",
+			Tool:       tool,
+			Timestamp:  timestamp,
+			AccessKind: "Read",
+			DataType:   dataTypes,
+		})
+	}
+	add(0, "hr", "Crm", "Email")
+	add(100, "hr", "Crm", "Email", "Address")
+	add(200, "it", "Mail", "Email")
+	// Burst within the fourth bucket, including a new tool
+	for i := 0; i < 8; i++ {
+		add(300+i, "it", "Mail", "Phone")
+	}
+	add(310, "it", "Export", "Phone")
+	return accessLogs
+}
+
+// Aggregate logs by all dimensions
+func TestAnalyticsSummarize(t *testing.T) {
+	summary := analytics.Summarize(analyticsLogs(), analytics.Config{BucketSize: 100})
+
+	assert.Equal(t, 12, summary.Total)
+	assert.Equal(t, map[string]int{"hr": 2, "it": 10}, summary.ByMonitor)
+	assert.Equal(t, map[string]int{"Crm": 2, "Mail": 9, "Export": 1}, summary.ByTool)
+	assert.Equal(t, map[string]int{"Read": 12}, summary.ByAccessKind)
+	assert.Equal(t, map[string]int{"Email": 3, "Address": 1, "Phone": 9}, summary.ByDataType)
+	assert.Equal(t, []analytics.TimeBucket{{Start: 0, Count: 1}, {Start: 100, Count: 1}, {Start: 200, Count: 1}, {Start: 300, Count: 9}}, summary.ByTime)
+	assert.Equal(t, []string{"Crm", "Export", "Mail"}, summary.Tools())
+
+	// Without known tools only bursts are reported
+	assert.Len(t, summary.Anomalies, 1)
+	assert.Equal(t, analytics.Burst, summary.Anomalies[0].Kind)
+	assert.Equal(t, 300, summary.Anomalies[0].Bucket)
+	assert.Equal(t, 9, summary.Anomalies[0].Count)
+
+	empty := analytics.Summarize(nil, analytics.Config{})
+	assert.Equal(t, 0, empty.Total)
+	assert.Empty(t, empty.ByTime)
+	assert.Empty(t, empty.Anomalies)
+}
+
+// Report tools which did not access data before
+func TestAnalyticsNewTools(t *testing.T) {
+	summary := analytics.Summarize(analyticsLogs(), analytics.Config{BucketSize: 100, KnownTools: []string{"Crm", "Mail"}})
+
+	var newTools []analytics.Anomaly
+	for _, anomaly := range summary.Anomalies {
+		if anomaly.Kind == analytics.NewTool {
+			newTools = append(newTools, anomaly)
+		}
+	}
+	assert.Len(t, newTools, 1)
+	assert.Equal(t, "Export", newTools[0].Tool)
+	assert.Equal(t, 300, newTools[0].Bucket)
+}
+
+// Export summaries as json and csv
+func TestAnalyticsExport(t *testing.T) {
+	summary := analytics.Summarize(analyticsLogs(), analytics.Config{BucketSize: 100})
+
+	var rawJson bytes.Buffer
+	assert.NoError(t, summary.WriteJSON(&rawJson))
+	var decoded analytics.Summary
+	assert.NoError(t, json.Unmarshal(rawJson.Bytes(), &decoded))
+	assert.Equal(t, summary, decoded)
+
+	var rawCsv bytes.Buffer
+	assert.NoError(t, summary.WriteCSV(&rawCsv))
+	lines := strings.Split(strings.TrimSpace(rawCsv.String()), "\n")
+	assert.Equal(t, "dimension,value,count", lines[0])
+	assert.Contains(t, lines, "total,,12")
+	assert.Contains(t, lines, "tool,Mail,9")
+	assert.Contains(t, lines, "dataType,Phone,9")
+	assert.Contains(t, lines, "time,300,9")
+}
+
+// Logs with widely spread timestamps only create buckets which contain logs
+func TestAnalyticsSpreadTimestamps(t *testing.T) {
+	accessLogs := analyticsLogs()
+	for _, timestamp := range []int{math.MinInt, -1, 1700000000000, math.MaxInt} {
+		accessLogs = append(accessLogs, logs.AccessLog{Monitor: "it", Owner: "owner", Tool: "Mail", Timestamp: timestamp, AccessKind: "Read"})
+	}
+
+	summary := analytics.Summarize(accessLogs, analytics.Config{BucketSize: 100, MaxBuckets: 10})
+	assert.Equal(t, 16, summary.Total)
+	assert.Equal(t, []analytics.TimeBucket{
+		{Start: math.MinInt + 8, Count: 1},
+		{Start: -100, Count: 1},
+		{Start: 0, Count: 1},
+		{Start: 100, Count: 1},
+		{Start: 200, Count: 1},
+		{Start: 300, Count: 9},
+		{Start: 1700000000000, Count: 1},
+		{Start: math.MaxInt - 7, Count: 1},
+	}, summary.ByTime)
+
+	// The average is computed over at most MaxBuckets buckets
+	assert.Len(t, summary.Anomalies, 1)
+	assert.Equal(t, 300, summary.Anomalies[0].Bucket)
+	assert.Equal(t, "9 accesses compared to 0.8 on average", summary.Anomalies[0].Description)
+
+	// Without a limit the outliers dominate the average of all other buckets
+	summary = analytics.Summarize(accessLogs, analytics.Config{BucketSize: 100, MaxBuckets: math.MaxInt})
+	assert.Len(t, summary.ByTime, 8)
+	assert.Len(t, summary.Anomalies, 1)
+	assert.Equal(t, "9 accesses compared to 0.0 on average", summary.Anomalies[0].Description)
+
+	// Millisecond timestamps do not allocate buckets for the whole range
+	summary = analytics.Summarize(accessLogs, analytics.Config{BucketSize: 1})
+	assert.Len(t, summary.ByTime, 16)
+}
@@ -0,0 +1,158 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// JSON documents are canonicalized as specified in RFC 8785
+func TestCanonicalize(t *testing.T) {
+	canonical, err := logs.Canonicalize([]byte(`{
+		"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+		"literals": [null, true, false]
+	}`))
+	assert.NoError(t, err, "Failed to canonicalize JSON: %s", err)
+	assert.Equal(t, `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`, string(canonical))
+
+	// Members are sorted by their UTF-16 code units
+	canonical, err = logs.Canonicalize([]byte(`{"\u20ac":1,"\r":2,"\ufb33":3,"1":4,"\ud83d\ude00":5,"\u0080":6,"\u00f6":7}`))
+	assert.NoError(t, err, "Failed to canonicalize JSON: %s", err)
+	assert.Equal(t, "{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001F600\":5,\"\ufb33\":3}", string(canonical))
+
+	numbers := map[string]string{
+		"-0":                    "0",
+		"1e21":                  "1e+21",
+		"1e-7":                  "1e-7",
+		"0.000001":              "0.000001",
+		"-1.5e-9":               "-1.5e-9",
+		"9007199254740992":      "9007199254740992",
+		"295147905179352830000": "295147905179352830000",
+	}
+	for number, expected := range numbers {
+		canonical, err = logs.Canonicalize([]byte(number))
+		assert.NoError(t, err, "Failed to canonicalize %s: %s", number, err)
+		assert.Equal(t, expected, string(canonical))
+	}
+
+	_, err = logs.Canonicalize([]byte(`{"a":1,"a":2}`))
+	assert.Containsf(t, err.Error(), "Could not canonicalize JSON", "")
+	_, err = logs.Canonicalize([]byte(`1e400`))
+	assert.Containsf(t, err.Error(), "Could not canonicalize JSON", "")
+	_, err = logs.Canonicalize([]byte(`{} {}`))
+	assert.Containsf(t, err.Error(), "Could not canonicalize JSON", "")
+}
+
+// Logs can be signed over their canonical JSON form with an unencoded and detachable payload
+func TestCanonicalSignatures(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	witness, err := user.GenerateAuthenticatedUser()
+	witness.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, witness.RemoteUser, owner.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	canonical, err := logs.CanonicalJson(accessLog)
+	assert.NoError(t, err, "Failed to canonicalize log: %s", err)
+
+	// Canonical logs keep the encoded payload
+	signedLog, err := monitor.SignLogWithOptions(accessLog, user.Options{CanonicalJson: true})
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	assert.False(t, logs.JWS(signedLog).Unencoded())
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(canonical), signedLog.Payload)
+
+	// Unencoded logs contain the canonical JSON as payload
+	signedLog, err = monitor.SignLogWithOptions(accessLog, user.Options{UnencodedPayload: true})
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	assert.True(t, logs.JWS(signedLog).Unencoded())
+	assert.Equal(t, string(canonical), signedLog.Payload)
+	extracted, err := signedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, extracted)
+
+	countersignedLog, err := witness.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+	verified, err := user.VerifyLogWithOptions(countersignedLog, fetchUser, user.Options{Threshold: 2})
+	assert.NoError(t, err, "Failed to verify log: %s", err)
+	assert.Len(t, verified.Monitors, 2)
+
+	options := user.Options{CanonicalJson: true, Threshold: 2}
+	cipher, err := monitor.EncryptLogWithOptions(countersignedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	metadata, err := user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.Equal(t, user.Version3, metadata.Version)
+	receivedLog, err := owner.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	assert.Equal(t, countersignedLog, receivedLog)
+
+	// Unencoded logs require version 3
+	legacy := owner.RemoteUser
+	legacy.Versions = []int{user.Version1, user.Version2}
+	_, err = owner.EncryptLog(signedLog, []user.RemoteUser{legacy}, fetchUser)
+	assert.Containsf(t, err.Error(), "Receivers do not support protocol version 3", "")
+	assert.Equal(t, ClassVersion, ClassOf(err))
+}
+
+// Detached logs can be restored from the AccessLog if they were signed over its canonical JSON form
+func TestDetachedLog(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+
+	for _, options := range []user.Options{{UnencodedPayload: true}, {CanonicalJson: true}} {
+		signedLog, err := monitor.SignLogWithOptions(accessLog, options)
+		assert.NoError(t, err, "Failed to sign log: %s", err)
+
+		detached := signedLog.Detach()
+		rawDetached, err := json.Marshal(detached)
+		assert.NoError(t, err)
+		assert.Contains(t, string(rawDetached), `"payload":""`)
+		_, err = detached.Extract()
+		assert.Containsf(t, err.Error(), "Could not decode payload in jwsAccessLog", "")
+		_, err = user.VerifyLog(detached, fetchUser)
+		assert.Error(t, err)
+
+		attached, err := detached.Attach(accessLog)
+		assert.NoError(t, err, "Failed to attach log: %s", err)
+		assert.Equal(t, signedLog, attached)
+		verified, err := user.VerifyLog(attached, fetchUser)
+		assert.NoError(t, err, "Failed to verify log: %s", err)
+		VerifyAccessLogs(t, accessLog, verified.AccessLog)
+
+		// The signature does not cover another AccessLog
+		modified := accessLog
+		modified.Tool = "Other"
+		attached, err = detached.Attach(modified)
+		assert.NoError(t, err, "Failed to attach log: %s", err)
+		_, err = user.VerifyLog(attached, fetchUser)
+		assert.Equal(t, ClassSignature, ClassOf(err))
+	}
+
+	// Logs which are not signed over the canonical JSON form can not be restored
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	attached, err := signedLog.Detach().Attach(accessLog)
+	assert.NoError(t, err, "Failed to attach log: %s", err)
+	_, err = user.VerifyLog(attached, fetchUser)
+	assert.Equal(t, ClassSignature, ClassOf(err))
+}
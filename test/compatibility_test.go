@@ -94,11 +94,14 @@ func TestCompatibilityMultiReceiver(t *testing.T) {
 // Create tokens for compatibility tests
 func TestCreateCompatibilityTokens(t *testing.T) {
 	sender, err := user.ImportAuthenticatedUser("sender", PubA, PubA, PrivA, PrivA)
+	sender.IsMonitor = true
 	assert.NoError(t, err, "Failed to import user: %s", err)
 
 	receiver, err := user.ImportAuthenticatedUser("receiver", PubB, PubB, PrivB, PrivB)
 	assert.NoError(t, err, "Failed to import user: %s", err)
 
+	fetchUser := CreateFetchUser([]user.RemoteUser{sender.RemoteUser, receiver.RemoteUser})
+
 	accessLog := logs.GenerateAccessLog()
 	accessLog.Owner = receiver.Id
 	accessLog.Monitor = sender.Id
@@ -107,10 +110,10 @@ func TestCreateCompatibilityTokens(t *testing.T) {
 	signedLog, err := sender.SignLog(accessLog)
 	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
 
-	goDecryptB, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser})
+	goDecryptB, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
-	goDecryptAB, err := receiver.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser, sender.RemoteUser})
+	goDecryptAB, err := receiver.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser, sender.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
 	fmt.Println(goDecryptB)
@@ -0,0 +1,76 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Two monitors witness an access and the owner requires both signatures
+func TestCountersignature(t *testing.T) {
+	fixture := CreateFixture(t, 2, 0)
+	proxy, application, other, owner, fetchUser := fixture.Monitor, fixture.Monitors[0], fixture.Monitors[1], fixture.Owner, fixture.Fetch
+	accessLog, signedLog := fixture.Log, fixture.SignedLog
+	countersignedLog, err := application.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+
+	// Countersigned logs use the general JSON serialization
+	rawLog, err := json.Marshal(countersignedLog)
+	assert.NoError(t, err)
+	var serialized map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rawLog, &serialized))
+	assert.Len(t, serialized["signatures"], 2)
+	assert.NotContains(t, serialized, "signature")
+
+	options := user.Options{Threshold: 2, Monitors: []string{proxy.Id, application.Id}}
+	jwe, err := proxy.EncryptLogWithOptions(countersignedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	receivedLog, err := owner.DecryptLogWithOptions(jwe, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	// A single signature does not reach the threshold
+	jwe, err = proxy.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = owner.DecryptLogWithOptions(jwe, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+
+	// Signatures of monitors which are not listed do not count towards the threshold
+	witnessedByOther, err := other.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+	_, err = proxy.EncryptLogWithOptions(witnessedByOther, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+	_, err = proxy.EncryptLogWithOptions(witnessedByOther, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{Threshold: 2})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+}
+
+// Countersignatures are only accepted from distinct monitors
+func TestCountersignatureValidation(t *testing.T) {
+	fixture := CreateFixture(t, 1, 0)
+	proxy, application, owner, fetchUser := fixture.Monitor, fixture.Monitors[0], fixture.Owner, fixture.Fetch
+	signedLog := fixture.SignedLog
+
+	_, err := proxy.CountersignLog(signedLog, fetchUser)
+	assert.Containsf(t, err.Error(), "Log is already signed by", "")
+	_, err = owner.CountersignLog(signedLog, fetchUser)
+	assert.Containsf(t, err.Error(), "Only monitors can countersign logs", "")
+
+	// Logs need to be signed by their monitor
+	countersignedLog, err := application.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+	withoutMonitor := logs.SingedLog(logs.JWS(countersignedLog).WithSignatures(logs.JWS(countersignedLog).AllSignatures()[1:]))
+	_, err = application.CountersignLog(withoutMonitor, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+
+	// Tampered countersignatures are rejected
+	signatures := append([]logs.Signature{}, logs.JWS(countersignedLog).AllSignatures()...)
+	signatures[1].Signature = signatures[0].Signature
+	tampered := logs.SingedLog(logs.JWS(countersignedLog).WithSignatures(signatures))
+	_, err = proxy.EncryptLog(tampered, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+}
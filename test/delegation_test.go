@@ -0,0 +1,100 @@
+package test
+
+import (
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Forward a log over multiple hops and verify the provenance chain
+func TestDelegation(t *testing.T) {
+
+	// Setup Users
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	officer, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	auditor, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, officer.RemoteUser, auditor.RemoteUser})
+	options := user.Options{MaxHops: 1}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	// 1. Step: Monitor creates log and encrypts it for owner
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	cipher, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	// 2. Step: Owner shares log with officer
+	cipher, err = owner.EncryptLog(signedLog, []user.RemoteUser{officer.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	delegatedLog, err := officer.DecryptDelegatedLog(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	assert.Equal(t, []string{owner.Id}, delegatedLog.Provenance)
+	assert.Equal(t, 0, delegatedLog.Hops())
+
+	// 3. Step: Officer forwards log to auditor
+	cipher, err = officer.ForwardLog(delegatedLog, []user.RemoteUser{auditor.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to forward log: %s", err)
+
+	delegatedLog, err = auditor.DecryptDelegatedLog(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	assert.Equal(t, []string{owner.Id, officer.Id}, delegatedLog.Provenance)
+	assert.Equal(t, 1, delegatedLog.Hops())
+
+	receivedAccessLog, err := delegatedLog.Log.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	// Forwarded logs can not be decrypted without delegation mode
+	_, err = auditor.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "The log was forwarded more often than allowed", "")
+
+	// Forwarded logs can not exceed the maximum number of hops
+	_, err = auditor.DecryptDelegatedLog(cipher, fetchUser, user.Options{MaxHops: 0})
+	assert.Containsf(t, err.Error(), "The log was forwarded more often than allowed", "")
+
+	_, err = auditor.ForwardLog(delegatedLog, []user.RemoteUser{officer.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Forwarding the log exceeds the maximum number of hops", "")
+}
+
+// Only recipients of a log are allowed to forward it
+func TestDelegationByNonRecipient(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	officer, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	attacker, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, officer.RemoteUser, attacker.RemoteUser})
+	options := user.Options{MaxHops: 2}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	cipher, err := owner.EncryptLog(signedLog, []user.RemoteUser{officer.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	delegatedLog, err := officer.DecryptDelegatedLog(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	_, err = attacker.ForwardLog(delegatedLog, []user.RemoteUser{attacker.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Only recipients of a log are allowed to forward it", "")
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/haggj/go-it-crypto/directory"
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDirectory(t *testing.T) (*httptest.Server, directory.Client) {
+	entries := []directory.Entry{
+		{Id: "monitor", EncryptionCertificate: PubA, VerificationCertificate: PubA, IsMonitor: true},
+		{Id: "owner", EncryptionCertificate: PubA, VerificationCertificate: PubA},
+		{Id: "other", EncryptionCertificate: PubB, VerificationCertificate: PubB, Versions: []int{user.Version1}},
+	}
+	raw, err := json.Marshal(entries)
+	assert.NoError(t, err, "Failed to serialize entries: %s", err)
+	path := filepath.Join(t.TempDir(), "users.json")
+	assert.NoError(t, os.WriteFile(path, raw, 0600))
+
+	store, err := directory.LoadFileStore(path)
+	assert.NoError(t, err, "Failed to load store: %s", err)
+
+	server := httptest.NewServer(directory.Server{Store: store})
+	t.Cleanup(server.Close)
+	return server, directory.Client{BaseURL: server.URL, TrustedCertificate: PubCa, HTTPClient: server.Client()}
+}
+
+// Resolve users via the directory
+func TestDirectoryFetch(t *testing.T) {
+	_, client := newDirectory(t)
+
+	monitor, err := client.Fetch("monitor")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.Equal(t, "monitor", monitor.Id)
+	assert.True(t, monitor.IsMonitor)
+	assert.NotNil(t, monitor.EncryptionCertificate)
+	assert.NotNil(t, monitor.VerificationCertificate)
+
+	_, err = client.Fetch("unknown")
+	assert.Equal(t, directory.ErrUnknownUser, err)
+
+	// Certificates which are not signed by the trusted CA are rejected
+	client.TrustedCertificate = PubA
+	_, err = client.Fetch("other")
+	assert.Containsf(t, err.Error(), "Can not verify encryption certificate", "")
+}
+
+// Use the directory as FetchUser function during decryption
+func TestDirectoryFetchUser(t *testing.T) {
+	_, client := newDirectory(t)
+
+	monitor, err := user.ImportAuthenticatedUser("monitor", PubA, PubA, PrivA, PrivA)
+	assert.NoError(t, err, "Failed to import user: %s", err)
+	monitor.IsMonitor = true
+	owner, err := user.ImportAuthenticatedUser("owner", PubA, PubA, PrivA, PrivA)
+	assert.NoError(t, err, "Failed to import user: %s", err)
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	fetchUser := client.FetchUser()
+	jwe, err := monitor.EncryptLog(signedLog, []user.RemoteUser{fetchUser("owner")}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	receivedLog, err := owner.DecryptLog(jwe, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	// Unknown users can not be used for cryptographic operations
+	unknown := fetchUser("unknown")
+	assert.Equal(t, "unknown", unknown.Id)
+	assert.Nil(t, unknown.VerificationCertificate)
+}
+
+const sqlStoreQuery = "SELECT encryption_certificate, verification_certificate, is_monitor, versions FROM users WHERE id = ?"
+
+// Load directory entries from a SQL database
+func TestDirectorySQLStore(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err, "Failed to open database: %s", err)
+	defer db.Close()
+	store := directory.SQLStore{DB: db}
+	columns := []string{"encryption_certificate", "verification_certificate", "is_monitor", "versions"}
+
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("monitor").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(PubA, PubA, true, nil))
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("other").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(PubB, PubB, false, "[1,2]"))
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("invalid").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(PubB, PubB, false, "1,2"))
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("broken").
+		WillReturnError(errors.New("database is locked"))
+
+	monitor, err := store.Lookup("monitor")
+	assert.NoError(t, err, "Failed to lookup user: %s", err)
+	assert.Equal(t, directory.Entry{Id: "monitor", EncryptionCertificate: PubA, VerificationCertificate: PubA, IsMonitor: true}, monitor)
+
+	other, err := store.Lookup("other")
+	assert.NoError(t, err, "Failed to lookup user: %s", err)
+	assert.False(t, other.IsMonitor)
+	assert.Equal(t, []int{user.Version1, user.Version2}, other.Versions)
+
+	_, err = store.Lookup("unknown")
+	assert.Equal(t, directory.ErrUnknownUser, err)
+	_, err = store.Lookup("invalid")
+	assert.Containsf(t, err.Error(), "Could not deserialize versions of directory entry", "")
+	_, err = store.Lookup("broken")
+	assert.Containsf(t, err.Error(), "Could not query directory database", "")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Serve entries of a SQL database via the directory
+func TestDirectorySQLStoreFetch(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err, "Failed to open database: %s", err)
+	defer db.Close()
+	columns := []string{"encryption_certificate", "verification_certificate", "is_monitor", "versions"}
+	mock.ExpectQuery(sqlStoreQuery).WithArgs("monitor").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(PubA, PubA, true, "[1]"))
+
+	server := httptest.NewServer(directory.Server{Store: directory.SQLStore{DB: db}})
+	defer server.Close()
+	client := directory.Client{BaseURL: server.URL, TrustedCertificate: PubCa, HTTPClient: server.Client()}
+
+	monitor, err := client.Fetch("monitor")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.Equal(t, "monitor", monitor.Id)
+	assert.True(t, monitor.IsMonitor)
+	assert.Equal(t, []int{user.Version1}, monitor.Versions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// issueCertificates creates a certificate authority and PEM-encoded certificates with the given common names.
+func issueCertificates(t *testing.T, names ...string) (string, map[string]string) {
+	encode := func(raw []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: raw}))
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Directory CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rawCa, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	ca, err := x509.ParseCertificate(rawCa)
+	assert.NoError(t, err)
+
+	certificates := map[string]string{}
+	for i, name := range names {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		raw, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		assert.NoError(t, err)
+		certificates[name] = encode(raw)
+	}
+	return encode(rawCa), certificates
+}
+
+// Clients can bind the certificates of an entry to its id and restrict the monitor role
+func TestDirectoryFetchVerifiesEntries(t *testing.T) {
+	ca, certificates := issueCertificates(t, "monitor", "owner")
+	store := directory.MemoryStore{
+		"monitor": {Id: "monitor", EncryptionCertificate: certificates["monitor"], VerificationCertificate: certificates["monitor"], IsMonitor: true},
+		"owner":   {Id: "owner", EncryptionCertificate: certificates["owner"], VerificationCertificate: certificates["owner"], IsMonitor: true},
+		"forged":  {Id: "forged", EncryptionCertificate: certificates["owner"], VerificationCertificate: certificates["owner"]},
+	}
+	server := httptest.NewServer(directory.Server{Store: store})
+	defer server.Close()
+
+	// By default, the directory is trusted to map ids to certificates and to assign the monitor role
+	client := directory.Client{BaseURL: server.URL, TrustedCertificate: ca, HTTPClient: server.Client()}
+	forged, err := client.Fetch("forged")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.Equal(t, "forged", forged.Id)
+	owner, err := client.Fetch("owner")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.True(t, owner.IsMonitor)
+
+	client.VerifySubject = true
+	client.Monitors = []string{"monitor"}
+	monitor, err := client.Fetch("monitor")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.True(t, monitor.IsMonitor)
+
+	_, err = client.Fetch("forged")
+	assert.Containsf(t, err.Error(), "Certificate subject does not match the id of the directory entry", "")
+	assert.Equal(t, ClassCertificate, ClassOf(err))
+	_, err = client.Fetch("owner")
+	assert.Containsf(t, err.Error(), "Directory entry claims the monitor role of an unknown monitor", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Share only selected fields of a log with an auditor
+func TestSelectiveDisclosure(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	auditor, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, auditor.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+	accessLog.Justification = "secret justification"
+
+	// 1. Step: Monitor signs the log in selective disclosure mode and encrypts all disclosures for the owner
+	disclosableLog, err := monitor.SignLogDisclosable(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	assert.Len(t, disclosableLog.Disclosures, len(logs.DisclosableFields))
+
+	payload, err := base64.RawURLEncoding.DecodeString(disclosableLog.Log.Payload)
+	assert.NoError(t, err, "Failed to decode payload: %s", err)
+	assert.NotContains(t, string(payload), accessLog.Justification)
+
+	cipher, err := monitor.EncryptDisclosableLog(disclosableLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	// 2. Step: Owner can see all fields
+	receivedLog, err := owner.DecryptDisclosableLog(cipher, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	// 3. Step: Owner shares the log without the justification
+	revealedLog, err := receivedLog.Reveal("tool", "timestamp", "accessKind", "dataType")
+	assert.NoError(t, err, "Failed to reveal fields: %s", err)
+	cipher, err = owner.EncryptDisclosableLog(revealedLog, []user.RemoteUser{auditor.RemoteUser}, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	// 4. Step: Auditor can see all fields except the justification
+	receivedLog, err = auditor.DecryptDisclosableLog(cipher, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err = receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+
+	expectedAccessLog := accessLog
+	expectedAccessLog.Justification = ""
+	VerifyAccessLogs(t, expectedAccessLog, receivedAccessLog)
+}
+
+// Disclosures which are not signed by the monitor are rejected
+func TestForgedDisclosure(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	auditor, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, auditor.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	disclosableLog, err := monitor.SignLogDisclosable(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	forged, err := logs.NewDisclosure("justification", "forged justification")
+	assert.NoError(t, err, "Failed to create disclosure: %s", err)
+	disclosableLog.Disclosures = append(disclosableLog.Disclosures, forged)
+
+	_, err = owner.EncryptDisclosableLog(disclosableLog, []user.RemoteUser{auditor.RemoteUser}, fetchUser, user.Options{})
+	assert.Containsf(t, err.Error(), "Could not verify disclosures", "")
+
+	sharedLog := logs.SharedLog{Log: disclosableLog.Log, Recipients: []string{auditor.Id}, Creator: owner.Id, Disclosures: []logs.Disclosure{forged}}
+	cipher := EncryptRaw(t, sharedLog, owner, []user.RemoteUser{auditor.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, user.VersionHeader: user.ProtocolVersion, "recipients": []string{auditor.Id}})
+	_, err = auditor.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify disclosures", "")
+}
+
+// Logs which digest their disclosures with other algorithms are rejected
+func TestDisclosureAlgorithm(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+
+	disclosableLog, err := monitor.SignLogDisclosable(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	_, err = disclosableLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+
+	for _, algorithm := range []interface{}{"sha-512", nil, 256} {
+		payload, err := base64.RawURLEncoding.DecodeString(disclosableLog.Log.Payload)
+		assert.NoError(t, err, "Failed to decode payload: %s", err)
+		var fields map[string]interface{}
+		assert.NoError(t, json.Unmarshal(payload, &fields))
+		fields["_sd_alg"] = algorithm
+		payload, err = json.Marshal(fields)
+		assert.NoError(t, err, "Failed to encode payload: %s", err)
+
+		forged := disclosableLog
+		forged.Log.Payload = base64.RawURLEncoding.EncodeToString(payload)
+		_, err = forged.Extract()
+		assert.Containsf(t, err.Error(), "Unsupported disclosure algorithm", "")
+		assert.Equal(t, ClassMalformed, ClassOf(err))
+	}
+}
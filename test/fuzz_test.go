@@ -0,0 +1,169 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/tsa"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/haggj/go-it-crypto/vectors"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// fuzzUsers returns the receiver of the development keyset and a FetchUser function which resolves unknown
+// users to users without certificates instead of panicking.
+func fuzzUsers() (user.AuthenticatedUser, user.FetchUser) {
+	users := []user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser}
+	return publicReceiver, func(id string) user.RemoteUser {
+		for _, u := range users {
+			if u.Id == id {
+				return u
+			}
+		}
+		return user.RemoteUser{Id: id}
+	}
+}
+
+// addVectorTokens seeds the fuzzer with the tokens of the conformance vectors.
+func addVectorTokens(f *testing.F) {
+	corpus, err := vectors.Default()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, vector := range corpus.Vectors {
+		f.Add(vector.Token)
+	}
+}
+
+func FuzzDecrypt(f *testing.F) {
+	addVectorTokens(f)
+	f.Add("")
+	f.Add("{}")
+	f.Add("a.b.c.d.e")
+
+	receiver, fetchUser := fuzzUsers()
+	f.Fuzz(func(t *testing.T, jwe string) {
+		_, _ = receiver.DecryptLog(jwe, fetchUser)
+		_, _ = user.InspectToken(jwe)
+		_, _ = user.TokenDigest(jwe)
+	})
+}
+
+// FuzzDecryptPlaintext encrypts arbitrary plaintexts for the receiver, such that the fuzzer reaches the parsing of
+// the SharedLog and the AccessLog within the token.
+func FuzzDecryptPlaintext(f *testing.F) {
+	receiver, fetchUser := fuzzUsers()
+	corpus, err := vectors.Default()
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, vector := range corpus.Vectors {
+		if vector.Keyset != "development" || vector.Receiver != receiver.Id {
+			continue
+		}
+		object, err := jose.ParseEncrypted(vector.Token)
+		if err != nil {
+			f.Fatal(err)
+		}
+		_, _, plaintext, err := object.DecryptMulti(receiver.DecryptionKey)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(plaintext, `{"owner":"receiver","recipients":["receiver"]}`)
+	}
+	f.Add([]byte(`{"payload":"e30","protected":"e30","signature":""}`), `{"owner":1,"recipients":[1,null]}`)
+
+	f.Fuzz(func(t *testing.T, plaintext []byte, header string) {
+		var headers map[string]interface{}
+		if json.Unmarshal([]byte(header), &headers) != nil {
+			headers = nil
+		}
+		var options jose.EncrypterOptions
+		for key, value := range headers {
+			options.WithHeader(jose.HeaderKey(key), value)
+		}
+		encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: receiver.EncryptionCertificate}, &options)
+		if err != nil {
+			return
+		}
+		jwe, err := encrypter.Encrypt(plaintext)
+		if err != nil {
+			return
+		}
+		_, _ = receiver.DecryptLog(jwe.FullSerialize(), fetchUser)
+	})
+}
+
+func FuzzJwsFromBytes(f *testing.F) {
+	signedLog, err := publicSender.SignLog(logs.GenerateAccessLog())
+	if err != nil {
+		f.Fatal(err)
+	}
+	data, _ := json.Marshal(signedLog)
+	f.Add(data)
+	f.Add([]byte(`{"payload":"","signatures":[]}`))
+	f.Add([]byte(`{"payload":"e30","signatures":[{"protected":"e30","signature":""}]}`))
+	f.Add([]byte(`{"payload":"{}","protected":"eyJiNjQiOmZhbHNlfQ","signature":""}`))
+
+	authority, err := tsa.NewLocalAuthority()
+	if err != nil {
+		f.Fatal(err)
+	}
+	_, fetchUser := fuzzUsers()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		jws, err := logs.JwsFromBytes(data)
+		if err != nil {
+			return
+		}
+		_, _ = jws.ToJsonWebSignature()
+		_ = jws.Digest()
+		_, _ = logs.SingedLog(jws).Extract()
+		_, _ = logs.SingedLog(jws).Attach(logs.GenerateAccessLog())
+		_, _ = user.VerifyLog(logs.SingedLog(jws), fetchUser)
+		_, _ = publicSender.CountersignLog(logs.SingedLog(jws), fetchUser)
+		_, _ = user.VerifyTimestamp(logs.SingedLog(jws), authority.Certificate)
+	})
+}
+
+func FuzzImportRemoteUser(f *testing.F) {
+	f.Add(PubA, PubB, PubCa)
+	f.Add("", "", "")
+	f.Add(PrivA, PrivA, PrivA)
+	f.Add(PubA, PubA, "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----")
+
+	f.Fuzz(func(t *testing.T, encryptionCertificate string, verificationCertificate string, trustedCertificate string) {
+		_, _ = user.ImportRemoteUser("user", encryptionCertificate, verificationCertificate, false, trustedCertificate)
+	})
+}
+
+func FuzzImportAuthenticatedUser(f *testing.F) {
+	f.Add(PubA, PubA, PrivA, PrivA)
+	f.Add("", "", "", "")
+	f.Add(PubA, PubB, PrivB, PubA)
+
+	f.Fuzz(func(t *testing.T, encryptionCertificate string, verificationCertificate string, decryptionKey string, signingKey string) {
+		_, _ = user.ImportAuthenticatedUser("user", encryptionCertificate, verificationCertificate, decryptionKey, signingKey)
+	})
+}
+
+// FuzzCanonicalize checks that the canonical form of a JSON document is stable.
+func FuzzCanonicalize(f *testing.F) {
+	f.Add([]byte(`{"b":[1e21,0.5,-0],"a":"\u20ac\n","\r":null}`))
+	f.Add([]byte(`{"a":1,"a":2}`))
+	f.Add([]byte(`[`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		canonical, err := logs.Canonicalize(data)
+		if err != nil {
+			return
+		}
+		again, err := logs.Canonicalize(canonical)
+		if err != nil {
+			t.Fatalf("Canonical form %s can not be canonicalized: %s", canonical, err)
+		}
+		if string(again) != string(canonical) {
+			t.Fatalf("Canonical form is not stable: %s != %s", again, canonical)
+		}
+	})
+}
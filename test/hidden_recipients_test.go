@@ -0,0 +1,71 @@
+package test
+
+import (
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Share a log without revealing the recipients in the public metadata
+func TestHiddenRecipients(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	receiver, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	noReceiver, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, receiver.RemoteUser, noReceiver.RemoteUser})
+	options := user.Options{HideRecipients: true}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	cipher, err := owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{owner.RemoteUser, receiver.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	// Recipients are not part of the public metadata
+	metadata, err := user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.True(t, metadata.RecipientsHidden)
+	assert.Empty(t, metadata.Recipients)
+	assert.NotContains(t, cipher, receiver.Id)
+
+	// Recipients can still decrypt
+	receivedSingedLog, err := receiver.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err := receivedSingedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	_, err = owner.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// Decrypting users must be listed within the SharedLog
+	sharedLog := logs.SharedLog{Log: signedLog, Recipients: []string{receiver.Id}, Creator: owner.Id}
+	cipher = EncryptRaw(t, sharedLog, owner, []user.RemoteUser{receiver.RemoteUser, noReceiver.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, user.VersionHeader: user.ProtocolVersion, "hiddenRecipients": true})
+	_, err = receiver.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	_, err = noReceiver.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Decrypting user not specified in recipients", "")
+
+	// Permissive policies do not bypass the recipient check
+	allowAll := user.PolicyFunc(func(context user.SharingContext) error { return nil })
+	_, err = noReceiver.DecryptLogWithOptions(cipher, fetchUser, user.Options{Policy: allowAll})
+	assert.Containsf(t, err.Error(), "Decrypting user not specified in recipients", "")
+
+	// Recipients can not be hidden and listed at the same time
+	cipher = EncryptRaw(t, sharedLog, owner, []user.RemoteUser{receiver.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, user.VersionHeader: user.ProtocolVersion, "hiddenRecipients": true, "recipients": []string{noReceiver.Id}})
+	_, err = receiver.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Recipients are hidden and listed in metadata", "")
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Read the metadata of a token without decrypting it
+func TestInspectToken(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	receiver, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, receiver.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	// Single recipient
+	cipher, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	metadata, err := user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.Equal(t, owner.Id, metadata.Owner)
+	assert.Equal(t, []string{owner.Id}, metadata.Recipients)
+	assert.Equal(t, 1, metadata.RecipientCount)
+	assert.Equal(t, "A256GCM", metadata.ContentEncryption)
+	assert.Equal(t, []string{"ECDH-ES+A256KW"}, metadata.KeyAlgorithms)
+
+	// Multiple recipients
+	cipher, err = owner.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser, receiver.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	metadata, err = user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.Equal(t, owner.Id, metadata.Owner)
+	assert.ElementsMatch(t, []string{owner.Id, receiver.Id}, metadata.Recipients)
+	assert.Equal(t, 2, metadata.RecipientCount)
+	assert.Equal(t, []string{"ECDH-ES+A256KW", "ECDH-ES+A256KW"}, metadata.KeyAlgorithms)
+	assert.Equal(t, []string{"", ""}, metadata.KeyIds)
+}
+
+// Read the metadata of tokens created by other libraries
+func TestInspectCompatibilityTokens(t *testing.T) {
+	for _, jwe := range []string{goDecryptAB, jsDecryptAB, pythonDecryptAB} {
+		metadata, err := user.InspectToken(jwe)
+		assert.NoError(t, err, "Failed to inspect token: %s", err)
+		assert.Equal(t, "receiver", metadata.Owner)
+		assert.ElementsMatch(t, []string{"receiver", "sender"}, metadata.Recipients)
+		assert.Equal(t, 2, metadata.RecipientCount)
+	}
+}
+
+// Inspecting malformed tokens fails
+func TestInspectMalformedToken(t *testing.T) {
+	_, err := user.InspectToken("no-jwe")
+	assert.Containsf(t, err.Error(), "Failed to parse JWE", "")
+}
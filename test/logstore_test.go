@@ -0,0 +1,249 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/logstore"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func newLogStore(t *testing.T) (logstore.LogStore, string, Fixture) {
+	fixture := CreateFixture(t, 0, 0)
+	path := filepath.Join(t.TempDir(), "logs.ndjson")
+	store := logstore.LogStore{Backend: logstore.NewFileBackend(path), Verify: logstore.MonitorVerifier(fixture.Fetch)}
+	return store, path, fixture
+}
+
+// Store received logs and query them
+func TestLogStoreQuery(t *testing.T) {
+	store, _, fixture := newLogStore(t)
+	monitor, owner, fetchUser := fixture.Monitor, fixture.Owner, fixture.Fetch
+
+	tools := []string{"Crm", "Crm", "Mail"}
+	for i, tool := range tools {
+		accessLog := logs.GenerateAccessLog()
+		accessLog.Monitor = monitor.Id
+		accessLog.Owner = owner.Id
+		accessLog.Tool = tool
+		accessLog.Timestamp = 10 * (i + 1)
+		if i == 2 {
+			accessLog.DataType = []string{"Phone"}
+		}
+		signedLog, err := monitor.SignLog(accessLog)
+		assert.NoError(t, err, "Failed to sign log: %s", err)
+		jwe, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+		assert.NoError(t, err, "Failed to encrypt log: %s", err)
+		receivedLog, err := owner.DecryptLog(jwe, fetchUser)
+		assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+		record, err := store.Put(receivedLog, jwe)
+		assert.NoError(t, err, "Failed to store log: %s", err)
+		assert.Equal(t, jwe, record.Token)
+	}
+
+	records, err := store.Query(logstore.Query{Owner: owner.Id})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Len(t, records, 3)
+
+	records, err = store.Query(logstore.Query{Owner: owner.Id, Tool: "Crm"})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Len(t, records, 2)
+
+	records, err = store.Query(logstore.Query{Owner: owner.Id, From: 15, To: 30, DataType: "Phone"})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "Mail", records[0].AccessLog.Tool)
+
+	records, err = store.Query(logstore.Query{Owner: monitor.Id})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Empty(t, records)
+
+	_, err = store.Query(logstore.Query{})
+	assert.Containsf(t, err.Error(), "Queries need to specify an owner", "")
+
+	// Export all logs of the owner
+	var buffer bytes.Buffer
+	assert.NoError(t, store.ExportNDJSON(&buffer, logstore.Query{Owner: owner.Id}))
+	scanner := bufio.NewScanner(&buffer)
+	lines := 0
+	for scanner.Scan() {
+		var record logstore.Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.Equal(t, owner.Id, record.AccessLog.Owner)
+		lines++
+	}
+	assert.Equal(t, 3, lines)
+}
+
+// Logs which are not signed by a monitor are rejected
+func TestLogStoreRejectsUnsignedLogs(t *testing.T) {
+	store, _, fixture := newLogStore(t)
+
+	accessLog := fixture.Log
+	accessLog.Monitor = fixture.Owner.Id
+	signedLog, err := fixture.Owner.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	_, err = store.Put(signedLog, "")
+	assert.Containsf(t, err.Error(), "Could not verify log", "")
+}
+
+// Modified logs are detected when they are read
+func TestLogStoreDetectsModification(t *testing.T) {
+	store, path, fixture := newLogStore(t)
+
+	accessLog, signedLog := fixture.Log, fixture.SignedLog
+	_, err := store.Put(signedLog, "")
+	assert.NoError(t, err, "Failed to store log: %s", err)
+
+	tampered := accessLog
+	tampered.Tool = "Other"
+	rawTampered, err := json.Marshal(tampered)
+	assert.NoError(t, err)
+	signedTampered := signedLog
+	signedTampered.Payload = base64.RawURLEncoding.EncodeToString(rawTampered)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data = []byte(strings.Replace(string(data), signedLog.Payload, signedTampered.Payload, 1))
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+
+	_, err = store.Query(logstore.Query{Owner: fixture.Owner.Id})
+	assert.Containsf(t, err.Error(), "Could not verify stored log", "")
+}
+
+// Logs signed in selective disclosure mode are stored with their disclosures, which are verified when they are read
+func TestLogStoreDisclosableLog(t *testing.T) {
+	store, path, fixture := newLogStore(t)
+	monitor, owner, fetchUser := fixture.Monitor, fixture.Owner, fixture.Fetch
+
+	disclosableLog, err := monitor.SignLogDisclosable(fixture.Log)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	jwe, err := monitor.EncryptDisclosableLog(disclosableLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	receivedLog, err := owner.DecryptDisclosableLog(jwe, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	record, err := store.PutDisclosable(receivedLog, jwe)
+	assert.NoError(t, err, "Failed to store log: %s", err)
+	assert.Equal(t, receivedLog.Disclosures, record.Disclosures)
+	VerifyAccessLogs(t, fixture.Log, record.AccessLog)
+
+	// Disclosed fields can be queried
+	records, err := store.Query(logstore.Query{Owner: owner.Id, Tool: fixture.Log.Tool, DataType: fixture.Log.DataType[0]})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Equal(t, []logstore.Record{record}, records)
+
+	// Disclosures which do not belong to the log are detected
+	otherLog, err := monitor.SignLogDisclosable(fixture.Log)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	data = []byte(strings.Replace(string(data), string(receivedLog.Disclosures[0]), string(otherLog.Disclosures[0]), 1))
+	assert.NoError(t, os.WriteFile(path, data, 0600))
+	_, err = store.Query(logstore.Query{Owner: owner.Id})
+	assert.Containsf(t, err.Error(), "Could not verify stored log", "")
+}
+
+// Store logs in a SQL database
+func TestLogStoreSQLBackend(t *testing.T) {
+	fixture := CreateFixture(t, 0, 0)
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err, "Failed to open database: %s", err)
+	defer db.Close()
+	backend := logstore.SQLBackend{DB: db}
+	store := logstore.LogStore{Backend: backend, Verify: logstore.MonitorVerifier(fixture.Fetch)}
+
+	mock.ExpectExec(logstore.SQLSchema).WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, backend.Init())
+
+	// Records are inserted with the indexed fields of their AccessLog
+	rawLog, err := json.Marshal(fixture.SignedLog)
+	assert.NoError(t, err)
+	mock.ExpectExec("INSERT INTO logs (id, owner, monitor, tool, access_kind, timestamp, log, disclosures, token) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), fixture.Owner.Id, fixture.Monitor.Id, fixture.Log.Tool, fixture.Log.AccessKind, fixture.Log.Timestamp, string(rawLog), nil, "token").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	record, err := store.Put(fixture.SignedLog, "token")
+	assert.NoError(t, err, "Failed to store log: %s", err)
+
+	// Queries filter the indexed fields in the database and data types after verifying the records
+	columns := []string{"id", "log", "disclosures", "token"}
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? AND timestamp >= ? AND timestamp <= ? AND tool = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id, 10, 30, fixture.Log.Tool).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(record.Id, string(rawLog), nil, "token"))
+	records, err := store.Query(logstore.Query{Owner: fixture.Owner.Id, From: 10, To: 30, Tool: fixture.Log.Tool})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Equal(t, []logstore.Record{record}, records)
+
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(record.Id, string(rawLog), nil, "token"))
+	records, err = store.Query(logstore.Query{Owner: fixture.Owner.Id, DataType: "Phone"})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Empty(t, records)
+
+	// Modified rows are detected
+	tampered := fixture.Log
+	tampered.Tool = "Other"
+	rawTampered, err := json.Marshal(tampered)
+	assert.NoError(t, err)
+	signedTampered := fixture.SignedLog
+	signedTampered.Payload = base64.RawURLEncoding.EncodeToString(rawTampered)
+	rawSignedTampered, err := json.Marshal(signedTampered)
+	assert.NoError(t, err)
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(record.Id, string(rawSignedTampered), nil, "token"))
+	_, err = store.Query(logstore.Query{Owner: fixture.Owner.Id})
+	assert.Containsf(t, err.Error(), "Could not verify stored log", "")
+
+	// Disclosures are stored in their own column
+	disclosableLog, err := fixture.Monitor.SignLogDisclosable(fixture.Log)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	rawDisclosableLog, err := json.Marshal(disclosableLog.Log)
+	assert.NoError(t, err)
+	rawDisclosures, err := json.Marshal(disclosableLog.Disclosures)
+	assert.NoError(t, err)
+	mock.ExpectExec("INSERT INTO logs (id, owner, monitor, tool, access_kind, timestamp, log, disclosures, token) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs(sqlmock.AnyArg(), fixture.Owner.Id, fixture.Monitor.Id, fixture.Log.Tool, fixture.Log.AccessKind, fixture.Log.Timestamp, string(rawDisclosableLog), string(rawDisclosures), "token").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	disclosableRecord, err := store.PutDisclosable(disclosableLog, "token")
+	assert.NoError(t, err, "Failed to store log: %s", err)
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(disclosableRecord.Id, string(rawDisclosableLog), string(rawDisclosures), "token"))
+	records, err = store.Query(logstore.Query{Owner: fixture.Owner.Id, DataType: fixture.Log.DataType[0]})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Equal(t, []logstore.Record{disclosableRecord}, records)
+
+	// Logs without their disclosures only reveal the monitor and the owner
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(disclosableRecord.Id, string(rawDisclosableLog), nil, "token"))
+	records, err = store.Query(logstore.Query{Owner: fixture.Owner.Id, DataType: fixture.Log.DataType[0]})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Empty(t, records)
+
+	// Database errors are reported
+	mock.ExpectExec("INSERT INTO logs (id, owner, monitor, tool, access_kind, timestamp, log, disclosures, token) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WillReturnError(errors.New("database is locked"))
+	err = backend.Append(record)
+	assert.Containsf(t, err.Error(), "Could not insert log", "")
+	mock.ExpectQuery("SELECT id, log, disclosures, token FROM logs WHERE owner = ? ORDER BY timestamp, id").
+		WithArgs(fixture.Owner.Id).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(record.Id, "invalid", nil, "token"))
+	_, err = backend.Scan(logstore.Query{Owner: fixture.Owner.Id})
+	assert.Containsf(t, err.Error(), "Could not deserialize log", "")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
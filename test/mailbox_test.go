@@ -0,0 +1,321 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/mailbox"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+type mailboxSetup struct {
+	Fixture
+	server *httptest.Server
+}
+
+func newMailbox(t *testing.T) mailboxSetup {
+	fixture := CreateFixture(t, 0, 1)
+	server := httptest.NewServer(mailbox.NewServer(mailbox.NewMemoryStore(), fixture.Fetch))
+	t.Cleanup(server.Close)
+	return mailboxSetup{Fixture: fixture, server: server}
+}
+
+func (setup mailboxSetup) client(authenticatedUser user.AuthenticatedUser) mailbox.Client {
+	return mailbox.Client{
+		BaseURL:    setup.server.URL,
+		ItCrypto:   &itcrypto.ItCrypto{FetchUser: setup.Fetch, User: &authenticatedUser},
+		HTTPClient: setup.server.Client(),
+	}
+}
+
+// Send a log via the mailbox and receive it as its owner
+func TestMailbox(t *testing.T) {
+	setup := newMailbox(t)
+	accessLog, signedLog := setup.Log, setup.SignedLog
+
+	id, err := setup.client(setup.Monitor).Send(signedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+
+	ownerClient := setup.client(setup.Owner)
+	pending, err := ownerClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, id, pending[0].Id)
+	assert.Equal(t, setup.Owner.Id, pending[0].Owner)
+	assert.Empty(t, pending[0].Token)
+
+	receivedLog, err := ownerClient.Receive(id)
+	assert.NoError(t, err, "Failed to receive log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+
+	// Other users can not see the message
+	otherClient := setup.client(setup.Users[0])
+	pending, err = otherClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Empty(t, pending)
+	_, err = otherClient.Fetch(id)
+	assert.Equal(t, mailbox.ErrUnknownMessage, err)
+
+	// Acknowledged messages are removed
+	assert.NoError(t, ownerClient.Ack(id))
+	pending, err = ownerClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Empty(t, pending)
+	assert.Equal(t, mailbox.ErrUnknownMessage, ownerClient.Ack(id))
+}
+
+// Tokens in proxy re-encryption mode are forwarded to the delegates of their recipients
+func TestMailboxDelegation(t *testing.T) {
+	setup := newMailbox(t)
+	accessLog, signedLog := setup.Log, setup.SignedLog
+
+	ownerClient := setup.client(setup.Owner)
+	assert.NoError(t, ownerClient.Delegate(setup.Users[0].RemoteUser, time.Hour))
+
+	monitorClient := setup.client(setup.Monitor)
+	monitorClient.ItCrypto.Options = user.Options{ProxyReEncryption: true}
+	id, err := monitorClient.Send(signedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+
+	// The delegate receives a re-encrypted copy and the owner keeps the original
+	otherClient := setup.client(setup.Users[0])
+	pending, err := otherClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, id, pending[0].Id)
+	assert.Equal(t, setup.Owner.Id, pending[0].Delegator)
+	receivedLog, err := otherClient.Receive(id)
+	assert.NoError(t, err, "Failed to receive log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+	_, err = ownerClient.Receive(id)
+	assert.NoError(t, err, "Failed to receive log: %s", err)
+
+	// Tokens which are not in proxy re-encryption mode are not forwarded
+	_, err = setup.client(setup.Monitor).Send(signedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+	pending, err = otherClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 1)
+
+	// Users can only upload their own keys and revoke their own delegations
+	key, err := setup.Owner.NewReEncryptionKey(setup.Users[0].RemoteUser, 0)
+	assert.NoError(t, err, "Failed to create re-encryption key: %s", err)
+	data, err := json.Marshal(key)
+	assert.NoError(t, err)
+	challenge, err := setup.server.Client().Post(setup.server.URL+mailbox.ChallengesPath, "", nil)
+	assert.NoError(t, err)
+	var body map[string]string
+	assert.NoError(t, json.NewDecoder(challenge.Body).Decode(&body))
+	challenge.Body.Close()
+	challengeResponse, err := mailbox.NewChallengeResponse(body["challenge"], setup.server.URL, http.MethodPost, mailbox.DelegationsPath)
+	assert.NoError(t, err)
+	authorization, err := challengeResponse.Sign(setup.Users[0])
+	assert.NoError(t, err)
+	request, err := http.NewRequest(http.MethodPost, setup.server.URL+mailbox.DelegationsPath, bytes.NewReader(data))
+	assert.NoError(t, err)
+	request.Header.Set(mailbox.UserHeader, setup.Users[0].Id)
+	request.Header.Set("Authorization", authorization)
+	response, err := setup.server.Client().Do(request)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Error(t, otherClient.Revoke(setup.Users[0].Id))
+
+	// Revoked delegations are not used for new tokens
+	assert.NoError(t, ownerClient.Revoke(setup.Users[0].Id))
+	_, err = monitorClient.Send(signedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+	pending, err = otherClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 1)
+	pending, err = ownerClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 3)
+}
+
+// Delegations are persisted in the Store and survive a restart of the server
+func TestMailboxDelegationPersistence(t *testing.T) {
+	fixture := CreateFixture(t, 0, 1)
+	store := mailbox.NewMemoryStore()
+	server := httptest.NewServer(mailbox.NewServer(store, fixture.Fetch))
+	setup := mailboxSetup{Fixture: fixture, server: server}
+	assert.NoError(t, setup.client(setup.Owner).Delegate(setup.Users[0].RemoteUser, time.Hour))
+	server.Close()
+
+	keys, err := store.Delegations(setup.Owner.Id)
+	assert.NoError(t, err, "Failed to read delegations: %s", err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, setup.Users[0].Id, keys[0].Delegate)
+
+	// A new server on the same store forwards tokens to the delegate
+	server = httptest.NewServer(mailbox.NewServer(store, fixture.Fetch))
+	defer server.Close()
+	setup.server = server
+	monitorClient := setup.client(setup.Monitor)
+	monitorClient.ItCrypto.Options = user.Options{ProxyReEncryption: true}
+	id, err := monitorClient.Send(setup.SignedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+	receivedLog, err := setup.client(setup.Users[0]).Receive(id)
+	assert.NoError(t, err, "Failed to receive log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, setup.Log, receivedAccessLog)
+
+	// Revocations are persisted as well
+	assert.NoError(t, setup.client(setup.Owner).Revoke(setup.Users[0].Id))
+	keys, err = store.Delegations(setup.Owner.Id)
+	assert.NoError(t, err, "Failed to read delegations: %s", err)
+	assert.Empty(t, keys)
+	assert.Equal(t, mailbox.ErrUnknownDelegation, store.DeleteDelegation(setup.Owner.Id, setup.Users[0].Id))
+}
+
+// Tokens which do not reveal their recipients can not be routed
+func TestMailboxRejectsHiddenRecipients(t *testing.T) {
+	setup := newMailbox(t)
+	signedLog := setup.SignedLog
+
+	jwe, err := setup.Monitor.EncryptLogWithOptions(signedLog, []user.RemoteUser{setup.Owner.RemoteUser}, setup.Fetch, user.Options{HideRecipients: true})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	_, err = setup.client(setup.Monitor).Submit(jwe)
+	assert.Containsf(t, err.Error(), "Token does not list its recipients", "")
+
+	_, err = setup.client(setup.Monitor).Submit("invalid")
+	assert.Containsf(t, err.Error(), "Could not parse token", "")
+}
+
+// Requests need to be authenticated with a fresh challenge signed by the user
+func TestMailboxAuthentication(t *testing.T) {
+	setup := newMailbox(t)
+
+	challenge := func() string {
+		response, err := setup.server.Client().Post(setup.server.URL+mailbox.ChallengesPath, "", nil)
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(response.Body).Decode(&body))
+		return body["challenge"]
+	}
+	request := func(id string, authorization string) int {
+		request, err := http.NewRequest(http.MethodGet, setup.server.URL+mailbox.TokensPath, nil)
+		assert.NoError(t, err)
+		request.Header.Set(mailbox.UserHeader, id)
+		request.Header.Set("Authorization", authorization)
+		response, err := setup.server.Client().Do(request)
+		assert.NoError(t, err)
+		response.Body.Close()
+		return response.StatusCode
+	}
+	sign := func(signer user.AuthenticatedUser, challengeResponse mailbox.ChallengeResponse) string {
+		authorization, err := challengeResponse.Sign(signer)
+		assert.NoError(t, err)
+		return authorization
+	}
+	list := func(id string, signer user.AuthenticatedUser, challenge string) int {
+		return request(id, sign(signer, mailbox.ChallengeResponse{
+			Type: mailbox.ChallengeType, Challenge: challenge, Server: setup.server.URL, Method: http.MethodGet, Path: mailbox.TokensPath,
+		}))
+	}
+
+	// Valid challenges can only be used once
+	fresh := challenge()
+	assert.Equal(t, http.StatusOK, list(setup.Owner.Id, setup.Owner, fresh))
+	assert.Equal(t, http.StatusUnauthorized, list(setup.Owner.Id, setup.Owner, fresh))
+
+	// Challenges must be issued by the server
+	assert.Equal(t, http.StatusUnauthorized, list(setup.Owner.Id, setup.Owner, "self-made"))
+	_, err := mailbox.NewChallengeResponse("self-made", setup.server.URL, http.MethodGet, mailbox.TokensPath)
+	assert.Containsf(t, err.Error(), "Invalid challenge", "")
+
+	// Challenges must be signed by the claimed user
+	assert.Equal(t, http.StatusUnauthorized, list(setup.Owner.Id, setup.Users[0], challenge()))
+
+	// Challenges must be signed as ChallengeResponse for this request
+	signature, err := setup.Owner.SignData([]byte(challenge()))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, request(setup.Owner.Id, "Signature "+base64.RawURLEncoding.EncodeToString([]byte(signature))))
+	for _, challengeResponse := range []mailbox.ChallengeResponse{
+		{Type: "other", Challenge: challenge(), Server: setup.server.URL, Method: http.MethodGet, Path: mailbox.TokensPath},
+		{Type: mailbox.ChallengeType, Challenge: challenge(), Server: "https://mailbox.example.com", Method: http.MethodGet, Path: mailbox.TokensPath},
+		{Type: mailbox.ChallengeType, Challenge: challenge(), Server: setup.server.URL, Method: http.MethodDelete, Path: mailbox.TokensPath},
+		{Type: mailbox.ChallengeType, Challenge: challenge(), Server: setup.server.URL, Method: http.MethodGet, Path: mailbox.DelegationsPath},
+	} {
+		assert.Equal(t, http.StatusUnauthorized, request(setup.Owner.Id, sign(setup.Owner, challengeResponse)))
+	}
+
+	// Requests without signature are rejected
+	response, err := setup.server.Client().Get(setup.server.URL + mailbox.TokensPath)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+// The server limits the issued challenges and the pending tokens of each recipient
+func TestMailboxLimits(t *testing.T) {
+	fixture := CreateFixture(t, 0, 1)
+	server := mailbox.NewServer(mailbox.NewMemoryStore(), fixture.Fetch)
+	server.MaxChallenges = 2
+	server.MaxPendingTokens = 2
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	setup := mailboxSetup{Fixture: fixture, server: httpServer}
+
+	// Tokens are rejected if the mailbox of the recipient is full
+	monitorClient := setup.client(setup.Monitor)
+	for i := 0; i < 2; i++ {
+		_, err := monitorClient.Send(setup.SignedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+		assert.NoError(t, err, "Failed to send log: %s", err)
+	}
+	_, err := monitorClient.Send(setup.SignedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.Containsf(t, err.Error(), "Mailbox of a recipient is full", "")
+
+	// Acknowledged tokens free the mailbox
+	ownerClient := setup.client(setup.Owner)
+	pending, err := ownerClient.Pending()
+	assert.NoError(t, err, "Failed to list tokens: %s", err)
+	assert.Len(t, pending, 2)
+	assert.NoError(t, ownerClient.Ack(pending[0].Id))
+	_, err = monitorClient.Send(setup.SignedLog, []user.RemoteUser{setup.Owner.RemoteUser})
+	assert.NoError(t, err, "Failed to send log: %s", err)
+
+	// Each authenticated request consumed one challenge, further challenges are rejected until they expired
+	_, err = ownerClient.Pending()
+	assert.Containsf(t, err.Error(), "Too many challenges", "")
+	response, err := httpServer.Client().Post(httpServer.URL+mailbox.ChallengesPath, "", nil)
+	assert.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, response.StatusCode)
+}
+
+// Clients only sign challenges which are nonces issued by a mailbox
+func TestMailboxClientRejectsInvalidChallenge(t *testing.T) {
+	setup := newMailbox(t)
+	signedLog := setup.SignedLog
+	payload, err := base64.RawURLEncoding.DecodeString(signedLog.Payload)
+	assert.NoError(t, err)
+
+	// A malicious server tries to obtain a signature of the payload of a log
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewEncoder(w).Encode(map[string]string{"challenge": string(payload)}))
+	}))
+	defer server.Close()
+	client := setup.client(setup.Owner)
+	client.BaseURL = server.URL
+	client.HTTPClient = server.Client()
+
+	_, err = client.Pending()
+	assert.Containsf(t, err.Error(), "Invalid challenge", "")
+	err = client.Ack("id")
+	assert.Containsf(t, err.Error(), "Invalid challenge", "")
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/logstore"
+	"github.com/haggj/go-it-crypto/migration"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// rotateEncryptionKey returns the given user with a new encryption key.
+func rotateEncryptionKey(t *testing.T, authenticatedUser user.AuthenticatedUser) user.AuthenticatedUser {
+	keys, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	authenticatedUser.EncryptionCertificate = keys.EncryptionCertificate
+	authenticatedUser.DecryptionKey = keys.DecryptionKey
+	return authenticatedUser
+}
+
+// Tokens are re-encrypted to the new key of the receiver without changing their signatures
+func TestMigrateToken(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	friend, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, friend.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	cipher, err := owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{owner.RemoteUser, friend.RemoteUser}, fetchUser, user.Options{HideRecipients: true})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	original, err := owner.DecryptVerifiedLog(cipher, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	rotated := rotateEncryptionKey(t, owner)
+	migrated, err := owner.MigrateToken(cipher, rotated.RemoteUser, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to migrate token: %s", err)
+
+	verified, err := rotated.DecryptVerifiedLog(migrated, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt migrated log: %s", err)
+	assert.Equal(t, original.SharedLog, verified.SharedLog)
+	assert.Equal(t, original.Creator, verified.Creator)
+	assert.Equal(t, original.Headers, verified.Headers)
+	assert.Equal(t, original.Version, verified.Version)
+
+	_, err = owner.DecryptLog(migrated, fetchUser)
+	assert.Containsf(t, err.Error(), "Failed to decrypt JWE", "")
+
+	// Tokens can only be migrated to keys of the same user
+	_, err = owner.MigrateToken(cipher, friend.RemoteUser, fetchUser, user.Options{})
+	assert.Containsf(t, err.Error(), "Tokens can only be migrated to new keys of the same user", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+
+	// Tokens which can not be verified are not migrated
+	unauthorized := monitor.RemoteUser
+	unauthorized.IsMonitor = false
+	_, err = owner.MigrateToken(cipher, rotated.RemoteUser, CreateFetchUser([]user.RemoteUser{unauthorized, owner.RemoteUser, friend.RemoteUser}), user.Options{})
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+	_, err = rotated.MigrateToken(cipher, rotated.RemoteUser, fetchUser, user.Options{})
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	itCrypto := itcrypto.ItCrypto{FetchUser: fetchUser}
+	_, err = itCrypto.MigrateToken(cipher, rotated.RemoteUser)
+	assert.Containsf(t, err.Error(), "Before you can migrate you need to login a user", "")
+	itCrypto.User = &owner
+	migrated, err = itCrypto.MigrateToken(cipher, rotated.RemoteUser)
+	assert.NoError(t, err, "Failed to migrate token: %s", err)
+	_, err = rotated.DecryptLog(migrated, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt migrated log: %s", err)
+}
+
+// Archives of a LogStore are migrated in bulk with a report of all failures
+func TestMigrateArchive(t *testing.T) {
+	store, path, fixture := newLogStore(t)
+	monitor, owner, fetchUser := fixture.Monitor, fixture.Owner, fixture.Fetch
+
+	for i := 0; i < 3; i++ {
+		accessLog := logs.GenerateAccessLog()
+		accessLog.Monitor = monitor.Id
+		accessLog.Owner = owner.Id
+		signedLog, err := monitor.SignLog(accessLog)
+		assert.NoError(t, err, "Failed to sign log: %s", err)
+		cipher, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+		assert.NoError(t, err, "Failed to encrypt log: %s", err)
+		if i == 2 {
+			// Corrupted tokens can not be migrated
+			cipher = cipher[:len(cipher)/2]
+		}
+		_, err = store.Put(signedLog, cipher)
+		assert.NoError(t, err, "Failed to store log: %s", err)
+	}
+
+	rotated := rotateEncryptionKey(t, owner)
+	migrator := migration.Migrator{Receiver: owner, NewKeys: rotated.RemoteUser, FetchUser: fetchUser}
+	archive, err := os.Open(path)
+	assert.NoError(t, err)
+	defer archive.Close()
+	var migrated bytes.Buffer
+	report, err := migrator.MigrateNDJSON(archive, &migrated)
+	assert.NoError(t, err, "Failed to migrate archive: %s", err)
+
+	assert.Equal(t, owner.Id, report.Receiver)
+	assert.Equal(t, 2, report.Migrated)
+	assert.Equal(t, 1, report.Failed)
+	assert.Len(t, report.Results, 3)
+	assert.Equal(t, ClassDecryption, report.Results[2].ErrorClass)
+	rawReport, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(rawReport), "token")
+
+	// The migrated archive can be read by the LogStore and decrypted with the new key
+	migratedPath := filepath.Join(t.TempDir(), "migrated.ndjson")
+	assert.NoError(t, os.WriteFile(migratedPath, migrated.Bytes(), 0600))
+	migratedStore := logstore.LogStore{Backend: logstore.NewFileBackend(migratedPath), Verify: logstore.MonitorVerifier(fetchUser)}
+	records, err := migratedStore.Query(logstore.Query{Owner: owner.Id})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	assert.Len(t, records, 3)
+	for i, record := range records {
+		assert.Equal(t, report.Results[i].Id, record.Id)
+		log, err := rotated.DecryptLog(record.Token, fetchUser)
+		if i == 2 {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err, "Failed to decrypt migrated log: %s", err)
+		assert.Equal(t, record.Log, log)
+		assert.Equal(t, report.Results[i].Token, record.Token)
+	}
+
+	// Archives which are not newline-delimited JSON are rejected
+	_, err = migrator.MigrateNDJSON(bufio.NewReader(bytes.NewBufferString("{}\nno json\n")), &bytes.Buffer{})
+	assert.Containsf(t, err.Error(), "Could not deserialize line 2 of archive", "")
+
+	records, err = store.Query(logstore.Query{Owner: owner.Id})
+	assert.NoError(t, err, "Failed to query logs: %s", err)
+	report = migrator.MigrateAll(map[string]string{"b": "invalid", "a": records[0].Token})
+	assert.Equal(t, 1, report.Migrated)
+	assert.Equal(t, "a", report.Results[0].Id)
+	assert.Equal(t, ClassDecryption, report.Results[1].ErrorClass)
+}
@@ -0,0 +1,97 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Owner objects to a log, the monitor and a data-protection officer receive it and the monitor responds
+func TestObjection(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	officer, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, officer.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	objection, err := owner.CreateObjection(signedLog, "Access was not justified", fetchUser)
+	assert.NoError(t, err, "Failed to create objection: %s", err)
+	jwe, err := owner.EncryptObjection(objection, fetchUser, officer.RemoteUser)
+	assert.NoError(t, err, "Failed to encrypt objection: %s", err)
+
+	for _, receiver := range []user.AuthenticatedUser{monitor, officer} {
+		_, result, err := receiver.DecryptObjection(jwe, fetchUser)
+		assert.NoError(t, err, "Failed to decrypt objection: %s", err)
+		assert.Equal(t, owner.Id, result.Owner)
+		assert.Equal(t, "Access was not justified", result.Reason)
+		assert.Equal(t, logs.JWS(signedLog).Digest(), result.LogDigest)
+	}
+
+	// Monitor responds to the objection
+	response, err := monitor.RespondToObjection(objection, logs.ObjectionAccepted, "Access was revoked", fetchUser)
+	assert.NoError(t, err, "Failed to respond to objection: %s", err)
+	encryptedResponse, err := monitor.EncryptObjectionResponse(response, objection, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt response: %s", err)
+	_, result, err := owner.DecryptObjectionResponse(encryptedResponse, objection, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt response: %s", err)
+	assert.Equal(t, logs.ObjectionAccepted, result.Decision)
+	assert.Equal(t, logs.JWS(objection).Digest(), result.Objection)
+
+	// Responses chain to a single objection
+	otherObjection, err := owner.CreateObjection(signedLog, "Another reason", fetchUser)
+	assert.NoError(t, err, "Failed to create objection: %s", err)
+	_, err = user.VerifyObjectionResponse(response, otherObjection, fetchUser)
+	assert.Containsf(t, err.Error(), "Response does not belong to the objection", "")
+	_, _, err = owner.DecryptObjectionResponse(encryptedResponse, otherObjection, fetchUser)
+	assert.Containsf(t, err.Error(), "Response does not belong to the objection", "")
+
+	// Only the monitor of the log can respond
+	_, err = officer.RespondToObjection(objection, logs.ObjectionRejected, "", fetchUser)
+	assert.Containsf(t, err.Error(), "Only the monitor of a log can respond to objections", "")
+}
+
+// Only the owner of a log can object to it
+func TestObjectionOwner(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	other, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, other.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	_, err = other.CreateObjection(signedLog, "Not my log", fetchUser)
+	assert.Containsf(t, err.Error(), "Only the owner of a log can object to it", "")
+
+	// Objections signed by other users are rejected
+	objection, err := owner.CreateObjection(signedLog, "Reason", fetchUser)
+	assert.NoError(t, err, "Failed to create objection: %s", err)
+	forged := objection
+	forged.Signature = other.Id
+	_, _, err = user.VerifyObjection(forged, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify signature of objection", "")
+
+	// Logs which are not signed by a monitor can not be objected to
+	unsignedLog, err := owner.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	_, err = owner.CreateObjection(unsignedLog, "Reason", fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+}
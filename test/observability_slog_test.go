@@ -0,0 +1,41 @@
+//go:build go1.21
+
+package test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/observability"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Log records neither contain plaintext, key material nor identities
+func TestSlogObserver(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	options := user.Options{Observer: observability.SlogObserver{Logger: logger}}
+	fetchUser := CreateFetchUser([]user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = publicSender.Id
+	accessLog.Owner = publicReceiver.Id
+	accessLog.Justification = "secret justification"
+	signedLog, err := publicSender.SignLogWithOptions(accessLog, options)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	cipher, err := publicSender.EncryptLogWithOptions(signedLog, []user.RemoteUser{publicReceiver.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = publicSender.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.Error(t, err)
+
+	logged := output.String()
+	assert.Contains(t, logged, `"level":"WARN","msg":"it-crypto","operation":"decrypt","outcome":"failure"`)
+	assert.Contains(t, logged, `"stage":"jwe_decrypt","error_class":"decryption"`)
+	assert.NotContains(t, logged, "secret justification")
+	assert.NotContains(t, logged, publicReceiver.Id)
+	assert.NotContains(t, logged, strings.Split(PrivA, "\n")[1])
+}
@@ -0,0 +1,133 @@
+package test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/observability"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	mutex  sync.Mutex
+	events []observability.Event
+}
+
+func (recorder *recorder) Observe(event observability.Event) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.events = append(recorder.events, event)
+}
+
+func (recorder *recorder) stages(operation string) []observability.Stage {
+	var stages []observability.Stage
+	for _, event := range recorder.events {
+		if event.Operation == operation && event.Stage != "" {
+			stages = append(stages, event.Stage)
+		}
+	}
+	return stages
+}
+
+func (recorder *recorder) last() observability.Event {
+	return recorder.events[len(recorder.events)-1]
+}
+
+type span struct {
+	name       string
+	attributes map[string]string
+	error      string
+	ended      bool
+}
+
+type tracer struct {
+	spans []*span
+}
+
+func (tracer *tracer) StartSpan(name string, _ time.Time) observability.Span {
+	s := &span{name: name, attributes: map[string]string{}}
+	tracer.spans = append(tracer.spans, s)
+	return s
+}
+
+func (s *span) SetAttribute(key string, value string) { s.attributes[key] = value }
+func (s *span) SetError(class string)                 { s.error = class }
+func (s *span) End(time.Time)                         { s.ended = true }
+
+// Operations report their stages, outcome and error class
+func TestObserver(t *testing.T) {
+	events := &recorder{}
+	options := user.Options{Observer: events}
+	fetchUser := CreateFetchUser([]user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = publicSender.Id
+	accessLog.Owner = publicReceiver.Id
+	signedLog, err := publicSender.SignLogWithOptions(accessLog, options)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	assert.Equal(t, observability.Event{Operation: "sign", Outcome: observability.Success}, stripTimes(events.last()))
+
+	cipher, err := publicSender.EncryptLogWithOptions(signedLog, []user.RemoteUser{publicReceiver.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	assert.Equal(t, []observability.Stage{observability.StageFetchUser, observability.StageVerifySignature, observability.StagePolicy, observability.StageSign, observability.StageJweEncrypt}, events.stages("encrypt"))
+	assert.Equal(t, observability.Success, events.last().Outcome)
+
+	_, err = publicReceiver.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	assert.Equal(t, []observability.Stage{observability.StageJweDecrypt, observability.StageFetchUser, observability.StageFetchUser, observability.StageVerifySignature, observability.StagePolicy}, events.stages("decrypt"))
+	assert.Equal(t, observability.Event{Operation: "decrypt", Outcome: observability.Success}, stripTimes(events.last()))
+
+	// Failures are reported with their error class
+	_, err = publicSender.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.Error(t, err)
+	assert.Equal(t, observability.Event{Operation: "decrypt", Outcome: observability.Failure, ErrorClass: ClassDecryption}, stripTimes(events.last()))
+	assert.Equal(t, observability.Event{Operation: "decrypt", Stage: observability.StageJweDecrypt, Outcome: observability.Failure, ErrorClass: ClassDecryption}, stripTimes(events.events[len(events.events)-2]))
+}
+
+func stripTimes(event observability.Event) observability.Event {
+	event.Start = time.Time{}
+	event.Duration = 0
+	return event
+}
+
+// Adapters for metrics and tracing
+func TestObserverAdapters(t *testing.T) {
+	metrics := observability.NewMetrics()
+	spans := &tracer{}
+	itCrypto := itcrypto.ItCrypto{
+		FetchUser: CreateFetchUser([]user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser}),
+		Options:   user.Options{Observer: observability.Observers(metrics, observability.TraceObserver{Tracer: spans})},
+	}
+	assert.NoError(t, itCrypto.Login(publicSender.Id, PubA, PubA, PrivA, PrivA))
+	itCrypto.User.IsMonitor = true
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = publicSender.Id
+	accessLog.Owner = publicReceiver.Id
+	signedLog, err := itCrypto.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	cipher, err := itCrypto.EncryptLog(signedLog, []user.RemoteUser{publicReceiver.RemoteUser})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = itCrypto.DecryptLog(cipher)
+	assert.Error(t, err)
+
+	assert.Equal(t, uint64(1), metrics.Count("sign", observability.Success))
+	assert.Equal(t, uint64(1), metrics.Count("encrypt", observability.Success))
+	assert.Equal(t, uint64(1), metrics.Count("decrypt", observability.Failure))
+	var exposition bytes.Buffer
+	assert.NoError(t, metrics.WritePrometheus(&exposition))
+	assert.Contains(t, exposition.String(), "# TYPE it_crypto_operations_total counter")
+	assert.Contains(t, exposition.String(), `it_crypto_operations_total{operation="decrypt",outcome="failure",error_class="decryption"} 1`)
+	assert.Contains(t, exposition.String(), `it_crypto_stage_duration_seconds_count{operation="decrypt",stage="jwe_decrypt",outcome="failure"} 1`)
+
+	last := spans.spans[len(spans.spans)-1]
+	assert.Equal(t, "it-crypto.decrypt", last.name)
+	assert.Equal(t, "decryption", last.error)
+	assert.True(t, last.ended)
+}
@@ -10,9 +10,15 @@ import (
 
 // Generate users and encrypt/decrypt data for single receiver
 func TestPerformance(t *testing.T) {
+	monitor, _ := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
 	sender, _ := user.GenerateAuthenticatedUser()
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser})
+
 	accessLog := logs.GenerateAccessLog()
-	signedLog, _ := sender.SignLog(accessLog)
+	accessLog.Owner = sender.Id
+	accessLog.Monitor = monitor.Id
+	signedLog, _ := monitor.SignLog(accessLog)
 
 	var receivers []user.RemoteUser
 
@@ -21,7 +27,7 @@ func TestPerformance(t *testing.T) {
 		receivers = append(receivers, remoteUser)
 	}
 
-	sender.EncryptLog(signedLog, receivers[:1]) // First encryption is slower than others
+	sender.EncryptLog(signedLog, receivers[:1], fetchUser) // First encryption is slower than others
 
 	iterations := [...]int{1, 2, 3, 5, 10}
 
@@ -30,7 +36,7 @@ func TestPerformance(t *testing.T) {
 		var rounds = 1000
 		for i := 0; i < rounds; i++ {
 			start := time.Now()
-			sender.EncryptLog(signedLog, receivers[:val])
+			sender.EncryptLog(signedLog, receivers[:val], fetchUser)
 			elapsed := time.Since(start)
 			sum += elapsed
 		}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"errors"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/exp/slices"
+	"testing"
+)
+
+// The default policy is enforced during encryption
+func TestDefaultPolicy(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	other, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, other.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	_, err = other.EncryptLog(signedLog, []user.RemoteUser{other.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Only the owner or the monitor of the AccessLog are allowed to share", "")
+
+	_, err = monitor.EncryptLog(signedLog, []user.RemoteUser{other.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Monitors can only share the data with the owner of the log", "")
+}
+
+// Custom policies are evaluated during encryption and decryption
+func TestCustomPolicy(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	member, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	outsider, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, member.RemoteUser, outsider.RemoteUser})
+
+	// Owners may only share with members of their group
+	group := []string{owner.Id, member.Id}
+	groupPolicy := user.PolicyFunc(func(context user.SharingContext) error {
+		if context.SharedLog.Creator != context.AccessLog.Owner {
+			return nil
+		}
+		for _, recipient := range context.Recipients {
+			if !slices.Contains(group, recipient) {
+				return errors.New("Recipient is not a group member")
+			}
+		}
+		return nil
+	})
+	options := user.Options{Policy: user.AllPolicies(user.DefaultPolicy(), groupPolicy)}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	// Sharing with group members is allowed
+	cipher, err := owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{member.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = member.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// Sharing with others is rejected during encryption
+	_, err = owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{outsider.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Recipient is not a group member", "")
+
+	// Sharing with others is rejected during decryption
+	cipher, err = owner.EncryptLog(signedLog, []user.RemoteUser{outsider.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = outsider.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Recipient is not a group member", "")
+}
+
+// Logs with sensitive data types can not be re-shared
+func TestDenyResharingPolicy(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	receiver, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, receiver.RemoteUser})
+	options := user.Options{Policy: user.AllPolicies(user.DefaultPolicy(), user.DenyResharing("HealthData"))}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+	accessLog.DataType = []string{"HealthData"}
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	// Monitor can share the log with the owner
+	cipher, err := monitor.EncryptLogWithOptions(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = owner.DecryptLogWithOptions(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// Owner can not re-share the log
+	_, err = owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{receiver.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Logs containing HealthData must not be re-shared", "")
+}
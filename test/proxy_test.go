@@ -0,0 +1,136 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+type proxySetup struct {
+	Fixture
+	delegate user.AuthenticatedUser
+	other    user.AuthenticatedUser
+	cipher   string
+}
+
+// newProxySetup creates a token which the monitor encrypted for the owner in proxy re-encryption mode.
+func newProxySetup(t *testing.T) proxySetup {
+	setup := proxySetup{Fixture: CreateFixture(t, 0, 2)}
+	setup.delegate, setup.other = setup.Users[0], setup.Users[1]
+	var err error
+	setup.cipher, err = setup.Monitor.EncryptLogWithOptions(setup.SignedLog, []user.RemoteUser{setup.Owner.RemoteUser}, setup.Fetch, user.Options{ProxyReEncryption: true})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	return setup
+}
+
+// A proxy re-encrypts a token of the owner for the delegate without changing its ciphertext
+func TestProxyReEncryption(t *testing.T) {
+	setup := newProxySetup(t)
+
+	// The owner decrypts the token like any other token
+	verified, err := setup.Owner.DecryptVerifiedLog(setup.cipher, setup.Fetch, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	VerifyAccessLogs(t, setup.Log, verified.AccessLog)
+	assert.Equal(t, user.Version4, verified.Version)
+	assert.Equal(t, "dir", verified.KeyAlgorithm)
+	assert.Empty(t, verified.Delegator)
+	assert.NotContains(t, verified.Headers, user.CapsuleHeader)
+
+	key, err := setup.Owner.NewReEncryptionKey(setup.delegate.RemoteUser, time.Hour)
+	assert.NoError(t, err, "Failed to create re-encryption key: %s", err)
+	assert.NoError(t, user.VerifyReEncryptionKey(key, setup.Owner.RemoteUser))
+	assert.NotContains(t, key.String(), key.Key)
+	reEncrypted, err := user.ReEncrypt(setup.cipher, key)
+	assert.NoError(t, err, "Failed to re-encrypt token: %s", err)
+
+	originalDigest, err := user.TokenDigest(setup.cipher)
+	assert.NoError(t, err, "Failed to digest token: %s", err)
+	reEncryptedDigest, err := user.TokenDigest(reEncrypted)
+	assert.NoError(t, err, "Failed to digest token: %s", err)
+	assert.Equal(t, originalDigest, reEncryptedDigest)
+
+	// The delegate decrypts the re-encrypted token with the authorization of the owner
+	delegated, err := setup.delegate.DecryptVerifiedLog(reEncrypted, setup.Fetch, user.Options{})
+	assert.NoError(t, err, "Failed to decrypt re-encrypted log: %s", err)
+	VerifyAccessLogs(t, setup.Log, delegated.AccessLog)
+	assert.Equal(t, setup.Owner.Id, delegated.Delegator)
+	assert.True(t, delegated.Passed(user.CheckReEncryptionGrant))
+	assert.Equal(t, verified.SharedLog, delegated.SharedLog)
+
+	// The policy is evaluated for the owner who issued the key
+	var context user.SharingContext
+	_, err = setup.delegate.DecryptLogWithOptions(reEncrypted, setup.Fetch, user.Options{Policy: user.PolicyFunc(func(c user.SharingContext) error {
+		context = c
+		return nil
+	})})
+	assert.NoError(t, err, "Failed to decrypt re-encrypted log: %s", err)
+	assert.Equal(t, setup.Owner.Id, context.Receiver)
+	assert.Equal(t, setup.delegate.Id, context.Delegate)
+
+	// Neither the owner nor other users can decrypt the re-encrypted token
+	_, err = setup.Owner.DecryptLog(reEncrypted, setup.Fetch)
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+	_, err = setup.other.DecryptLog(reEncrypted, setup.Fetch)
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	// Re-encrypted tokens can not be re-encrypted again or migrated
+	_, err = user.ReEncrypt(reEncrypted, key)
+	assert.Containsf(t, err.Error(), "Token was already re-encrypted.", "")
+	_, err = setup.delegate.MigrateToken(reEncrypted, rotateEncryptionKey(t, setup.delegate).RemoteUser, setup.Fetch, user.Options{})
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+}
+
+// Tokens are only re-encrypted and accepted with a valid grant of a recipient
+func TestProxyReEncryptionInvalid(t *testing.T) {
+	setup := newProxySetup(t)
+
+	// Only tokens for a single, visible receiver can be re-encrypted
+	signedLog := setup.SignedLog
+	_, err := setup.Owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{setup.Owner.RemoteUser, setup.other.RemoteUser}, setup.Fetch, user.Options{ProxyReEncryption: true})
+	assert.Containsf(t, err.Error(), "Proxy re-encryption requires a single receiver", "")
+	_, err = setup.Monitor.EncryptLogWithOptions(signedLog, []user.RemoteUser{setup.Owner.RemoteUser}, setup.Fetch, user.Options{ProxyReEncryption: true, HideRecipients: true})
+	assert.Containsf(t, err.Error(), "Proxy re-encryption requires a single receiver", "")
+
+	key, err := setup.Owner.NewReEncryptionKey(setup.delegate.RemoteUser, 0)
+	assert.NoError(t, err, "Failed to create re-encryption key: %s", err)
+
+	// Tokens which are not in proxy re-encryption mode
+	cipher, err := setup.Monitor.EncryptLog(signedLog, []user.RemoteUser{setup.Owner.RemoteUser}, setup.Fetch)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = user.ReEncrypt(cipher, key)
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+
+	// Keys of other users
+	otherKey, err := setup.other.NewReEncryptionKey(setup.delegate.RemoteUser, 0)
+	assert.NoError(t, err, "Failed to create re-encryption key: %s", err)
+	_, err = user.ReEncrypt(setup.cipher, otherKey)
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+	assert.Error(t, user.VerifyReEncryptionKey(otherKey, setup.Owner.RemoteUser))
+
+	// A forged grant does not match the key
+	forged := key
+	forged.Grant = otherKey.Grant
+	assert.Equal(t, ClassSignature, ClassOf(user.VerifyReEncryptionKey(forged, setup.Owner.RemoteUser)))
+	reEncrypted, err := user.ReEncrypt(setup.cipher, user.ReEncryptionKey{Owner: setup.Owner.Id, Delegate: setup.delegate.Id, Key: key.Key, Precursor: key.Precursor, Grant: otherKey.Grant})
+	assert.NoError(t, err, "Failed to re-encrypt token: %s", err)
+	_, err = setup.delegate.DecryptLog(reEncrypted, setup.Fetch)
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+
+	// Keys for other delegates
+	reEncrypted, err = user.ReEncrypt(setup.cipher, key)
+	assert.NoError(t, err, "Failed to re-encrypt token: %s", err)
+	_, err = setup.other.DecryptLog(reEncrypted, setup.Fetch)
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	// Expired grants
+	expiredKey, err := setup.Owner.NewReEncryptionKey(setup.delegate.RemoteUser, -time.Minute)
+	assert.NoError(t, err, "Failed to create re-encryption key: %s", err)
+	assert.Equal(t, ClassAuthorization, ClassOf(user.VerifyReEncryptionKey(expiredKey, setup.Owner.RemoteUser)))
+	reEncrypted, err = user.ReEncrypt(setup.cipher, expiredKey)
+	assert.NoError(t, err, "Failed to re-encrypt token: %s", err)
+	_, err = setup.delegate.DecryptLog(reEncrypted, setup.Fetch)
+	assert.Containsf(t, err.Error(), "Re-encryption grant expired.", "")
+}
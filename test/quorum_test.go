@@ -0,0 +1,176 @@
+package test
+
+import (
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+type quorumSetup struct {
+	Fixture
+	auditors []user.AuthenticatedUser
+	other    user.AuthenticatedUser
+}
+
+func newQuorumSetup(t *testing.T) quorumSetup {
+	setup := quorumSetup{Fixture: CreateFixture(t, 0, 4)}
+	setup.other, setup.auditors = setup.Users[0], setup.Users[1:]
+	return setup
+}
+
+func (setup quorumSetup) auditorKeys() []user.RemoteUser {
+	var receivers []user.RemoteUser
+	for _, auditor := range setup.auditors {
+		receivers = append(receivers, auditor.RemoteUser)
+	}
+	return receivers
+}
+
+// A log shared with a quorum of 2-of-3 auditors can only be decrypted with two partial decryptions
+func TestQuorumDecryption(t *testing.T) {
+	setup := newQuorumSetup(t)
+	cipher, err := setup.Owner.EncryptLogWithOptions(setup.SignedLog, setup.auditorKeys(), setup.Fetch, user.Options{Quorum: 2})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	combiner := setup.auditors[0]
+
+	// A single auditor can not decrypt the token
+	_, err = combiner.DecryptLog(cipher, setup.Fetch)
+	assert.Containsf(t, err.Error(), "Token requires a quorum of recipients.", "")
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	var partials []string
+	for _, auditor := range setup.auditors {
+		partial, err := auditor.PartialDecrypt(cipher, combiner.RemoteUser)
+		assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+		partials = append(partials, partial)
+	}
+
+	verified, err := combiner.CombineDecrypt(cipher, partials[:2], setup.Fetch, user.Options{})
+	assert.NoError(t, err, "Failed to combine partial decryptions: %s", err)
+	VerifyAccessLogs(t, setup.Log, verified.AccessLog)
+	assert.Equal(t, []string{setup.auditors[0].Id, setup.auditors[1].Id}, verified.Quorum)
+	assert.Equal(t, 2, verified.SharedLog.Quorum)
+	assert.Equal(t, user.Version5, verified.Version)
+	assert.True(t, verified.Passed(user.CheckQuorum))
+	assert.True(t, verified.Passed(user.CheckOwner))
+	assert.True(t, verified.Passed(user.CheckRecipients))
+	assert.NotContains(t, verified.Headers, user.SharesHeader)
+	assert.Equal(t, float64(2), verified.Headers[user.QuorumHeader])
+
+	// Any two auditors form a quorum
+	verified, err = combiner.CombineDecrypt(cipher, partials[1:], setup.Fetch, user.Options{})
+	assert.NoError(t, err, "Failed to combine partial decryptions: %s", err)
+	VerifyAccessLogs(t, setup.Log, verified.AccessLog)
+	verified, err = combiner.CombineDecrypt(cipher, partials, setup.Fetch, user.Options{})
+	assert.NoError(t, err, "Failed to combine partial decryptions: %s", err)
+	assert.Len(t, verified.Quorum, 3)
+
+	// The combiner needs to be a recipient
+	partial, err := setup.auditors[1].PartialDecrypt(cipher, setup.other.RemoteUser)
+	assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+	otherPartial, err := setup.auditors[2].PartialDecrypt(cipher, setup.other.RemoteUser)
+	assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+	_, err = setup.other.CombineDecrypt(cipher, []string{partial, otherPartial}, setup.Fetch, user.Options{})
+	assert.Containsf(t, err.Error(), "Decrypting user not specified in recipients!", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+}
+
+// Partial decryptions need to be created for the token and the combiner by distinct recipients
+func TestQuorumDecryptionInvalid(t *testing.T) {
+	setup := newQuorumSetup(t)
+	cipher, err := setup.Owner.EncryptLogWithOptions(setup.SignedLog, setup.auditorKeys(), setup.Fetch, user.Options{Quorum: 2})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	combiner := setup.auditors[0]
+	first, err := setup.auditors[0].PartialDecrypt(cipher, combiner.RemoteUser)
+	assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+
+	// Not enough partial decryptions
+	_, err = combiner.CombineDecrypt(cipher, []string{first}, setup.Fetch, user.Options{})
+	assert.Containsf(t, err.Error(), "Token requires the partial decryptions of 2 recipients, but only 1 were provided.", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+	_, err = combiner.CombineDecrypt(cipher, []string{first, first}, setup.Fetch, user.Options{})
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+
+	// Users who are not recipients do not have a share
+	_, err = setup.other.PartialDecrypt(cipher, combiner.RemoteUser)
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	// Partial decryptions of other tokens
+	otherCipher, err := setup.Owner.EncryptLogWithOptions(setup.SignedLog, setup.auditorKeys(), setup.Fetch, user.Options{Quorum: 2})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	foreign, err := setup.auditors[1].PartialDecrypt(otherCipher, combiner.RemoteUser)
+	assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+	_, err = combiner.CombineDecrypt(cipher, []string{first, foreign}, setup.Fetch, user.Options{})
+	assert.Containsf(t, err.Error(), "Partial decryption does not belong to the token.", "")
+
+	// Partial decryptions for other combiners
+	second, err := setup.auditors[1].PartialDecrypt(cipher, setup.auditors[2].RemoteUser)
+	assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+	_, err = combiner.CombineDecrypt(cipher, []string{first, second}, setup.Fetch, user.Options{})
+	assert.Equal(t, ClassDecryption, ClassOf(err))
+
+	// Tokens which do not require a quorum
+	plain, err := setup.Owner.EncryptLog(setup.SignedLog, setup.auditorKeys(), setup.Fetch)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = setup.auditors[0].PartialDecrypt(plain, combiner.RemoteUser)
+	assert.Containsf(t, err.Error(), "Token does not require a quorum", "")
+	_, err = combiner.CombineDecrypt(plain, []string{first}, setup.Fetch, user.Options{})
+	assert.Containsf(t, err.Error(), "Token does not require a quorum", "")
+
+	// Logs which require a quorum can not be shared in tokens which can be decrypted by a single recipient
+	sharedLog := logs.SharedLog{Log: setup.SignedLog, Recipients: []string{combiner.Id}, Creator: setup.Owner.Id, Quorum: 2}
+	raw := EncryptRaw(t, sharedLog, setup.Owner, []user.RemoteUser{combiner.RemoteUser},
+		map[string]interface{}{"owner": setup.Owner.Id, "recipients": []string{combiner.Id}, user.VersionHeader: user.Version5})
+	_, err = combiner.DecryptLog(raw, setup.Fetch)
+	assert.Containsf(t, err.Error(), "The specified quorums are not equal!", "")
+	raw = EncryptRaw(t, sharedLog, setup.Owner, []user.RemoteUser{combiner.RemoteUser},
+		map[string]interface{}{"owner": setup.Owner.Id, "recipients": []string{combiner.Id}, user.VersionHeader: user.Version5, user.QuorumHeader: 2})
+	_, err = combiner.DecryptLog(raw, setup.Fetch)
+	assert.Containsf(t, err.Error(), "Log requires the partial decryptions of 2 recipients.", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+
+	// The quorum can not exceed the number of receivers
+	_, err = setup.Owner.EncryptLogWithOptions(setup.SignedLog, setup.auditorKeys(), setup.Fetch, user.Options{Quorum: 4})
+	assert.Containsf(t, err.Error(), "Quorum needs to be between 1 and the number of receivers", "")
+}
+
+// Logs with sensitive data types can be restricted to quorum decryption
+func TestRequireQuorumPolicy(t *testing.T) {
+	setup := newQuorumSetup(t)
+	options := user.Options{Policy: user.AllPolicies(user.DefaultPolicy(), user.RequireQuorum(2, "HealthData"))}
+	accessLog := setup.Log
+	accessLog.DataType = []string{"HealthData"}
+	signedLog, err := setup.Monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	// The monitor can share the log with the owner
+	cipher, err := setup.Monitor.EncryptLogWithOptions(signedLog, []user.RemoteUser{setup.Owner.RemoteUser}, setup.Fetch, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = setup.Owner.DecryptLogWithOptions(cipher, setup.Fetch, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// The owner can only share it with a quorum
+	_, err = setup.Owner.EncryptLogWithOptions(signedLog, setup.auditorKeys(), setup.Fetch, options)
+	assert.Containsf(t, err.Error(), "Logs containing HealthData require a quorum of 2 recipients.", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+
+	options.Quorum = 2
+	cipher, err = setup.Owner.EncryptLogWithOptions(signedLog, setup.auditorKeys(), setup.Fetch, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	var partials []string
+	for _, auditor := range setup.auditors[1:] {
+		partial, err := auditor.PartialDecrypt(cipher, setup.auditors[0].RemoteUser)
+		assert.NoError(t, err, "Failed to decrypt partially: %s", err)
+		partials = append(partials, partial)
+	}
+	_, err = setup.auditors[0].CombineDecrypt(cipher, partials, setup.Fetch, options)
+	assert.NoError(t, err, "Failed to combine partial decryptions: %s", err)
+
+	// Logs without sensitive data types are not affected
+	options.Quorum = 0
+	_, err = setup.Owner.EncryptLogWithOptions(setup.SignedLog, setup.auditorKeys(), setup.Fetch, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+}
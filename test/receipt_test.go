@@ -0,0 +1,87 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// Acknowledge a shared log with a receipt which is sent back to the sharer
+func TestReceipt(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	auditor, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, auditor.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	jwe, err := owner.EncryptLog(signedLog, []user.RemoteUser{auditor.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	// Auditor creates a receipt for the token
+	receipt, err := auditor.CreateReceipt(jwe, fetchUser, user.Options{})
+	assert.NoError(t, err, "Failed to create receipt: %s", err)
+	result, err := user.VerifyReceipt(receipt, jwe, auditor.RemoteUser)
+	assert.NoError(t, err, "Failed to verify receipt: %s", err)
+	assert.Equal(t, auditor.Id, result.Recipient)
+	assert.Equal(t, owner.Id, result.Sharer)
+	assert.NotZero(t, result.Timestamp)
+
+	// Owner receives the receipt and verifies it belongs to the shared token
+	encryptedReceipt, err := auditor.EncryptReceipt(receipt, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt receipt: %s", err)
+	receivedReceipt, receivedResult, err := owner.DecryptReceipt(encryptedReceipt, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt receipt: %s", err)
+	assert.Equal(t, result, receivedResult)
+	_, err = user.VerifyReceipt(receivedReceipt, jwe, auditor.RemoteUser)
+	assert.NoError(t, err, "Failed to verify receipt: %s", err)
+
+	// Receipts can not be attributed to other users or tokens
+	_, err = user.VerifyReceipt(receipt, jwe, owner.RemoteUser)
+	assert.Containsf(t, err.Error(), "Could not verify signature of receipt", "")
+	otherJwe, err := owner.EncryptLog(signedLog, []user.RemoteUser{auditor.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = user.VerifyReceipt(receipt, otherJwe, auditor.RemoteUser)
+	assert.Containsf(t, err.Error(), "Receipt does not belong to the token", "")
+
+	// Tokens which can not be decrypted can not be acknowledged
+	_, err = owner.CreateReceipt(jwe, fetchUser, user.Options{})
+	assert.Containsf(t, err.Error(), "Failed to decrypt JWE", "")
+
+	// Shared logs are not accepted as receipts
+	_, _, err = auditor.DecryptReceipt(jwe, fetchUser)
+	assert.Containsf(t, err.Error(), "Token does not contain a receipt", "")
+}
+
+// The digest of a token does not depend on its serialization
+func TestTokenDigest(t *testing.T) {
+	receiver, err := user.GenerateRemoteUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: receiver.EncryptionCertificate}, nil)
+	assert.NoError(t, err)
+	object, err := encrypter.Encrypt([]byte("data"))
+	assert.NoError(t, err)
+	compact, err := object.CompactSerialize()
+	assert.NoError(t, err)
+
+	compactDigest, err := user.TokenDigest(compact)
+	assert.NoError(t, err, "Failed to compute digest: %s", err)
+	fullDigest, err := user.TokenDigest(object.FullSerialize())
+	assert.NoError(t, err, "Failed to compute digest: %s", err)
+	assert.Equal(t, compactDigest, fullDigest)
+
+	_, err = user.TokenDigest("invalid")
+	assert.Containsf(t, err.Error(), "Failed to parse JWE", "")
+}
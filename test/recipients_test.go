@@ -0,0 +1,81 @@
+package test
+
+import (
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// Recipients are deduplicated and sorted during encryption
+func TestNormalizeRecipients(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	receiver, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, receiver.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	cipher, err := owner.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser, owner.RemoteUser, receiver.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+
+	expected := []string{owner.Id, receiver.Id}
+	sort.Strings(expected)
+	metadata, err := user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.Equal(t, expected, metadata.Recipients)
+	assert.Equal(t, 2, metadata.RecipientCount)
+
+	_, err = receiver.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+}
+
+// Recipients are compared as sets during decryption
+func TestRecipientOrder(t *testing.T) {
+	var tests = []struct {
+		name             string
+		sharedRecipients []string
+		headerRecipients []string
+		err              string
+	}{
+		{"Same order", []string{"receiver", "sender"}, []string{"receiver", "sender"}, ""},
+		{"Different order", []string{"receiver", "sender"}, []string{"sender", "receiver"}, ""},
+		{"Different sets", []string{"receiver", "sender"}, []string{"receiver"}, "Sets of recipients are not equal"},
+		{"Duplicates in SharedLog", []string{"receiver", "sender", "sender"}, []string{"receiver", "sender"}, "Recipients are specified multiple times"},
+		{"Duplicates in header", []string{"receiver", "sender"}, []string{"receiver", "sender", "receiver"}, "Recipients are specified multiple times"},
+	}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = publicReceiver.Id
+	accessLog.Monitor = publicSender.Id
+	signedLog, err := publicSender.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sharedLog := logs.SharedLog{Log: signedLog, Recipients: tt.sharedRecipients, Creator: publicReceiver.Id}
+			cipher := EncryptRaw(t, sharedLog, publicReceiver, []user.RemoteUser{publicReceiver.RemoteUser, publicSender.RemoteUser},
+				map[string]interface{}{"owner": publicReceiver.Id, "recipients": tt.headerRecipients})
+
+			_, err := publicReceiver.DecryptLog(cipher, fetchUser)
+			if tt.err == "" {
+				assert.NoError(t, err, "Failed to decrypt log: %s", err)
+			} else {
+				assert.Containsf(t, err.Error(), tt.err, "")
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"crypto/sha256"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/tsa"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sign a log with a trusted timestamp and require it during decryption
+func TestTimestampLog(t *testing.T) {
+	authority, err := tsa.NewLocalAuthority()
+	assert.NoError(t, err, "Failed to create authority: %s", err)
+	// Certify a fixed time within the validity period of the certificate of the authority
+	certified := authority.Certificate.NotBefore.Add(time.Minute).UTC()
+	authority.Now = func() time.Time { return certified }
+
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLogWithOptions(accessLog, user.Options{Timestamper: authority})
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	timestamp, err := user.VerifyTimestamp(signedLog, authority.Certificate)
+	assert.NoError(t, err, "Failed to verify timestamp: %s", err)
+	assert.Equal(t, certified, timestamp.UTC())
+
+	// Timestamped logs can be decrypted with and without a configured authority
+	options := user.Options{TimestampAuthority: authority.Certificate}
+	jwe, err := monitor.EncryptLogWithOptions(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	receivedLog, err := owner.DecryptLogWithOptions(jwe, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	receivedAccessLog, err := receivedLog.Extract()
+	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
+	VerifyAccessLogs(t, accessLog, receivedAccessLog)
+	_, err = owner.DecryptLog(jwe, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// Logs without timestamp are rejected if an authority is configured
+	plainLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	_, err = monitor.EncryptLogWithOptions(plainLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Log does not contain a timestamp", "")
+	assert.Equal(t, ClassSignature, ClassOf(err))
+
+	// Timestamps of other authorities are rejected
+	other, err := tsa.NewLocalAuthority()
+	assert.NoError(t, err, "Failed to create authority: %s", err)
+	_, err = user.VerifyTimestamp(signedLog, other.Certificate)
+	assert.Containsf(t, err.Error(), "Could not verify timestamp", "")
+	assert.Equal(t, ClassCertificate, ClassOf(err))
+	_, err = owner.DecryptLogWithOptions(jwe, fetchUser, user.Options{TimestampAuthority: other.Certificate})
+	assert.Equal(t, ClassCertificate, ClassOf(err))
+
+	// Timestamps can not be moved to other logs
+	moved := plainLog
+	moved.Header = signedLog.Header
+	_, err = user.VerifyTimestamp(moved, authority.Certificate)
+	assert.Containsf(t, err.Error(), "Could not verify timestamp", "")
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+}
+
+// Obtain timestamps via the HTTP transport of RFC 3161
+func TestTimestampClient(t *testing.T) {
+	authority, err := tsa.NewLocalAuthority()
+	assert.NoError(t, err, "Failed to create authority: %s", err)
+	server := httptest.NewServer(authority)
+	defer server.Close()
+
+	client := tsa.Client{URL: server.URL, HTTPClient: server.Client()}
+	digest := sha256.Sum256([]byte("signature"))
+	token, err := client.Timestamp(digest[:])
+	assert.NoError(t, err, "Failed to obtain timestamp: %s", err)
+
+	info, err := tsa.Verify(token, digest[:], authority.Certificate)
+	assert.NoError(t, err, "Failed to verify timestamp: %s", err)
+	assert.WithinDuration(t, time.Now(), info.Time, time.Minute)
+	assert.Equal(t, tsa.DefaultPolicy, info.Policy)
+
+	otherDigest := sha256.Sum256([]byte("other"))
+	_, err = tsa.Verify(token, otherDigest[:], authority.Certificate)
+	assert.Containsf(t, err.Error(), "TimeStampToken does not certify the digest", "")
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+
+	// Tokens with an invalid signature or structure are classified
+	tampered := append([]byte{}, token...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = tsa.Verify(tampered, digest[:], authority.Certificate)
+	assert.Containsf(t, err.Error(), "Could not verify signature of TimeStampToken", "")
+	assert.Equal(t, ClassSignature, ClassOf(err))
+	_, err = tsa.Verify(token[1:], digest[:], authority.Certificate)
+	assert.Equal(t, ClassMalformed, ClassOf(err))
+	_, err = tsa.Verify(token, digest[:], nil)
+	assert.Equal(t, ClassCertificate, ClassOf(err))
+
+	// Requests for unknown policies are rejected
+	client.Policy = []int{1, 2, 3}
+	_, err = client.Timestamp(digest[:])
+	assert.Containsf(t, err.Error(), "rejected the request", "")
+}
+
+// Timestamps are only valid within the validity period of the certificate of the authority
+func TestTimestampCertificateValidity(t *testing.T) {
+	authority, err := tsa.NewLocalAuthority()
+	assert.NoError(t, err, "Failed to create authority: %s", err)
+	digest := sha256.Sum256([]byte("signature"))
+
+	for _, genTime := range []time.Time{
+		authority.Certificate.NotBefore.Add(-time.Second),
+		authority.Certificate.NotAfter.Add(time.Second),
+	} {
+		authority.Now = func() time.Time { return genTime }
+		token, err := authority.Timestamp(digest[:])
+		assert.NoError(t, err, "Failed to obtain timestamp: %s", err)
+		_, err = tsa.Verify(token, digest[:], authority.Certificate)
+		assert.Containsf(t, err.Error(), "TimeStampToken was issued outside the validity period of the certificate", "")
+		assert.Equal(t, ClassCertificate, ClassOf(err))
+	}
+
+	authority.Now = func() time.Time { return authority.Certificate.NotAfter }
+	token, err := authority.Timestamp(digest[:])
+	assert.NoError(t, err, "Failed to obtain timestamp: %s", err)
+	info, err := tsa.Verify(token, digest[:], authority.Certificate)
+	assert.NoError(t, err, "Failed to verify timestamp: %s", err)
+	assert.True(t, info.Time.Equal(authority.Certificate.NotAfter))
+}
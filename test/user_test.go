@@ -25,7 +25,7 @@ func TestEncryptSingle(t *testing.T) {
 	signedLog, err := sender.SignLog(accessLog)
 	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
 
-	cipher, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser})
+	cipher, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
 	receivedSingedLog, err := receiver.DecryptLog(cipher, fetchUser)
@@ -60,7 +60,7 @@ func TestEncryptMultiple(t *testing.T) {
 	// 1. Step: Monitor creates log and encrypts it for owner
 	signedLog, err := monitor.SignLog(accessLog)
 	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
-	cipher, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser})
+	cipher, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
 	// 2. Step: Owner can decrypt log
@@ -70,7 +70,7 @@ func TestEncryptMultiple(t *testing.T) {
 	assert.NoError(t, err, "Failed to extract AccessLog: %s", err)
 
 	// 3. Step: Owner shares with receiver
-	cipher, err = owner.EncryptLog(receivedSingedLog1, []user.RemoteUser{owner.RemoteUser, receiver.RemoteUser})
+	cipher, err = owner.EncryptLog(receivedSingedLog1, []user.RemoteUser{owner.RemoteUser, receiver.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
 	// 4. Step: Owner and receiver can decrypt
@@ -112,7 +112,7 @@ func TestImportUser(t *testing.T) {
 	signedLog, err := sender.SignLog(accessLog)
 	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
 
-	cipher, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser})
+	cipher, err := sender.EncryptLog(signedLog, []user.RemoteUser{receiver.RemoteUser}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 
 	receivedSingedLog, err := receiver.DecryptLog(cipher, fetchUser)
@@ -127,18 +127,21 @@ func TestImportUser(t *testing.T) {
 // Import users with CA signed keys
 func TestImportUserSingedKeys(t *testing.T) {
 	sender, err := user.ImportAuthenticatedUser("sender", PubA, PubA, PrivA, PrivA)
+	sender.IsMonitor = true
 	assert.NoError(t, err, "Failed to import user: %s", err)
 
 	receiver, err := user.ImportRemoteUser("receiver", PubA, PubA, false, PubCa)
 	assert.NoError(t, err, "Failed to import user: %s", err)
 
+	fetchUser := CreateFetchUser([]user.RemoteUser{sender.RemoteUser, receiver})
+
 	accessLog := logs.GenerateAccessLog()
 	accessLog.Owner = receiver.Id
 	accessLog.Monitor = sender.Id
 
 	signedLog, _ := sender.SignLog(accessLog)
 
-	_, err = sender.EncryptLog(signedLog, []user.RemoteUser{receiver})
+	_, err = sender.EncryptLog(signedLog, []user.RemoteUser{receiver}, fetchUser)
 	assert.NoError(t, err, "Failed to encrypt log: %s", err)
 }
 
@@ -147,3 +150,57 @@ func TestImportUserSingedKeysFail(t *testing.T) {
 	_, err := user.ImportRemoteUser("receiver", PubB, PubB, false, PubA)
 	assert.Containsf(t, err.Error(), "Can not verify encryption certificate", "")
 }
+
+// Encryption performs the same checks as decryption
+func TestEncryptValidation(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	other, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, other.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Owner = owner.Id
+	accessLog.Monitor = monitor.Id
+
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+
+	// Empty set of recipients
+	_, err = owner.EncryptLog(signedLog, []user.RemoteUser{}, fetchUser)
+	assert.Containsf(t, err.Error(), "No recipients specified", "")
+
+	// Recipients with the same id but different keys
+	conflicting := owner.RemoteUser
+	conflicting.Id = other.Id
+	_, err = owner.EncryptLog(signedLog, []user.RemoteUser{other.RemoteUser, conflicting}, fetchUser)
+	assert.Containsf(t, err.Error(), "is specified multiple times with different keys", "")
+
+	// Missing encryption key
+	noKey := other.RemoteUser
+	noKey.EncryptionCertificate = nil
+	_, err = owner.EncryptLog(signedLog, []user.RemoteUser{noKey}, fetchUser)
+	assert.Containsf(t, err.Error(), "has no encryption certificate", "")
+
+	// Log is not signed by a monitor
+	accessLog.Monitor = other.Id
+	unauthorizedLog, err := other.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	_, err = owner.EncryptLog(unauthorizedLog, []user.RemoteUser{other.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+
+	// Log is not signed by the claimed monitor
+	accessLog.Monitor = monitor.Id
+	forgedLog, err := other.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign AccessLog: %s", err)
+	_, err = owner.EncryptLog(forgedLog, []user.RemoteUser{other.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+
+	// Monitor shares with multiple recipients
+	_, err = monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser, other.RemoteUser}, fetchUser)
+	assert.Containsf(t, err.Error(), "Monitors can only share the data with the owner of the log", "")
+}
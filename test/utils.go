@@ -6,6 +6,7 @@ import (
 	"github.com/haggj/go-it-crypto/logs"
 	"github.com/haggj/go-it-crypto/user"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
 	"testing"
 )
 
@@ -62,8 +63,75 @@ func CreateFetchUser(users []user.RemoteUser) user.FetchUser {
 	}
 }
 
+// Fixture holds generated users, which are resolved by Fetch, and an AccessLog of Owner which is signed by Monitor.
+type Fixture struct {
+	Monitor user.AuthenticatedUser
+	Owner   user.AuthenticatedUser
+	// Monitors are additional monitors, e.g. to countersign the log.
+	Monitors []user.AuthenticatedUser
+	// Users are additional users which are neither monitor nor owner of the log.
+	Users     []user.AuthenticatedUser
+	Fetch     user.FetchUser
+	Log       logs.AccessLog
+	SignedLog logs.SingedLog
+}
+
+// CreateFixture generates a monitor, an owner, the given number of additional monitors and users and a signed log.
+func CreateFixture(t *testing.T, monitors int, users int) Fixture {
+	generate := func(isMonitor bool) user.AuthenticatedUser {
+		generated, err := user.GenerateAuthenticatedUser()
+		assert.NoError(t, err, "Failed to generate user: %s", err)
+		generated.IsMonitor = isMonitor
+		return generated
+	}
+
+	fixture := Fixture{Monitor: generate(true), Owner: generate(false)}
+	remoteUsers := []user.RemoteUser{fixture.Monitor.RemoteUser, fixture.Owner.RemoteUser}
+	for i := 0; i < monitors; i++ {
+		fixture.Monitors = append(fixture.Monitors, generate(true))
+		remoteUsers = append(remoteUsers, fixture.Monitors[i].RemoteUser)
+	}
+	for i := 0; i < users; i++ {
+		fixture.Users = append(fixture.Users, generate(false))
+		remoteUsers = append(remoteUsers, fixture.Users[i].RemoteUser)
+	}
+	fixture.Fetch = CreateFetchUser(remoteUsers)
+
+	fixture.Log = logs.GenerateAccessLog()
+	fixture.Log.Monitor = fixture.Monitor.Id
+	fixture.Log.Owner = fixture.Owner.Id
+	var err error
+	fixture.SignedLog, err = fixture.Monitor.SignLog(fixture.Log)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	return fixture
+}
+
 func VerifyAccessLogs(t *testing.T, first logs.AccessLog, second logs.AccessLog) {
 	firstRaw, _ := json.Marshal(first)
 	secondRaw, _ := json.Marshal(second)
 	assert.Equal(t, string(firstRaw), string(secondRaw))
 }
+
+// EncryptRaw signs the given SharedLog in the name of the creator and encrypts it for the given receivers.
+// In contrast to user.Encrypt it does not perform any checks and allows to set arbitrary headers.
+// It is used to create malformed tokens.
+func EncryptRaw(t *testing.T, sharedLog logs.SharedLog, creator user.AuthenticatedUser, receivers []user.RemoteUser, headers map[string]interface{}) string {
+	data, err := json.Marshal(sharedLog)
+	assert.NoError(t, err, "Failed to serialize SharedLog: %s", err)
+	jwsSharedLog, err := creator.SignData(data)
+	assert.NoError(t, err, "Failed to sign SharedLog: %s", err)
+
+	var recipients []jose.Recipient
+	for _, receiver := range receivers {
+		recipients = append(recipients, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: receiver.EncryptionCertificate})
+	}
+	var options jose.EncrypterOptions
+	for key, value := range headers {
+		options.WithHeader(jose.HeaderKey(key), value)
+	}
+	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, &options)
+	assert.NoError(t, err, "Failed to create encrypter: %s", err)
+	jwe, err := encrypter.Encrypt([]byte(jwsSharedLog))
+	assert.NoError(t, err, "Failed to encrypt: %s", err)
+	return jwe.FullSerialize()
+}
@@ -0,0 +1,53 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/vectors"
+	"github.com/stretchr/testify/assert"
+)
+
+// Run all vectors of the corpus shipped with this module
+func TestConformanceVectors(t *testing.T) {
+	corpus, err := vectors.Default()
+	assert.NoError(t, err, "Failed to load corpus: %s", err)
+	assert.NotEmpty(t, corpus.Vectors)
+
+	for _, vector := range corpus.Vectors {
+		vector := vector
+		t.Run(vector.Name, func(t *testing.T) {
+			assert.NoError(t, corpus.Run(vector))
+		})
+	}
+}
+
+// Freshly generated vectors replace the generated keyset and keep the vectors of other implementations
+func TestGenerateVectors(t *testing.T) {
+	corpus, err := vectors.Default()
+	assert.NoError(t, err, "Failed to load corpus: %s", err)
+
+	keyset, generated, err := vectors.Generate()
+	assert.NoError(t, err, "Failed to generate vectors: %s", err)
+	merged := corpus.Merge(keyset, generated)
+	assert.Equal(t, len(corpus.Vectors), len(merged.Vectors))
+	assert.Equal(t, keyset, merged.Keysets[vectors.GeneratedKeyset])
+
+	for _, vector := range merged.Vectors {
+		assert.NoError(t, merged.Run(vector), "Vector %s failed", vector.Name)
+	}
+
+	// Vectors with a wrong expectation are reported
+	vector := generated[0]
+	vector.Expected = vectors.Expectation{Valid: false, ErrorClass: ClassSignature}
+	assert.Error(t, merged.Run(vector))
+}
+
+func TestErrorClass(t *testing.T) {
+	inner := ItCryptoError{Des: "Claimed monitor is not authorized to sign logs.", Class: ClassAuthorization}
+	err := ItCryptoError{Des: "Could not verify accessLog", Err: ItCryptoError{Des: "Wrapped", Err: inner, Class: ClassMalformed}}
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+	assert.True(t, errors.Is(err, inner))
+	assert.Equal(t, Class(""), ClassOf(errors.New("unclassified")))
+}
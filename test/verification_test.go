@@ -0,0 +1,107 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/tsa"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// The verification result exposes who signed and who shared the log
+func TestDecryptVerified(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	witness, err := user.GenerateAuthenticatedUser()
+	witness.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	officer, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, witness.RemoteUser, owner.RemoteUser, officer.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	signedLog, err = witness.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+
+	cipher, err := owner.EncryptLog(signedLog, []user.RemoteUser{officer.RemoteUser, owner.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	verified, err := officer.DecryptVerifiedLog(cipher, fetchUser, user.Options{Threshold: 2})
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	VerifyAccessLogs(t, accessLog, verified.AccessLog)
+	assert.Equal(t, signedLog, verified.Log)
+	assert.Equal(t, owner.Id, verified.SharedLog.Creator)
+	assert.ElementsMatch(t, []string{officer.Id, owner.Id}, verified.SharedLog.Recipients)
+	assert.Empty(t, verified.Chain)
+
+	assert.Equal(t, owner.Id, verified.Creator.User.Id)
+	assert.Equal(t, "ES256", verified.Creator.Algorithm)
+	assert.Equal(t, monitor.Id, verified.Monitor.User.Id)
+	assert.Equal(t, "ES256", verified.Monitor.Algorithm)
+	assert.Len(t, verified.Monitors, 2)
+	assert.Equal(t, witness.Id, verified.Monitors[1].User.Id)
+	assert.True(t, verified.Timestamp.IsZero())
+
+	assert.Equal(t, user.Version2, verified.Version)
+	assert.Equal(t, "ECDH-ES+A256KW", verified.KeyAlgorithm)
+	assert.Equal(t, "A256GCM", verified.ContentEncryption)
+	assert.Equal(t, owner.Id, verified.Headers["owner"])
+	assert.NotContains(t, verified.Headers, "epk")
+
+	assert.Equal(t, []user.Check{user.CheckJweDecryption, user.CheckVersion, user.CheckCreatorSignature, user.CheckMonitorSignatures,
+		user.CheckRecipients, user.CheckOwner, user.CheckPolicy}, verified.Checks)
+	assert.True(t, verified.Passed(user.CheckPolicy))
+	assert.False(t, verified.Passed(user.CheckTimestamp))
+}
+
+// Optional checks are listed if they were performed
+func TestDecryptVerifiedOptionalChecks(t *testing.T) {
+	authority, err := tsa.NewLocalAuthority()
+	assert.NoError(t, err, "Failed to create authority: %s", err)
+	// Certify a fixed time within the validity period of the certificate of the authority
+	certified := authority.Certificate.NotBefore.Add(time.Minute).UTC()
+	authority.Now = func() time.Time { return certified }
+
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	officer, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, officer.RemoteUser})
+	options := user.Options{TimestampAuthority: authority.Certificate, MaxHops: 1}
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLogWithOptions(accessLog, user.Options{Timestamper: authority})
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	cipher, err := owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{officer.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	delegatedLog, err := officer.DecryptDelegatedLog(cipher, fetchUser, options)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	cipher, err = officer.ForwardLog(delegatedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, options)
+	assert.NoError(t, err, "Failed to forward log: %s", err)
+
+	itCrypto := itcrypto.ItCrypto{FetchUser: fetchUser, User: &owner, Options: options}
+	verified, err := itCrypto.DecryptVerifiedLog(cipher)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+	assert.Equal(t, officer.Id, verified.Creator.User.Id)
+	assert.Len(t, verified.Chain, 1)
+	assert.Equal(t, owner.Id, verified.Chain[0].Creator)
+	assert.Equal(t, certified, verified.Timestamp.UTC())
+	assert.True(t, verified.Passed(user.CheckDelegationChain))
+	assert.True(t, verified.Passed(user.CheckTimestamp))
+	assert.False(t, verified.Passed(user.CheckDisclosures))
+}
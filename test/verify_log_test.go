@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/itcrypto"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/logstore"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Signed logs can be verified without encryption
+func TestVerifyLog(t *testing.T) {
+	fixture := CreateFixture(t, 1, 0)
+	proxy, application, fetchUser := fixture.Monitor, fixture.Monitors[0], fixture.Fetch
+	accessLog, signedLog := fixture.Log, fixture.SignedLog
+
+	verified, err := user.VerifyLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to verify log: %s", err)
+	VerifyAccessLogs(t, accessLog, verified.AccessLog)
+	assert.Equal(t, proxy.Id, verified.Monitor.User.Id)
+	assert.Equal(t, "ES256", verified.Monitor.Algorithm)
+	assert.Len(t, verified.Monitors, 1)
+	assert.True(t, verified.Timestamp.IsZero())
+
+	// Countersigned logs return all signers
+	countersignedLog, err := application.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+	options := user.Options{Threshold: 2, Monitors: []string{proxy.Id, application.Id}}
+	verified, err = user.VerifyLogWithOptions(countersignedLog, fetchUser, options)
+	assert.NoError(t, err, "Failed to verify log: %s", err)
+	assert.Equal(t, proxy.Id, verified.Monitor.User.Id)
+	assert.Len(t, verified.Monitors, 2)
+	assert.Equal(t, proxy.Id, verified.Monitors[0].User.Id)
+	assert.Equal(t, application.Id, verified.Monitors[1].User.Id)
+
+	_, err = user.VerifyLogWithOptions(signedLog, fetchUser, options)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+	assert.Equal(t, ClassSignature, ClassOf(err))
+}
+
+// Logs of unauthorized, forged or tampered monitors are rejected
+func TestVerifyLogInvalid(t *testing.T) {
+	fixture := CreateFixture(t, 0, 0)
+	proxy, owner, fetchUser := fixture.Monitor, fixture.Owner, fixture.Fetch
+
+	// Log signed by a user who is not a monitor
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = owner.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := owner.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	_, err = user.VerifyLog(signedLog, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+	assert.Equal(t, ClassAuthorization, ClassOf(err))
+
+	// Log signed by a forged monitor with the id of a real monitor
+	forged, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	forged.Id = proxy.Id
+	forged.IsMonitor = true
+	accessLog.Monitor = proxy.Id
+	signedLog, err = forged.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	_, err = user.VerifyLog(signedLog, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+	assert.Equal(t, ClassSignature, ClassOf(err))
+
+	// Log with a modified payload
+	signedLog, err = proxy.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	tampered := accessLog
+	tampered.Tool = "Other"
+	rawTampered, err := json.Marshal(tampered)
+	assert.NoError(t, err)
+	signedLog.Payload = base64.RawURLEncoding.EncodeToString(rawTampered)
+	_, err = user.VerifyLog(signedLog, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not verify accessLog", "")
+	assert.Equal(t, ClassSignature, ClassOf(err))
+}
+
+// ItCrypto verifies logs without a logged-in user
+func TestItCryptoVerifyLog(t *testing.T) {
+	fixture := CreateFixture(t, 1, 0)
+	application, owner, fetchUser := fixture.Monitors[0], fixture.Owner, fixture.Fetch
+	accessLog, signedLog := fixture.Log, fixture.SignedLog
+
+	itCrypto := itcrypto.ItCrypto{}
+	_, err := itCrypto.VerifyLog(signedLog)
+	assert.Containsf(t, err.Error(), "Before you can verify you need to provide FetchUser function", "")
+
+	itCrypto = itcrypto.ItCrypto{FetchUser: fetchUser}
+	verified, err := itCrypto.VerifyLog(signedLog)
+	assert.NoError(t, err, "Failed to verify log: %s", err)
+	VerifyAccessLogs(t, accessLog, verified.AccessLog)
+
+	// The LogStore accepts countersigned logs
+	countersignedLog, err := application.CountersignLog(signedLog, fetchUser)
+	assert.NoError(t, err, "Failed to countersign log: %s", err)
+	store := logstore.LogStore{Backend: logstore.NewFileBackend(filepath.Join(t.TempDir(), "logs.ndjson")), Verify: logstore.MonitorVerifier(fetchUser)}
+	record, err := store.Put(countersignedLog, "")
+	assert.NoError(t, err, "Failed to store log: %s", err)
+	assert.Equal(t, owner.Id, record.AccessLog.Owner)
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"testing"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tokens carry the oldest protocol version which can represent the log
+func TestVersionNegotiation(t *testing.T) {
+	monitor, err := user.GenerateAuthenticatedUser()
+	monitor.IsMonitor = true
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	owner, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	legacy, err := user.GenerateAuthenticatedUser()
+	assert.NoError(t, err, "Failed to generate user: %s", err)
+	legacy.Versions = []int{user.Version1}
+	fetchUser := CreateFetchUser([]user.RemoteUser{monitor.RemoteUser, owner.RemoteUser, legacy.RemoteUser})
+
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = monitor.Id
+	accessLog.Owner = owner.Id
+	signedLog, err := monitor.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+
+	// Plain logs are encrypted as version 1 without version header, even if the receivers support newer versions
+	for _, receivers := range [][]user.RemoteUser{{owner.RemoteUser}, {owner.RemoteUser, legacy.RemoteUser}} {
+		cipher, err := owner.EncryptLog(signedLog, receivers, fetchUser)
+		assert.NoError(t, err, "Failed to encrypt log: %s", err)
+		metadata, err := user.InspectToken(cipher)
+		assert.NoError(t, err, "Failed to inspect token: %s", err)
+		assert.Equal(t, user.Version1, metadata.Version)
+		verified, err := owner.DecryptVerifiedLog(cipher, fetchUser, user.Options{})
+		assert.NoError(t, err, "Failed to decrypt log: %s", err)
+		assert.NotContains(t, verified.Headers, user.VersionHeader)
+	}
+	cipher, err := owner.EncryptLog(signedLog, []user.RemoteUser{legacy.RemoteUser}, fetchUser)
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	_, err = legacy.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	// Features of newer versions determine the version of the token
+	cipher, err = owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{HideRecipients: true})
+	assert.NoError(t, err, "Failed to encrypt log: %s", err)
+	metadata, err := user.InspectToken(cipher)
+	assert.NoError(t, err, "Failed to inspect token: %s", err)
+	assert.Equal(t, user.Version2, metadata.Version)
+
+	// Features of newer versions can not be used for receivers which only support older versions
+	_, err = owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{legacy.RemoteUser}, fetchUser, user.Options{HideRecipients: true})
+	assert.Containsf(t, err.Error(), "Receivers do not support protocol version 2", "")
+	assert.Equal(t, ClassVersion, ClassOf(err))
+
+	future := legacy.RemoteUser
+	future.Versions = []int{99}
+	_, err = owner.EncryptLog(signedLog, []user.RemoteUser{future}, fetchUser)
+	assert.Containsf(t, err.Error(), "Receivers do not support protocol version 1", "")
+	assert.Equal(t, ClassVersion, ClassOf(err))
+}
+
+// Decrypt dispatches on the version header of a token
+func TestVersionHeader(t *testing.T) {
+	fetchUser := CreateFetchUser([]user.RemoteUser{publicSender.RemoteUser, publicReceiver.RemoteUser})
+	accessLog := logs.GenerateAccessLog()
+	accessLog.Monitor = publicSender.Id
+	accessLog.Owner = publicReceiver.Id
+	signedLog, err := publicSender.SignLog(accessLog)
+	assert.NoError(t, err, "Failed to sign log: %s", err)
+	sharedLog := logs.SharedLog{Log: signedLog, Recipients: []string{publicReceiver.Id}, Creator: publicSender.Id}
+
+	// Tokens without version header are read as version 1
+	cipher := EncryptRaw(t, sharedLog, publicSender, []user.RemoteUser{publicReceiver.RemoteUser},
+		map[string]interface{}{"owner": publicReceiver.Id, "recipients": []string{publicReceiver.Id}})
+	_, err = publicReceiver.DecryptLog(cipher, fetchUser)
+	assert.NoError(t, err, "Failed to decrypt log: %s", err)
+
+	cipher = EncryptRaw(t, sharedLog, publicSender, []user.RemoteUser{publicReceiver.RemoteUser},
+		map[string]interface{}{"owner": publicReceiver.Id, "recipients": []string{publicReceiver.Id}, user.VersionHeader: 6})
+	_, err = publicReceiver.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Unsupported protocol version 6", "")
+	assert.Equal(t, ClassVersion, ClassOf(err))
+	_, err = user.InspectToken(cipher)
+	assert.Containsf(t, err.Error(), "Unsupported protocol version 6", "")
+
+	cipher = EncryptRaw(t, sharedLog, publicSender, []user.RemoteUser{publicReceiver.RemoteUser},
+		map[string]interface{}{"owner": publicReceiver.Id, "recipients": []string{publicReceiver.Id}, user.VersionHeader: "2"})
+	_, err = publicReceiver.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Could not extract protocol version from metadata", "")
+
+	// Version 1 tokens can not use features of version 2
+	cipher = EncryptRaw(t, sharedLog, publicSender, []user.RemoteUser{publicReceiver.RemoteUser},
+		map[string]interface{}{"owner": publicReceiver.Id, "hiddenRecipients": true, user.VersionHeader: user.Version1})
+	_, err = publicReceiver.DecryptLog(cipher, fetchUser)
+	assert.Containsf(t, err.Error(), "Token of protocol version 1 uses features of version 2", "")
+}
+
+// Users publish their supported versions in the directory
+func TestDirectoryVersions(t *testing.T) {
+	_, client := newDirectory(t)
+
+	other, err := client.Fetch("other")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.Equal(t, []int{user.Version1}, other.Versions)
+
+	monitor, err := client.Fetch("monitor")
+	assert.NoError(t, err, "Failed to fetch user: %s", err)
+	assert.Nil(t, monitor.Versions)
+}
@@ -0,0 +1,249 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// Timestamper obtains RFC 3161 timestamp tokens for SHA-256 digests.
+type Timestamper interface {
+	// Timestamp returns the DER-encoded TimeStampToken for the given SHA-256 digest.
+	Timestamp(digest []byte) ([]byte, error)
+}
+
+// LocalAuthority is an in-process time-stamping authority. It is intended for tests and for deployments which
+// run their own TSA. It can be used directly as Timestamper or be served via HTTP.
+type LocalAuthority struct {
+	Certificate *x509.Certificate
+	Policy      asn1.ObjectIdentifier
+	// Now returns the time which is certified by the authority. Defaults to time.Now.
+	Now func() time.Time
+	key *ecdsa.PrivateKey
+}
+
+// NewLocalAuthority creates a LocalAuthority with a fresh P-256 key and a self-signed certificate.
+// Use the Certificate to verify timestamps issued by this authority.
+func NewLocalAuthority() (*LocalAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate key", Err: err}
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate serial number", Err: err}
+	}
+
+	// RFC 3161 requires the extended key usage of the authority to be critical
+	extKeyUsage, err := asn1.Marshal([]asn1.ObjectIdentifier{oidTimeStamping})
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize extended key usage", Err: err}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Local Time-Stamping Authority"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		ExtraExtensions:       []pkix.Extension{{Id: oidExtKeyUsage, Critical: true, Value: extKeyUsage}},
+		BasicConstraintsValid: true,
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not create certificate", Err: err}
+	}
+	certificate, err := x509.ParseCertificate(raw)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not parse certificate", Err: err}
+	}
+
+	return &LocalAuthority{Certificate: certificate, Policy: DefaultPolicy, key: key}, nil
+}
+
+// Timestamp returns a TimeStampToken for the given SHA-256 digest.
+func (authority *LocalAuthority) Timestamp(digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, ItCryptoError{Des: "Digest is not a SHA-256 digest"}
+	}
+	return authority.issue(messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: digest}, nil, true)
+}
+
+// ServeHTTP implements the HTTP transport of RFC 3161. It answers POST requests containing a DER-encoded
+// TimeStampReq with a DER-encoded TimeStampResp.
+func (authority *LocalAuthority) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, "Could not read request", http.StatusBadRequest)
+		return
+	}
+
+	response := authority.respond(body)
+	w.Header().Set("Content-Type", contentTypeReply)
+	_, _ = w.Write(response)
+}
+
+// respond processes a DER-encoded TimeStampReq and returns the DER-encoded TimeStampResp.
+func (authority *LocalAuthority) respond(rawRequest []byte) []byte {
+	var request timeStampReq
+	rest, err := asn1.Unmarshal(rawRequest, &request)
+	if err != nil || len(rest) > 0 || request.Version != timeStampReqVersion {
+		return rejection(failureBadDataFormat)
+	}
+	if !request.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || len(request.MessageImprint.HashedMessage) != sha256.Size {
+		return rejection(failureBadAlg)
+	}
+	if request.ReqPolicy != nil && !request.ReqPolicy.Equal(authority.Policy) {
+		return rejection(failureUnacceptedPolicy)
+	}
+
+	token, err := authority.issue(request.MessageImprint, request.Nonce, request.CertReq)
+	if err != nil {
+		return rejection(failureSystemFailure)
+	}
+	response, err := asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: statusGranted},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+	if err != nil {
+		return rejection(failureSystemFailure)
+	}
+	return response
+}
+
+// issue creates a DER-encoded TimeStampToken for the given message imprint.
+func (authority *LocalAuthority) issue(imprint messageImprint, nonce *big.Int, includeCertificate bool) ([]byte, error) {
+	now := time.Now
+	if authority.Now != nil {
+		now = authority.Now
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate serial number", Err: err}
+	}
+
+	info, err := asn1.Marshal(tstInfo{
+		Version:        tstInfoVersion,
+		Policy:         authority.Policy,
+		MessageImprint: imprint,
+		SerialNumber:   serial,
+		GenTime:        now().UTC().Truncate(time.Second),
+		Nonce:          nonce,
+	})
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize TSTInfo", Err: err}
+	}
+
+	// The signed attributes bind the TSTInfo and the certificate of the authority
+	infoDigest := sha256.Sum256(info)
+	certificateDigest := sha256.Sum256(authority.Certificate.Raw)
+	attributes, err := signedAttributes(
+		attribute{Type: oidContentType, Values: []asn1.RawValue{rawValue(oidTSTInfo)}},
+		attribute{Type: oidMessageDigest, Values: []asn1.RawValue{rawValue(infoDigest[:])}},
+		attribute{Type: oidSigningCertificateV2, Values: []asn1.RawValue{rawValue(signingCertificateV2{
+			Certs: []essCertIDv2{{CertHash: certificateDigest[:]}},
+		})}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	attributesDigest := sha256.Sum256(attributes.FullBytes)
+	signature, err := ecdsa.SignASN1(rand.Reader, authority.key, attributesDigest[:])
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not sign TSTInfo", Err: err}
+	}
+
+	signer := signerInfo{
+		Version: signerInfoVersion,
+		Sid: issuerAndSerialNumber{
+			Issuer:       asn1.RawValue{FullBytes: authority.Certificate.RawIssuer},
+			SerialNumber: authority.Certificate.SerialNumber,
+		},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes.Bytes},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+		Signature:          signature,
+	}
+	content := signedData{
+		Version:          signedDataVersion,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: info},
+		SignerInfos:      []signerInfo{signer},
+	}
+	if includeCertificate {
+		content.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: authority.Certificate.Raw}
+	}
+
+	rawContent, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize SignedData", Err: err}
+	}
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: rawContent},
+	})
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize TimeStampToken", Err: err}
+	}
+	return token, nil
+}
+
+// signedAttributes encodes the given attributes as DER SET OF Attribute. The elements of a DER SET OF are sorted
+// by their encoding.
+func signedAttributes(attributes ...attribute) (asn1.RawValue, error) {
+	var encoded [][]byte
+	for _, attr := range attributes {
+		rawAttribute, err := asn1.Marshal(attr)
+		if err != nil {
+			return asn1.RawValue{}, ItCryptoError{Des: "Could not serialize attribute", Err: err}
+		}
+		encoded = append(encoded, rawAttribute)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+
+	return asSet(bytes.Join(encoded, nil))
+}
+
+// rawValue encodes the given value. It must only be used with values which can always be encoded.
+func rawValue(value interface{}) asn1.RawValue {
+	raw, err := asn1.Marshal(value)
+	if err != nil {
+		panic(err)
+	}
+	return asn1.RawValue{FullBytes: raw}
+}
+
+// asSet wraps the given content into a universal SET.
+func asSet(content []byte) (asn1.RawValue, error) {
+	raw, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content})
+	if err != nil {
+		return asn1.RawValue{}, ItCryptoError{Des: "Could not serialize attributes", Err: err}
+	}
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: content, FullBytes: raw}, nil
+}
+
+// rejection returns a DER-encoded TimeStampResp which rejects the request with the given failure.
+func rejection(failure int) []byte {
+	failInfo := asn1.BitString{Bytes: make([]byte, failure/8+1), BitLength: failure + 1}
+	failInfo.Bytes[failure/8] |= 0x80 >> uint(failure%8)
+	response, _ := asn1.Marshal(timeStampResp{Status: pkiStatusInfo{Status: statusRejection, FailInfo: failInfo}})
+	return response
+}
@@ -0,0 +1,85 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// Client obtains timestamps from a remote time-stamping authority via the HTTP transport of RFC 3161.
+type Client struct {
+	// URL of the time-stamping authority.
+	URL string
+	// Policy requested from the authority. The default policy of the authority is used if it is nil.
+	Policy asn1.ObjectIdentifier
+	// HTTPClient is used to send requests. The http.DefaultClient is used if it is nil.
+	HTTPClient *http.Client
+}
+
+// Timestamp requests a TimeStampToken for the given SHA-256 digest.
+// *NOTE*: The returned token is not verified. Use Verify with the certificate of the authority.
+func (client Client) Timestamp(digest []byte) ([]byte, error) {
+	if len(digest) != sha256.Size {
+		return nil, ItCryptoError{Des: "Digest is not a SHA-256 digest"}
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), nonceBits))
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate nonce", Err: err}
+	}
+
+	request, err := asn1.Marshal(timeStampReq{
+		Version:        timeStampReqVersion,
+		MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, HashedMessage: digest},
+		ReqPolicy:      client.Policy,
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not serialize TimeStampReq", Err: err}
+	}
+
+	httpClient := client.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Post(client.URL, contentTypeQuery, bytes.NewReader(request))
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not request time-stamping authority", Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, ItCryptoError{Des: fmt.Sprintf("Time-stamping authority responded with status %d", response.StatusCode)}
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseSize))
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not read TimeStampResp", Err: err}
+	}
+
+	var result timeStampResp
+	rest, err := asn1.Unmarshal(body, &result)
+	if err != nil || len(rest) > 0 {
+		return nil, ItCryptoError{Des: "Could not parse TimeStampResp", Err: err}
+	}
+	if result.Status.Status != statusGranted && result.Status.Status != statusGrantedWithMods {
+		return nil, ItCryptoError{Des: fmt.Sprintf("Time-stamping authority rejected the request with status %d", result.Status.Status)}
+	}
+
+	// Verify that the token answers this request
+	token := result.TimeStampToken.FullBytes
+	_, info, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 || !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, ItCryptoError{Des: "Malformed data: TimeStampToken does not answer the request."}
+	}
+	return token, nil
+}
@@ -0,0 +1,140 @@
+package tsa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"time"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// Info is the verified content of a TimeStampToken.
+type Info struct {
+	// Time is the time the authority certified the digest at.
+	Time         time.Time
+	SerialNumber *big.Int
+	Policy       asn1.ObjectIdentifier
+}
+
+// Verify verifies that the TimeStampToken was issued by the authority with the given certificate for the given
+// SHA-256 digest and returns the certified time. The certified time needs to be within the validity period of the
+// certificate.
+func Verify(token []byte, digest []byte, certificate *x509.Certificate) (Info, error) {
+	if certificate == nil {
+		return Info{}, ItCryptoError{Des: "No certificate of the time-stamping authority configured", Class: ClassCertificate}
+	}
+	if !slices.Contains(certificate.ExtKeyUsage, x509.ExtKeyUsageTimeStamping) {
+		return Info{}, ItCryptoError{Des: "Certificate is not authorized to issue timestamps", Class: ClassCertificate}
+	}
+
+	content, info, err := parseToken(token)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(content.SignerInfos) != 1 {
+		return Info{}, ItCryptoError{Des: "Malformed data: TimeStampToken must contain exactly one signer.", Class: ClassMalformed}
+	}
+	signer := content.SignerInfos[0]
+	if !signer.DigestAlgorithm.Algorithm.Equal(oidSHA256) {
+		return Info{}, ItCryptoError{Des: "Unsupported digest algorithm in TimeStampToken", Class: ClassMalformed}
+	}
+
+	// The signature covers the signed attributes, which bind the TSTInfo by its digest
+	attributes, err := asSet(signer.SignedAttrs.Bytes)
+	if err != nil {
+		return Info{}, err
+	}
+	err = verifyAttributes(attributes, content.EncapContentInfo.EContent, certificate)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var algorithm x509.SignatureAlgorithm
+	switch {
+	case signer.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA256):
+		algorithm = x509.ECDSAWithSHA256
+	case signer.SignatureAlgorithm.Algorithm.Equal(oidSHA256WithRSA), signer.SignatureAlgorithm.Algorithm.Equal(oidRSAEncryption):
+		algorithm = x509.SHA256WithRSA
+	default:
+		return Info{}, ItCryptoError{Des: "Unsupported signature algorithm in TimeStampToken", Class: ClassMalformed}
+	}
+	err = certificate.CheckSignature(algorithm, attributes.FullBytes, signer.Signature)
+	if err != nil {
+		return Info{}, ItCryptoError{Des: "Could not verify signature of TimeStampToken", Err: err, Class: ClassSignature}
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) || !bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return Info{}, ItCryptoError{Des: "Malformed data: TimeStampToken does not certify the digest.", Class: ClassMalformed}
+	}
+
+	// The certificate needs to be valid at the certified time, otherwise an expired key could issue arbitrary times
+	if info.GenTime.Before(certificate.NotBefore) || info.GenTime.After(certificate.NotAfter) {
+		return Info{}, ItCryptoError{Des: "TimeStampToken was issued outside the validity period of the certificate", Class: ClassCertificate}
+	}
+	return Info{Time: info.GenTime, SerialNumber: info.SerialNumber, Policy: info.Policy}, nil
+}
+
+// parseToken parses a TimeStampToken without verifying it.
+func parseToken(token []byte) (signedData, tstInfo, error) {
+	var container contentInfo
+	rest, err := asn1.Unmarshal(token, &container)
+	if err != nil || len(rest) > 0 || !container.ContentType.Equal(oidSignedData) {
+		return signedData{}, tstInfo{}, ItCryptoError{Des: "Could not parse TimeStampToken", Err: err, Class: ClassMalformed}
+	}
+
+	var content signedData
+	rest, err = asn1.Unmarshal(container.Content.Bytes, &content)
+	if err != nil || len(rest) > 0 || !content.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return signedData{}, tstInfo{}, ItCryptoError{Des: "Could not parse SignedData of TimeStampToken", Err: err, Class: ClassMalformed}
+	}
+
+	var info tstInfo
+	rest, err = asn1.Unmarshal(content.EncapContentInfo.EContent, &info)
+	if err != nil || len(rest) > 0 || info.Version != tstInfoVersion {
+		return signedData{}, tstInfo{}, ItCryptoError{Des: "Could not parse TSTInfo of TimeStampToken", Err: err, Class: ClassMalformed}
+	}
+	return content, info, nil
+}
+
+// verifyAttributes verifies that the signed attributes reference the TSTInfo and the certificate of the authority.
+func verifyAttributes(attributes asn1.RawValue, info []byte, certificate *x509.Certificate) error {
+	var contentType, messageDigest bool
+	for rest := attributes.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		rest, err = asn1.Unmarshal(rest, &attr)
+		if err != nil || len(attr.Values) != 1 {
+			return ItCryptoError{Des: "Could not parse signed attributes of TimeStampToken", Err: err, Class: ClassMalformed}
+		}
+		value := attr.Values[0].FullBytes
+
+		switch {
+		case attr.Type.Equal(oidContentType):
+			var oid asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(value, &oid)
+			contentType = err == nil && oid.Equal(oidTSTInfo)
+		case attr.Type.Equal(oidMessageDigest):
+			var digest []byte
+			_, err = asn1.Unmarshal(value, &digest)
+			expected := sha256.Sum256(info)
+			messageDigest = err == nil && bytes.Equal(digest, expected[:])
+		case attr.Type.Equal(oidSigningCertificateV2):
+			var signingCertificate signingCertificateV2
+			_, err = asn1.Unmarshal(value, &signingCertificate)
+			expected := sha256.Sum256(certificate.Raw)
+			if err != nil || len(signingCertificate.Certs) == 0 || !bytes.Equal(signingCertificate.Certs[0].CertHash, expected[:]) {
+				return ItCryptoError{Des: "Malformed data: TimeStampToken was not issued by the configured authority.", Class: ClassCertificate}
+			}
+		}
+	}
+
+	if !contentType || !messageDigest {
+		return ItCryptoError{Des: "Malformed data: Signed attributes do not match the TSTInfo.", Class: ClassMalformed}
+	}
+	return nil
+}
@@ -7,9 +7,13 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	. "github.com/haggj/go-it-crypto/error"
 	. "github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/observability"
 	"gopkg.in/square/go-jose.v2"
 )
 
@@ -25,8 +29,8 @@ type AuthenticatedUser struct {
 }
 
 // EncryptLog encrypts a SignedAccessLog for the given set of receivers.
-func (user AuthenticatedUser) EncryptLog(log SingedLog, receivers []RemoteUser) (string, error) {
-	return Encrypt(log, user, receivers)
+func (user AuthenticatedUser) EncryptLog(log SingedLog, receivers []RemoteUser, fn FetchUser) (string, error) {
+	return Encrypt(log, user, receivers, fn)
 }
 
 // DecryptLog decrypts a given JWE token.
@@ -34,6 +38,107 @@ func (user AuthenticatedUser) DecryptLog(jwe string, fn FetchUser) (SingedLog, e
 	return Decrypt(jwe, user, fn)
 }
 
+// EncryptLogWithOptions encrypts a SignedAccessLog for the given set of receivers using the given options.
+func (user AuthenticatedUser) EncryptLogWithOptions(log SingedLog, receivers []RemoteUser, fn FetchUser, options Options) (string, error) {
+	return EncryptWithOptions(log, user, receivers, fn, options)
+}
+
+// DecryptLogWithOptions decrypts a given JWE token using the given options.
+func (user AuthenticatedUser) DecryptLogWithOptions(jwe string, fn FetchUser, options Options) (SingedLog, error) {
+	return DecryptWithOptions(jwe, user, fn, options)
+}
+
+// DecryptVerifiedLog decrypts a given JWE token and returns the verified log together with its provenance.
+func (user AuthenticatedUser) DecryptVerifiedLog(jwe string, fn FetchUser, options Options) (VerifiedLog, error) {
+	return DecryptVerified(jwe, user, fn, options)
+}
+
+// EncryptDisclosableLog encrypts a DisclosableLog for the given set of receivers.
+func (user AuthenticatedUser) EncryptDisclosableLog(log DisclosableLog, receivers []RemoteUser, fn FetchUser, options Options) (string, error) {
+	return EncryptDisclosable(log, user, receivers, fn, options)
+}
+
+// DecryptDisclosableLog decrypts a given JWE token and returns the contained log with its disclosures.
+func (user AuthenticatedUser) DecryptDisclosableLog(jwe string, fn FetchUser, options Options) (DisclosableLog, error) {
+	return DecryptDisclosable(jwe, user, fn, options)
+}
+
+// DecryptDelegatedLog decrypts a given JWE token in delegation mode.
+func (user AuthenticatedUser) DecryptDelegatedLog(jwe string, fn FetchUser, options Options) (DelegatedLog, error) {
+	return DecryptDelegated(jwe, user, fn, options)
+}
+
+// ForwardLog forwards a DelegatedLog to the given set of receivers.
+func (user AuthenticatedUser) ForwardLog(log DelegatedLog, receivers []RemoteUser, fn FetchUser, options Options) (string, error) {
+	return Forward(log, user, receivers, fn, options)
+}
+
+// MigrateToken re-encrypts a token which was encrypted for this user to the new keys of this user.
+func (user AuthenticatedUser) MigrateToken(jwe string, newKeys RemoteUser, fn FetchUser, options Options) (string, error) {
+	return MigrateToken(jwe, user, newKeys, fn, options)
+}
+
+// NewReEncryptionKey creates a ReEncryptionKey which allows a proxy to re-encrypt tokens of this user for the
+// delegate.
+func (user AuthenticatedUser) NewReEncryptionKey(delegate RemoteUser, lifetime time.Duration) (ReEncryptionKey, error) {
+	return NewReEncryptionKey(user, delegate, lifetime)
+}
+
+// PartialDecrypt decrypts the key share of this user of a token which requires a quorum for the combiner.
+func (user AuthenticatedUser) PartialDecrypt(jwe string, combiner RemoteUser) (string, error) {
+	return PartialDecrypt(jwe, user, combiner)
+}
+
+// CombineDecrypt decrypts a token which requires a quorum with the partial decryptions of the recipients.
+func (user AuthenticatedUser) CombineDecrypt(jwe string, partials []string, fn FetchUser, options Options) (VerifiedLog, error) {
+	return CombineDecrypt(jwe, partials, user, fn, options)
+}
+
+// CreateReceipt decrypts the given JWE token and returns a receipt signed by this user.
+func (user AuthenticatedUser) CreateReceipt(jwe string, fn FetchUser, options Options) (SignedReceipt, error) {
+	return CreateReceipt(jwe, user, fn, options)
+}
+
+// EncryptReceipt encrypts a receipt of this user for the sharer of the acknowledged token.
+func (user AuthenticatedUser) EncryptReceipt(receipt SignedReceipt, fn FetchUser) (string, error) {
+	return EncryptReceipt(receipt, user, fn)
+}
+
+// DecryptReceipt decrypts a receipt which was encrypted for this user.
+func (user AuthenticatedUser) DecryptReceipt(jwe string, fn FetchUser) (SignedReceipt, Receipt, error) {
+	return DecryptReceipt(jwe, user, fn)
+}
+
+// CreateObjection creates an objection of this user against a log this user owns.
+func (user AuthenticatedUser) CreateObjection(log SingedLog, reason string, fn FetchUser) (SignedObjection, error) {
+	return CreateObjection(log, reason, user, fn)
+}
+
+// EncryptObjection encrypts an objection of this user for the monitor of the log and the given officers.
+func (user AuthenticatedUser) EncryptObjection(objection SignedObjection, fn FetchUser, officers ...RemoteUser) (string, error) {
+	return EncryptObjection(objection, user, fn, officers...)
+}
+
+// DecryptObjection decrypts an objection which was encrypted for this user.
+func (user AuthenticatedUser) DecryptObjection(jwe string, fn FetchUser) (SignedObjection, Objection, error) {
+	return DecryptObjection(jwe, user, fn)
+}
+
+// RespondToObjection creates the response of this user to an objection against a log this user monitored.
+func (user AuthenticatedUser) RespondToObjection(objection SignedObjection, decision string, message string, fn FetchUser) (SignedObjectionResponse, error) {
+	return RespondToObjection(objection, decision, message, user, fn)
+}
+
+// EncryptObjectionResponse encrypts a response of this user for the objecting owner.
+func (user AuthenticatedUser) EncryptObjectionResponse(response SignedObjectionResponse, objection SignedObjection, fn FetchUser) (string, error) {
+	return EncryptObjectionResponse(response, objection, user, fn)
+}
+
+// DecryptObjectionResponse decrypts a response to the given objection which was encrypted for this user.
+func (user AuthenticatedUser) DecryptObjectionResponse(jwe string, objection SignedObjection, fn FetchUser) (SignedObjectionResponse, ObjectionResponse, error) {
+	return DecryptObjectionResponse(jwe, objection, user, fn)
+}
+
 // SignData cryptographically signs the provided data.
 func (user AuthenticatedUser) SignData(data []byte) (string, error) {
 	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: user.SigningKey}, nil)
@@ -69,51 +174,156 @@ func (user AuthenticatedUser) SignLog(log AccessLog) (SingedLog, error) {
 	return singedLog, nil
 }
 
+// SignLogWithOptions works like SignLog but additionally obtains a trusted timestamp over the signature if
+// options.Timestamper is set.
+func (user AuthenticatedUser) SignLogWithOptions(log AccessLog, options Options) (signedLog SingedLog, err error) {
+	operation := observability.Begin(options.Observer, "sign")
+	defer func() { operation.End(err) }()
+
+	finish := operation.Stage(observability.StageSign)
+	if options.CanonicalJson || options.UnencodedPayload {
+		signedLog, err = user.signCanonicalLog(log, options.UnencodedPayload)
+	} else {
+		signedLog, err = user.SignLog(log)
+	}
+	finish(err)
+	if err != nil {
+		return SingedLog{}, err
+	}
+	if options.Timestamper == nil {
+		return signedLog, nil
+	}
+	finish = operation.Stage(observability.StageTimestamp)
+	signedLog, err = TimestampLog(signedLog, options.Timestamper)
+	finish(err)
+	return signedLog, err
+}
+
+// signCanonicalLog signs the canonical JSON form of the AccessLog. If unencoded is set, the payload is not
+// base64url-encoded (RFC 7797).
+func (user AuthenticatedUser) signCanonicalLog(log AccessLog, unencoded bool) (SingedLog, error) {
+	rawLog, err := CanonicalJson(log)
+	if err != nil {
+		return SingedLog{}, err
+	}
+
+	signerOptions := &jose.SignerOptions{}
+	if unencoded {
+		signerOptions = signerOptions.WithBase64(false)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: user.SigningKey}, signerOptions)
+	if err != nil {
+		return SingedLog{}, err
+	}
+	object, err := signer.Sign(rawLog)
+	if err != nil {
+		return SingedLog{}, err
+	}
+
+	// go-jose always encodes the payload of the JSON serialization
+	signedLog, err := JwsFromBytes([]byte(object.FullSerialize()))
+	if err != nil {
+		return SingedLog{}, err
+	}
+	if unencoded {
+		signedLog.Payload = string(rawLog)
+	}
+	return SingedLog(signedLog), nil
+}
+
+// CountersignLog adds the signature of this user to a log which is already signed by another monitor.
+func (user AuthenticatedUser) CountersignLog(log SingedLog, fn FetchUser) (SingedLog, error) {
+	return Countersign(log, user, fn)
+}
+
+// SignLogDisclosable cryptographically signs a raw AccessLog object in selective disclosure mode.
+// The signed log only contains the monitor, the owner and salted digests of all other fields. The returned
+// DisclosableLog contains the disclosures of all fields. Use DisclosableLog.Reveal to share only some of them.
+func (user AuthenticatedUser) SignLogDisclosable(log AccessLog) (DisclosableLog, error) {
+	payload, disclosures, err := DisclosablePayload(log)
+	if err != nil {
+		return DisclosableLog{}, err
+	}
+
+	signedData, err := user.SignData(payload)
+	if err != nil {
+		return DisclosableLog{}, err
+	}
+
+	var singedLog = SingedLog{}
+	err = json.Unmarshal([]byte(signedData), &singedLog)
+	if err != nil {
+		return DisclosableLog{}, err
+	}
+	return DisclosableLog{Log: singedLog, Disclosures: disclosures}, nil
+}
+
 // ImportAuthenticatedUser imports a user based on its certificates and keys.
 // The returned user can be used to sign and encrypt logs.
 func ImportAuthenticatedUser(id string, encryptionCertificate string, VerificationCertificate string, decryptionKey string, signingKey string) (AuthenticatedUser, error) {
 
 	// Parse PEM-encoded encryption certificate
-	rawEncCert, _ := pem.Decode([]byte(encryptionCertificate))
-	encCert, err := x509.ParseCertificate([]byte(rawEncCert.Bytes))
+	encCert, err := parseCertificate(encryptionCertificate)
 	if err != nil {
-		return AuthenticatedUser{}, err
+		return AuthenticatedUser{}, ItCryptoError{Des: "Can not parse encryption certificate", Err: err, Class: ClassCertificate}
+	}
+	encKey, ok := encCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return AuthenticatedUser{}, ItCryptoError{Des: "Encryption certificate does not contain an ECDSA key", Class: ClassCertificate}
 	}
 
 	// Parse PEM-encoded verification certificate
-	rawVrfCert, _ := pem.Decode([]byte(VerificationCertificate))
-	vrfCert, err := x509.ParseCertificate([]byte(rawVrfCert.Bytes))
+	vrfCert, err := parseCertificate(VerificationCertificate)
 	if err != nil {
-		return AuthenticatedUser{}, err
+		return AuthenticatedUser{}, ItCryptoError{Des: "Can not parse verification certificate", Err: err, Class: ClassCertificate}
+	}
+	vrfKey, ok := vrfCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return AuthenticatedUser{}, ItCryptoError{Des: "Verification certificate does not contain an ECDSA key", Class: ClassCertificate}
 	}
 
 	// Parse pem-encoded decryption key
-	rawDecKey, _ := pem.Decode([]byte(decryptionKey))
-	decKey, err := x509.ParsePKCS8PrivateKey(rawDecKey.Bytes)
+	decKey, err := parsePrivateKey(decryptionKey)
 	if err != nil {
-		return AuthenticatedUser{}, err
+		return AuthenticatedUser{}, ItCryptoError{Des: "Can not parse decryption key", Err: err}
 	}
 
 	// Parse pem-encoded signing key
-	rawSignKey, _ := pem.Decode([]byte(signingKey))
-	signKey, err := x509.ParsePKCS8PrivateKey(rawSignKey.Bytes)
+	signKey, err := parsePrivateKey(signingKey)
 	if err != nil {
-		return AuthenticatedUser{}, err
+		return AuthenticatedUser{}, ItCryptoError{Des: "Can not parse signing key", Err: err}
 	}
 
 	return AuthenticatedUser{
 		RemoteUser: RemoteUser{
 			Id:                      id,
-			EncryptionCertificate:   encCert.PublicKey.(*ecdsa.PublicKey),
-			VerificationCertificate: vrfCert.PublicKey.(*ecdsa.PublicKey),
+			EncryptionCertificate:   encKey,
+			VerificationCertificate: vrfKey,
 			IsMonitor:               false,
 		},
-		DecryptionKey: decKey.(*ecdsa.PrivateKey),
-		SigningKey:    signKey.(*ecdsa.PrivateKey),
+		DecryptionKey: decKey,
+		SigningKey:    signKey,
 	}, nil
 
 }
 
+// parsePrivateKey parses a PEM-encoded ECDSA private key in PKCS #8 format.
+func parsePrivateKey(privateKey string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
 // GenerateAuthenticatedUser generates a random AuthenticatedUser. It is used during testing.
 func GenerateAuthenticatedUser() (AuthenticatedUser, error) {
 	return GenerateAuthenticatedUserById(uuid.New().String())
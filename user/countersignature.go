@@ -0,0 +1,135 @@
+package user
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/slices"
+	"gopkg.in/square/go-jose.v2"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+)
+
+// Countersign adds the signature of another monitor to the given log, e.g. to witness an access by two systems.
+// The log is converted to the general JSON serialization. Each countersignature states its signer in the "kid"
+// header, while the original signature belongs to the monitor specified in the log.
+func Countersign(log SingedLog, signer AuthenticatedUser, fetchUser FetchUser) (SingedLog, error) {
+	if !signer.IsMonitor {
+		return SingedLog{}, ItCryptoError{Des: "Only monitors can countersign logs.", Class: ClassAuthorization}
+	}
+
+	_, err := verifyEmbeddedLog(SharedLog{Log: log}, fetchUser, Options{})
+	if err != nil {
+		return SingedLog{}, err
+	}
+	signers, err := logSigners(log)
+	if err != nil {
+		return SingedLog{}, err
+	}
+	if slices.Contains(signers, signer.Id) {
+		return SingedLog{}, ItCryptoError{Des: "Log is already signed by " + signer.Id + "."}
+	}
+
+	payload, err := JWS(log).PayloadBytes()
+	if err != nil {
+		return SingedLog{}, ItCryptoError{Des: "Could not decode payload in jwsAccessLog", Err: err, Class: ClassMalformed}
+	}
+	// All signatures need to agree on the encoding of the payload
+	signerOptions := (&jose.SignerOptions{}).WithHeader("kid", signer.Id)
+	if JWS(log).Unencoded() {
+		signerOptions = signerOptions.WithBase64(false)
+	}
+	joseSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: signer.SigningKey}, signerOptions)
+	if err != nil {
+		return SingedLog{}, ItCryptoError{Des: "Could not instantiate signing engine.", Err: err}
+	}
+	object, err := joseSigner.Sign(payload)
+	if err != nil {
+		return SingedLog{}, ItCryptoError{Des: "Could not countersign log.", Err: err}
+	}
+	countersignature, err := JwsFromBytes([]byte(object.FullSerialize()))
+	if err != nil {
+		return SingedLog{}, err
+	}
+
+	signatures := append(append([]Signature{}, JWS(log).AllSignatures()...), countersignature.AllSignatures()...)
+	return SingedLog(JWS(log).WithSignatures(signatures)), nil
+}
+
+// logSigners returns the ids of the users who claim to have signed the given log, in the order of the signatures.
+// *NOTE*: This function does not verify the signatures by any means.
+func logSigners(log SingedLog) ([]string, error) {
+	object, err := JWS(log).ToJsonWebSignature()
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not parse JWS", Err: err, Class: ClassMalformed}
+	}
+	monitor, err := claimedMonitor(log)
+	if err != nil {
+		return nil, err
+	}
+
+	var signers []string
+	for _, signature := range object.Signatures {
+		signer := signature.Protected.KeyID
+		if signer == "" {
+			signer = monitor
+		}
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// verifyLogSignatures verifies all signatures of the given log. Each signature must be created by a distinct monitor
+// and the monitor specified in the log must be one of them. At least options.Threshold of the signing monitors must
+// be listed in options.Monitors (if set). It returns the signing monitors in the order of their signatures.
+func verifyLogSignatures(log SingedLog, monitor string, fetchUser FetchUser, options Options) ([]Signer, error) {
+	object, err := JWS(log).ToJsonWebSignature()
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not parse JWS", Err: err, Class: ClassMalformed}
+	}
+	signers, err := logSigners(log)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := JWS(log).PayloadBytes()
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not decode payload in jwsAccessLog", Err: err, Class: ClassMalformed}
+	}
+
+	var verified []Signer
+	counted := 0
+	for i, signature := range object.Signatures {
+		if slices.Contains(signers[:i], signers[i]) {
+			return nil, ItCryptoError{Des: "Malformed data: Log is signed multiple times by " + signers[i] + ".", Class: ClassMalformed}
+		}
+
+		sender := fetchUser(signers[i])
+		if !sender.IsMonitor {
+			return nil, ItCryptoError{Des: "Claimed monitor is not authorized to sign logs.", Err: nil, Class: ClassAuthorization}
+		}
+		if sender.VerificationCertificate == nil {
+			return nil, ItCryptoError{Des: "Could not resolve verification certificate of monitor", Err: nil, Class: ClassCertificate}
+		}
+
+		// Verify each signature on its own
+		single := object
+		single.Signatures = []jose.Signature{signature}
+		err = single.DetachedVerify(payload, sender.VerificationCertificate)
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not verify signature of jwsAccessLog", Err: err, Class: ClassSignature}
+		}
+
+		verified = append(verified, Signer{User: sender, Algorithm: signature.Protected.Algorithm})
+		if options.Monitors == nil || slices.Contains(options.Monitors, signers[i]) {
+			counted++
+		}
+	}
+
+	if !slices.Contains(signers, monitor) {
+		return nil, ItCryptoError{Des: "Malformed data: Log is not signed by its monitor.", Class: ClassSignature}
+	}
+	if counted < options.threshold() {
+		return nil, ItCryptoError{Des: fmt.Sprintf("Malformed data: Log is signed by %d of %d required monitors.", counted, options.threshold()), Class: ClassSignature}
+	}
+	return verified, nil
+}
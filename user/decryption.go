@@ -3,188 +3,361 @@ package user
 import (
 	"encoding/base64"
 	"encoding/json"
-	"golang.org/x/exp/slices"
-	"reflect"
+	"fmt"
+	"time"
 
 	. "github.com/haggj/go-it-crypto/error"
 	. "github.com/haggj/go-it-crypto/logs"
-	"gopkg.in/square/go-jose.v2"
+	"github.com/haggj/go-it-crypto/observability"
+	"golang.org/x/exp/slices"
 )
 
 type FetchUser func(string) RemoteUser
 
+// decryptedToken holds the verified content of a JWE token.
+type decryptedToken struct {
+	jwsSharedLog JWS
+	sharedLog    SharedLog
+	chain        []SharedLog
+	accessLog    AccessLog
+	creator      Signer
+	log          embeddedLog
+	version      int
+	headers      map[string]interface{}
+	delegator    string
+	quorum       []string
+	checks       []Check
+}
+
 // Decrypt takes a given JWE token and decrypts it by means of the Inverse Transparency E2EE.
 // It tries to decrypt the given token with the key material provided by the passed receiving user.
 // This function returns a SignedAccessLog if all verification steps are successful.
 func Decrypt(jwe string, receiver AuthenticatedUser, fetchUser FetchUser) (SingedLog, error) {
+	return DecryptWithOptions(jwe, receiver, fetchUser, Options{})
+}
+
+// DecryptWithOptions works like Decrypt but allows to configure optional behaviour, e.g. the SharingPolicy.
+func DecryptWithOptions(jwe string, receiver AuthenticatedUser, fetchUser FetchUser, options Options) (SingedLog, error) {
+	token, err := decryptToken(jwe, receiver, fetchUser, options)
+	if err != nil {
+		return SingedLog{}, err
+	}
+	return token.sharedLog.Log, nil
+}
+
+// DecryptDisclosable decrypts the given JWE token like Decrypt and returns the log together with the disclosures
+// contained in the token. Use it to decrypt logs which were signed in selective disclosure mode.
+func DecryptDisclosable(jwe string, receiver AuthenticatedUser, fetchUser FetchUser, options Options) (DisclosableLog, error) {
+	token, err := decryptToken(jwe, receiver, fetchUser, options)
+	if err != nil {
+		return DisclosableLog{}, err
+	}
+	return DisclosableLog{Log: token.sharedLog.Log, Disclosures: token.sharedLog.Disclosures}, nil
+}
+
+// decryptToken decrypts the given JWE token and performs all verification steps.
+func decryptToken(jwe string, receiver AuthenticatedUser, fetchUser FetchUser, options Options) (token decryptedToken, err error) {
+	operation := observability.Begin(options.Observer, "decrypt")
+	defer func() { operation.End(err) }()
+	fetchUser = observedFetchUser(operation, fetchUser)
 
 	// Parse and decrypt the given JWE
-	object, err := jose.ParseEncrypted(jwe)
+	finish := operation.Stage(observability.StageJweDecrypt)
+	plaintext, metadata, err := decryptPayload(jwe, receiver)
+	finish(err)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Failed to parse JWE", Err: err}
+		return decryptedToken{}, err
 	}
+	return verifyToken(operation, plaintext, metadata, receiver, nil, fetchUser, options)
+}
 
-	_, header, plaintext, err := object.DecryptMulti(receiver.DecryptionKey)
+// verifyToken performs all verification steps on the decrypted plaintext of a JWE token and its headers.
+// quorum lists the recipients whose partial decryptions were combined to decrypt the token. It is empty if the
+// token was decrypted with the key of the receiver.
+func verifyToken(operation *observability.Operation, plaintext []byte, metadata map[string]interface{}, receiver AuthenticatedUser, quorum []string, fetchUser FetchUser, options Options) (decryptedToken, error) {
+	// Dispatch on the protocol version of the token. Tokens of unsupported versions are rejected before their
+	// plaintext is parsed.
+	version, err := versionFromHeader(metadata)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Failed to decrypt JWE", Err: err}
+		return decryptedToken{}, err
 	}
+	capsule, reEncryptable, err := capsuleFromHeader(metadata)
+	if err != nil {
+		return decryptedToken{}, err
+	}
+	if reEncryptable && version < Version4 {
+		return decryptedToken{}, ItCryptoError{Des: fmt.Sprintf("Malformed data: Token of protocol version %d uses features of version %d.", version, Version4), Class: ClassVersion}
+	}
+	checks := []Check{CheckJweDecryption, CheckVersion}
 
 	// Parse the jwsSharedLog which is stored within the JWE plaintext
 	var obj interface{}
 	err = json.Unmarshal(plaintext, &obj)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Could not deserialize plaintext", Err: err}
+		return decryptedToken{}, ItCryptoError{Des: "Could not deserialize plaintext", Err: err, Class: ClassMalformed}
 	}
 	jwsSharedLog, err := JwsFromBytes(plaintext)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Could not parse jwsSharedLog", Err: err}
+		return decryptedToken{}, ItCryptoError{Des: "Could not parse jwsSharedLog", Err: err, Class: ClassMalformed}
 	}
 
 	// Extract the creator specified within the SharedLog.
 	// The SharedLog is expected to be signed by this creator.
 	creator, err := claimedCreator(jwsSharedLog)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Failed to extract creator", Err: err}
+		return decryptedToken{}, ItCryptoError{Des: "Failed to extract creator", Err: err, Class: ClassMalformed}
 	}
 
-	sharedLog, err := verifySharedLog(jwsSharedLog, fetchUser(creator))
+	creatorUser := fetchUser(creator)
+	finish := operation.Stage(observability.StageVerifySignature)
+	sharedLog, err := verifySharedLog(jwsSharedLog, creatorUser)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Could not verify sharedHeader", Err: err}
+		finish(err)
+		return decryptedToken{}, ItCryptoError{Des: "Could not verify sharedHeader", Err: err}
 	}
+	checks = append(checks, CheckCreatorSignature)
 
-	// Extract the monitor specified within the AccessLog.
-	// The AccessLog is expected to be signed by this monitor
-	jwsAccessLog := sharedLog.Log
-	monitor, err := claimedMonitor(jwsAccessLog)
+	// Verify the chain of SharedLogs this log was forwarded from.
+	// The first element of the chain is the SharedLog of the original sharer.
+	chain, err := verifyDelegationChain(sharedLog, fetchUser, options.MaxHops)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Failed to extract monitor", Err: err}
+		finish(err)
+		return decryptedToken{}, err
+	}
+	if len(chain) > 0 {
+		checks = append(checks, CheckDelegationChain)
 	}
 
-	accessLog, err := verifyAccessLog(JWS(jwsAccessLog), fetchUser(monitor))
+	// Verify that the embedded AccessLog is signed by an authorized monitor
+	log, err := verifyEmbeddedLogDetails(sharedLog, fetchUser, options)
+	finish(err)
 	if err != nil {
-		return SingedLog{}, ItCryptoError{Des: "Could not verify accessLog", Err: err}
+		return decryptedToken{}, err
+	}
+	accessLog := log.accessLog
+	checks = append(checks, CheckMonitorSignatures)
+	if !log.timestamp.IsZero() {
+		checks = append(checks, CheckTimestamp)
+	}
+	if len(sharedLog.Disclosures) > 0 {
+		checks = append(checks, CheckDisclosures)
 	}
 
-	// Verify that the recipients in the SharedLog are equal to the recipients in the metadata
-	metaRecipientsRaw, ok := header.ExtraHeaders["recipients"].([]interface{})
-	if !ok {
-		return SingedLog{}, ItCryptoError{Des: "Could not extract recipients from metadata", Err: nil}
+	// Verify that the recipients in the SharedLog are equal to the recipients in the metadata.
+	// Both are treated as sets, such that their order does not matter.
+	// If the recipients are hidden, they are only listed within the SharedLog.
+	if hasDuplicates(sharedLog.Recipients) {
+		return decryptedToken{}, ItCryptoError{Des: "Malformed data: Recipients are specified multiple times!", Class: ClassMalformed}
 	}
 
-	metaRecipients := make([]string, len(metaRecipientsRaw))
-	for i := range metaRecipientsRaw {
-		metaRecipients[i] = metaRecipientsRaw[i].(string)
+	hidden, err := hiddenRecipientsFromHeader(metadata)
+	if err != nil {
+		return decryptedToken{}, err
 	}
+	err = verifyVersion(version, sharedLog, hidden)
+	if err != nil {
+		return decryptedToken{}, err
+	}
+	if !hidden {
+		metaRecipients, err := recipientsFromHeader(metadata)
+		if err != nil {
+			return decryptedToken{}, err
+		}
+
+		if hasDuplicates(metaRecipients) {
+			return decryptedToken{}, ItCryptoError{Des: "Malformed data: Recipients are specified multiple times!", Class: ClassMalformed}
+		}
 
-	if !reflect.DeepEqual(sharedLog.Recipients, metaRecipients) {
-		return SingedLog{}, ItCryptoError{Des: "Malformed data: Sets of recipients are not equal!"}
+		if !sameRecipients(sharedLog.Recipients, metaRecipients) {
+			return decryptedToken{}, ItCryptoError{Des: "Malformed data: Sets of recipients are not equal!", Class: ClassMalformed}
+		}
 	}
+	checks = append(checks, CheckRecipients)
 
-	// Verify that the decrypting user is part of the recipients
-	if !slices.Contains(sharedLog.Recipients, receiver.Id) {
-		return SingedLog{}, ItCryptoError{Des: "Malformed data: Decrypting user not specified in recipients!"}
+	// Verify that tokens which require a quorum were decrypted with the partial decryptions of enough recipients
+	err = verifyQuorum(sharedLog, metadata, quorum)
+	if err != nil {
+		return decryptedToken{}, err
+	}
+	if len(quorum) > 0 {
+		checks = append(checks, CheckQuorum)
 	}
 
 	// Verify that the owner in the AccessLog is equal to the owner in the metadata
-	metaOwner, ok := header.ExtraHeaders["owner"].(string)
-	if !ok {
-		return SingedLog{}, ItCryptoError{Des: "Could not extract owner from metadata", Err: nil}
+	metaOwner, err := ownerFromHeader(metadata)
+	if err != nil {
+		return decryptedToken{}, err
 	}
 
 	if metaOwner != accessLog.Owner {
-		return SingedLog{}, ItCryptoError{Des: "Malformed data: The specified owners are not equal!", Err: nil}
+		return decryptedToken{}, ItCryptoError{Des: "Malformed data: The specified owners are not equal!", Err: nil, Class: ClassMalformed}
 	}
+	checks = append(checks, CheckOwner)
 
-	// Verify if either accessLog.owner or accessLog.monitor shared the log
-	if !(sharedLog.Creator == accessLog.Monitor || sharedLog.Creator == accessLog.Owner) {
-		return SingedLog{}, ItCryptoError{Des: "Malformed data: Only the owner or the monitor of the AccessLog are allowed to share."}
-	}
-	if sharedLog.Creator == accessLog.Monitor {
-		if len(sharedLog.Recipients) != 1 || sharedLog.Recipients[0] != accessLog.Owner {
-			return SingedLog{}, ItCryptoError{Des: "Malformed data: Monitors can only share the data with the owner of the log."}
+	// Verify that a re-encrypted token was forwarded to the receiver with the authorization of a recipient.
+	// The policy is evaluated for this recipient.
+	policyReceiver, delegator := receiver.Id, ""
+	if reEncryptable && capsule.Precursor != "" {
+		delegator, err = verifyGrant(capsule, sharedLog, receiver, fetchUser)
+		if err != nil {
+			return decryptedToken{}, err
 		}
+		policyReceiver = delegator
+		checks = append(checks, CheckReEncryptionGrant)
 	}
 
-	return jwsAccessLog, nil
+	// Verify that the decrypting user is part of the recipients. This is enforced independently of the policy.
+	if !slices.Contains(sharedLog.Recipients, policyReceiver) {
+		return decryptedToken{}, ItCryptoError{Des: "Malformed data: Decrypting user not specified in recipients!", Class: ClassAuthorization}
+	}
+
+	// Verify that the sharing operation is allowed by the configured policy
+	finish = operation.Stage(observability.StagePolicy)
+	err = options.policy().Evaluate(SharingContext{
+		AccessLog:  accessLog,
+		SharedLog:  sharedLog,
+		Chain:      chain,
+		Creator:    creatorUser,
+		Recipients: sharedLog.Recipients,
+		Receiver:   policyReceiver,
+		Delegate:   receiver.Id,
+	})
+	finish(err)
+	if err != nil {
+		return decryptedToken{}, err
+	}
+	checks = append(checks, CheckPolicy)
+
+	return decryptedToken{
+		jwsSharedLog: jwsSharedLog,
+		sharedLog:    sharedLog,
+		chain:        chain,
+		accessLog:    accessLog,
+		creator:      Signer{User: creatorUser, Algorithm: signatureAlgorithm(jwsSharedLog)},
+		log:          log,
+		version:      version,
+		headers:      metadata,
+		delegator:    delegator,
+		quorum:       quorum,
+		checks:       checks,
+	}, nil
 }
 
 // claimedCreator tries to parse the provided JWS token into a SharedLog.
 // If this is successful, the function returns the creator stored in the SharedLog object.
 // *NOTE*: This function does not verify the JWS token by any means.
 func claimedCreator(jwsSharedLog JWS) (string, error) {
+	sharedLog, err := claimedSharedLog(jwsSharedLog)
+	if err != nil {
+		return "", err
+	}
+	return sharedLog.Creator, nil
+}
+
+// claimedSharedLog tries to parse the provided JWS token into a SharedLog.
+// *NOTE*: This function does not verify the JWS token by any means.
+func claimedSharedLog(jwsSharedLog JWS) (SharedLog, error) {
 	rawJson, err := base64.RawURLEncoding.DecodeString(jwsSharedLog.Payload)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not base64 decode payload in jwsSharedLog", Err: err}
+		return SharedLog{}, ItCryptoError{Des: "Could not base64 decode payload in jwsSharedLog", Err: err, Class: ClassMalformed}
 	}
 	sharedLog, err := SharedLogFromJson(rawJson)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not deserialize payload in jwsSharedLog", Err: err}
+		return SharedLog{}, ItCryptoError{Des: "Could not deserialize payload in jwsSharedLog", Err: err, Class: ClassMalformed}
 	}
-	return sharedLog.Creator, nil
+	return sharedLog, nil
 }
 
 // claimedMonitor tries to parse the provided JWS token into a AccessLog.
 // If this is successful, the function returns the monitor stored in the AccessLog object.
 // *NOTE*: This function does not verify the JWS token by any means.
 func claimedMonitor(jwsAccessLog SingedLog) (string, error) {
-	rawJson, err := base64.RawURLEncoding.DecodeString(jwsAccessLog.Payload)
+	rawJson, err := JWS(jwsAccessLog).PayloadBytes()
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not base64 decode payload in jwsAccessLog", Err: err}
+		return "", ItCryptoError{Des: "Could not decode payload in jwsAccessLog", Err: err, Class: ClassMalformed}
 	}
 	accessLog, err := AccessLogFromJson(rawJson)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not deserialize payload in jwsAccessLog", Err: err}
+		return "", ItCryptoError{Des: "Could not deserialize payload in jwsAccessLog", Err: err, Class: ClassMalformed}
 	}
 	return accessLog.Monitor, nil
 }
 
-// verifySharedLog verifies if the provided JWS token is singed by the specified sender.
-// It then tries to parse the JWS token into a SharedLog object.
-func verifySharedLog(jwsSharedLog JWS, sender RemoteUser) (SharedLog, error) {
+// verifyEmbeddedLog verifies the SingedLog embedded in the given SharedLog and returns the contained AccessLog.
+// If the log was signed in selective disclosure mode, only fields disclosed by the SharedLog are set.
+// If a TimestampAuthority is configured, the log must contain a valid timestamp of this authority.
+func verifyEmbeddedLog(sharedLog SharedLog, fetchUser FetchUser, options Options) (AccessLog, error) {
+	log, err := verifyEmbeddedLogDetails(sharedLog, fetchUser, options)
+	return log.accessLog, err
+}
 
-	// Parse JWS into correct object
-	verify, err := jwsSharedLog.ToJsonWebSignature()
+// embeddedLog holds the verified content of the SingedLog embedded in a SharedLog.
+type embeddedLog struct {
+	accessLog AccessLog
+	monitor   Signer
+	signers   []Signer
+	timestamp time.Time
+}
+
+// verifyEmbeddedLogDetails works like verifyEmbeddedLog but additionally returns the signers of the log and its
+// timestamp, if it was verified.
+func verifyEmbeddedLogDetails(sharedLog SharedLog, fetchUser FetchUser, options Options) (embeddedLog, error) {
+
+	// Extract the monitor specified within the AccessLog.
+	// The AccessLog is expected to be signed by this monitor
+	monitor, err := claimedMonitor(sharedLog.Log)
 	if err != nil {
-		return SharedLog{}, ItCryptoError{Des: "Could not parse JWS", Err: err}
+		return embeddedLog{}, ItCryptoError{Des: "Failed to extract monitor", Err: err, Class: ClassMalformed}
 	}
 
-	// Verify signature of passed jwsSharedHeader
-	payload, err := verify.Verify(sender.VerificationCertificate)
+	var log embeddedLog
+	log.signers, err = verifyLogSignatures(sharedLog.Log, monitor, fetchUser, options)
 	if err != nil {
-		return SharedLog{}, ItCryptoError{Des: "Could not verify signature of jwsSharedLog", Err: err}
+		return embeddedLog{}, ItCryptoError{Des: "Could not verify accessLog", Err: err}
+	}
+	for _, signer := range log.signers {
+		if signer.User.Id == monitor {
+			log.monitor = signer
+		}
 	}
 
-	// Parse payload into SharedHeader object
-	sharedLog, err := SharedLogFromJson(payload)
+	if options.TimestampAuthority != nil {
+		log.timestamp, err = VerifyTimestamp(sharedLog.Log, options.TimestampAuthority)
+		if err != nil {
+			return embeddedLog{}, err
+		}
+	}
+
+	log.accessLog, err = DisclosableLog{Log: sharedLog.Log, Disclosures: sharedLog.Disclosures}.Extract()
 	if err != nil {
-		return SharedLog{}, ItCryptoError{Des: "Could not deserialize payload in jwsSharedLog", Err: err}
+		return embeddedLog{}, ItCryptoError{Des: "Could not verify disclosures", Err: err}
 	}
-	return sharedLog, nil
+	return log, nil
 }
 
-// verifyAccessLog verifies if the provided JWS token is singed by the specified sender.
-// It then tries to parse the JWS token into a AccessLog object.
-func verifyAccessLog(jwsAccessLog JWS, sender RemoteUser) (AccessLog, error) {
-	if !sender.IsMonitor {
-		return AccessLog{}, ItCryptoError{Des: "Claimed monitor is not authorized to sign logs.", Err: nil}
+// verifySharedLog verifies if the provided JWS token is singed by the specified sender.
+// It then tries to parse the JWS token into a SharedLog object.
+func verifySharedLog(jwsSharedLog JWS, sender RemoteUser) (SharedLog, error) {
+	if sender.VerificationCertificate == nil {
+		return SharedLog{}, ItCryptoError{Des: "Could not resolve verification certificate of creator", Err: nil, Class: ClassCertificate}
 	}
 
 	// Parse JWS into correct object
-	verify, err := jwsAccessLog.ToJsonWebSignature()
+	verify, err := jwsSharedLog.ToJsonWebSignature()
 	if err != nil {
-		return AccessLog{}, ItCryptoError{Des: "Could not parse JWS", Err: err}
+		return SharedLog{}, ItCryptoError{Des: "Could not parse JWS", Err: err, Class: ClassMalformed}
 	}
 
-	// Verify signature of passed jwsAccessLog
+	// Verify signature of passed jwsSharedHeader
 	payload, err := verify.Verify(sender.VerificationCertificate)
 	if err != nil {
-		return AccessLog{}, ItCryptoError{Des: "Could not verify signature of jwsAccessLog", Err: err}
+		return SharedLog{}, ItCryptoError{Des: "Could not verify signature of jwsSharedLog", Err: err, Class: ClassSignature}
 	}
 
 	// Parse payload into SharedHeader object
-	accessLog, err := AccessLogFromJson(payload)
+	sharedLog, err := SharedLogFromJson(payload)
 	if err != nil {
-		return AccessLog{}, ItCryptoError{Des: "Could not deserialize payload in jwsAccessLog", Err: err}
+		return SharedLog{}, ItCryptoError{Des: "Could not deserialize payload in jwsSharedLog", Err: err, Class: ClassMalformed}
 	}
-	return accessLog, nil
+	return sharedLog, nil
 }
@@ -0,0 +1,95 @@
+package user
+
+import (
+	"reflect"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+)
+
+// DelegatedLog is the result of decrypting a log in delegation mode.
+// It contains everything a recipient needs to forward the log to others.
+type DelegatedLog struct {
+	// Log is the AccessLog signed by the monitor.
+	Log SingedLog
+	// SharedLog is the signed SharedLog which was encrypted within the decrypted JWE token.
+	SharedLog JWS
+	// Provenance lists the creators of all SharedLogs, starting with the original sharer
+	// (owner or monitor) and ending with the user who encrypted the decrypted JWE token.
+	Provenance []string
+}
+
+// Hops returns how often the log was forwarded by recipients.
+func (log DelegatedLog) Hops() int {
+	return len(log.Provenance) - 1
+}
+
+// DecryptDelegated decrypts the given JWE token in delegation mode. In contrast to Decrypt, it accepts logs which
+// were forwarded by recipients. The chain of forwards is verified back to the original sharer and may contain
+// at most options.MaxHops forwards.
+func DecryptDelegated(jwe string, receiver AuthenticatedUser, fetchUser FetchUser, options Options) (DelegatedLog, error) {
+	token, err := decryptToken(jwe, receiver, fetchUser, options)
+	if err != nil {
+		return DelegatedLog{}, err
+	}
+
+	var provenance []string
+	for _, sharedLog := range token.chain {
+		provenance = append(provenance, sharedLog.Creator)
+	}
+	provenance = append(provenance, token.sharedLog.Creator)
+
+	return DelegatedLog{
+		Log:        token.sharedLog.Log,
+		SharedLog:  token.jwsSharedLog,
+		Provenance: provenance,
+	}, nil
+}
+
+// Forward encrypts a DelegatedLog for the specified set of receivers in the name of the passed sender.
+// The sender needs to be a recipient of the DelegatedLog. The signed SharedLog of the DelegatedLog is embedded into
+// the new SharedLog, which allows receivers to verify the full chain of forwards.
+func Forward(log DelegatedLog, sender AuthenticatedUser, receivers []RemoteUser, fetchUser FetchUser, options Options) (string, error) {
+	if log.Hops() >= options.MaxHops {
+		return "", ItCryptoError{Des: "Forwarding the log exceeds the maximum number of hops.", Class: ClassAuthorization}
+	}
+
+	parent := log.SharedLog
+	return encrypt(SharedLog{Log: log.Log, Parent: &parent}, sender, receivers, fetchUser, options)
+}
+
+// verifyDelegationChain verifies the chain of SharedLogs the given SharedLog was forwarded from.
+// Each SharedLog within the chain must be signed by its creator, contain the same log and list the creator of
+// the following SharedLog as a recipient. The returned chain starts with the SharedLog of the original sharer and
+// does not contain the given SharedLog itself.
+func verifyDelegationChain(sharedLog SharedLog, fetchUser FetchUser, maxHops int) ([]SharedLog, error) {
+	var chain []SharedLog
+	current := sharedLog
+	for current.Parent != nil {
+		if len(chain) >= maxHops {
+			return nil, ItCryptoError{Des: "Malformed data: The log was forwarded more often than allowed.", Class: ClassAuthorization}
+		}
+
+		creator, err := claimedCreator(*current.Parent)
+		if err != nil {
+			return nil, ItCryptoError{Des: "Failed to extract creator of parent", Err: err, Class: ClassMalformed}
+		}
+		parent, err := verifySharedLog(*current.Parent, fetchUser(creator))
+		if err != nil {
+			return nil, ItCryptoError{Des: "Could not verify parent of sharedLog", Err: err}
+		}
+
+		if !reflect.DeepEqual(parent.Log, current.Log) {
+			return nil, ItCryptoError{Des: "Malformed data: Forwarded log does not match the log of its parent.", Class: ClassMalformed}
+		}
+		if !slices.Contains(parent.Recipients, current.Creator) {
+			return nil, ItCryptoError{Des: "Malformed data: Only recipients of a log are allowed to forward it.", Class: ClassAuthorization}
+		}
+
+		chain = append([]SharedLog{parent}, chain...)
+		current = parent
+	}
+	return chain, nil
+}
@@ -2,60 +2,139 @@ package user
 
 import (
 	"encoding/json"
+
 	. "github.com/haggj/go-it-crypto/error"
 	. "github.com/haggj/go-it-crypto/logs"
-	"gopkg.in/square/go-jose.v2"
+	"github.com/haggj/go-it-crypto/observability"
 )
 
 // Encrypt encrypts a given SingedLog for the specified set of receivers in the name of the passed sender.
 // This function might be used either by a monitor (which initially encrypts the log for the owner)
 // or by the owner (which wants to share the AccessLog with others).
-// The provided SingedLog is assumed to be signed by a monitor.
-func Encrypt(jwsSignedLog SingedLog, sender AuthenticatedUser, receivers []RemoteUser) (string, error) {
+// The provided SingedLog must be signed by a monitor. Its signature is verified with the keys resolved by fetchUser.
+// The function performs the same checks as Decrypt, such that it does not create tokens which receivers reject.
+func Encrypt(jwsSignedLog SingedLog, sender AuthenticatedUser, receivers []RemoteUser, fetchUser FetchUser) (string, error) {
+	return EncryptWithOptions(jwsSignedLog, sender, receivers, fetchUser, Options{})
+}
+
+// EncryptWithOptions works like Encrypt but allows to configure optional behaviour, e.g. the SharingPolicy.
+func EncryptWithOptions(jwsSignedLog SingedLog, sender AuthenticatedUser, receivers []RemoteUser, fetchUser FetchUser, options Options) (string, error) {
+	return encrypt(SharedLog{Log: jwsSignedLog}, sender, receivers, fetchUser, options)
+}
+
+// EncryptDisclosable encrypts a DisclosableLog for the specified set of receivers in the name of the passed sender.
+// Receivers can only see the fields of the log for which the DisclosableLog contains disclosures.
+func EncryptDisclosable(log DisclosableLog, sender AuthenticatedUser, receivers []RemoteUser, fetchUser FetchUser, options Options) (string, error) {
+	return encrypt(SharedLog{Log: log.Log, Disclosures: log.Disclosures}, sender, receivers, fetchUser, options)
+}
+
+// encrypt completes the given SharedLog with the sender and the receivers, signs it and encrypts it for the
+// specified set of receivers. The SharedLog needs to contain the SingedLog and might contain disclosures or the
+// signed SharedLog the log is forwarded from.
+func encrypt(sharedLog SharedLog, sender AuthenticatedUser, receivers []RemoteUser, fetchUser FetchUser, options Options) (jwe string, err error) {
+	operation := observability.Begin(options.Observer, "encrypt")
+	defer func() { operation.End(err) }()
+	fetchUser = observedFetchUser(operation, fetchUser)
+
+	receivers, err = normalizeReceivers(receivers)
+	if err != nil {
+		return "", err
+	}
+	if options.ProxyReEncryption && (len(receivers) != 1 || options.HideRecipients) {
+		return "", ItCryptoError{Des: "Proxy re-encryption requires a single receiver, which is not hidden."}
+	}
+	if options.Quorum != 0 && (options.Quorum < 1 || options.Quorum > len(receivers) || options.ProxyReEncryption) {
+		return "", ItCryptoError{Des: "Quorum needs to be between 1 and the number of receivers and can not be combined with proxy re-encryption."}
+	}
+
 	var receiverIds []string
 	for _, receiver := range receivers {
 		receiverIds = append(receiverIds, receiver.Id)
 	}
 
-	// Embed signed AccessLog into a SharedLog object and sign this object -> jwsSharedLog
-	sharedLog := SharedLog{Log: jwsSignedLog, Recipients: receiverIds, Creator: sender.Id}
-
-	data, err := json.Marshal(sharedLog)
+	// Verify that the log is signed by an authorized monitor
+	finish := operation.Stage(observability.StageVerifySignature)
+	accessLog, err := verifyEmbeddedLog(sharedLog, fetchUser, options)
+	finish(err)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not serialize sharedLog.", Err: err}
+		return "", err
 	}
 
-	jwsSharedLog, err := sender.SignData(data)
+	// Embed signed AccessLog into a SharedLog object and sign this object -> jwsSharedLog
+	sharedLog.Recipients = receiverIds
+	sharedLog.Creator = sender.Id
+	sharedLog.Quorum = options.Quorum
+
+	// Verify the chain of SharedLogs this log is forwarded from
+	finish = operation.Stage(observability.StagePolicy)
+	chain, err := verifyDelegationChain(sharedLog, fetchUser, options.MaxHops)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not sign sharedLog.", Err: err}
+		finish(err)
+		return "", err
 	}
 
-	// Sender creates the encrypted JWE
-	accessLog, err := FromSingedLog(jwsSignedLog)
+	// Verify that the sharing operation is allowed by the configured policy
+	err = options.policy().Evaluate(SharingContext{
+		AccessLog:  accessLog,
+		SharedLog:  sharedLog,
+		Chain:      chain,
+		Creator:    sender.RemoteUser,
+		Recipients: receiverIds,
+	})
+	finish(err)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not read provided accessLog.", Err: err}
+		return "", err
 	}
 
-	var recipients []jose.Recipient
-	for _, receiver := range receivers {
-		recipients = append(recipients, jose.Recipient{
-			Algorithm: jose.ECDH_ES_A256KW,
-			Key:       receiver.EncryptionCertificate,
-		})
+	var data []byte
+	if options.CanonicalJson {
+		data, err = CanonicalJson(sharedLog)
+	} else {
+		data, err = json.Marshal(sharedLog)
+	}
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize sharedLog.", Err: err}
 	}
 
-	var options jose.EncrypterOptions
-	options.WithHeader("recipients", receiverIds).WithHeader("owner", accessLog.Owner)
-
-	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, &options)
+	finish = operation.Stage(observability.StageSign)
+	jwsSharedLog, err := sender.SignData(data)
+	finish(err)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not instantiate encryption engine.", Err: err}
+		return "", ItCryptoError{Des: "Could not sign sharedLog.", Err: err}
 	}
 
-	jwe, err := encrypter.Encrypt([]byte(jwsSharedLog))
+	// Use the oldest protocol version which can represent the log, such that older receivers can read the token
+	version := requiredVersion(sharedLog, options.HideRecipients)
+	if options.ProxyReEncryption {
+		version = Version4
+	}
+	err = verifySupportedVersion(receivers, version)
 	if err != nil {
-		return "", ItCryptoError{Des: "Could not encrypt.", Err: err}
+		return "", err
 	}
 
-	return jwe.FullSerialize(), nil
+	// Sender creates the encrypted JWE
+	// The recipients are only listed within the encrypted SharedLog if they should be hidden
+	headers := map[string]interface{}{"owner": accessLog.Owner}
+	if version > Version1 {
+		headers[VersionHeader] = version
+	}
+	if options.HideRecipients {
+		headers["hiddenRecipients"] = true
+	} else {
+		headers["recipients"] = receiverIds
+	}
+	if options.Quorum > 0 {
+		headers[QuorumHeader] = options.Quorum
+	}
+	finish = operation.Stage(observability.StageJweEncrypt)
+	if options.ProxyReEncryption {
+		jwe, err = encryptReEncryptable([]byte(jwsSharedLog), receivers[0], headers)
+	} else if options.Quorum > 0 {
+		jwe, err = encryptQuorum([]byte(jwsSharedLog), receivers, headers, options.Quorum)
+	} else {
+		jwe, err = encryptPayload([]byte(jwsSharedLog), receivers, headers)
+	}
+	finish(err)
+	return jwe, err
 }
@@ -0,0 +1,184 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// encryptPayload encrypts the given payload for the specified set of receivers.
+// The headers are stored unencrypted in the protected header of the JWE token.
+func encryptPayload(payload []byte, receivers []RemoteUser, headers map[string]interface{}) (string, error) {
+	var recipients []jose.Recipient
+	for _, receiver := range receivers {
+		recipients = append(recipients, jose.Recipient{
+			Algorithm: jose.ECDH_ES_A256KW,
+			Key:       receiver.EncryptionCertificate,
+		})
+	}
+
+	var encrypterOptions jose.EncrypterOptions
+	for key, value := range headers {
+		encrypterOptions.WithHeader(jose.HeaderKey(key), value)
+	}
+
+	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, &encrypterOptions)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not instantiate encryption engine.", Err: err}
+	}
+
+	jwe, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not encrypt.", Err: err}
+	}
+
+	return jwe.FullSerialize(), nil
+}
+
+// encryptDirect encrypts the given payload with the given content encryption key (alg "dir"). The headers are
+// stored in the protected header, the unprotected headers in the unprotected header of the JWE token. Such tokens
+// contain the key material the receivers need to derive the key in their unprotected header.
+func encryptDirect(payload []byte, key []byte, headers map[string]interface{}, unprotected map[string]interface{}) (string, error) {
+	var encrypterOptions jose.EncrypterOptions
+	for name, value := range headers {
+		encrypterOptions.WithHeader(jose.HeaderKey(name), value)
+	}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, jose.Recipient{Algorithm: jose.DIRECT, Key: key}, &encrypterOptions)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not instantiate encryption engine.", Err: err}
+	}
+	object, err := encrypter.Encrypt(payload)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not encrypt.", Err: err}
+	}
+
+	var token map[string]interface{}
+	err = json.Unmarshal([]byte(object.FullSerialize()), &token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	delete(token, "encrypted_key")
+	if len(unprotected) > 0 {
+		token["unprotected"] = unprotected
+	}
+	result, err := json.Marshal(token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	return string(result), nil
+}
+
+// decryptPayload decrypts the given JWE token with the keys of the receiver.
+// It returns the plaintext and the non-standard headers of the token together with the key management algorithm
+// of the receiver (alg).
+func decryptPayload(jwe string, receiver AuthenticatedUser) ([]byte, map[string]interface{}, error) {
+	object, err := jose.ParseEncrypted(jwe)
+	if err != nil {
+		return nil, nil, ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+	}
+
+	// Tokens which require a quorum can only be decrypted with the shares of multiple recipients
+	if _, ok := object.Header.ExtraHeaders[SharesHeader]; ok {
+		return nil, nil, ItCryptoError{Des: "Token requires a quorum of recipients. Use CombineDecrypt.", Class: ClassDecryption}
+	}
+
+	// Tokens in proxy re-encryption mode are encrypted with the key of their capsule
+	var key interface{} = receiver.DecryptionKey
+	capsule, ok, err := capsuleFromHeader(extraHeaders(object.Header))
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		if object.Header.Algorithm != string(jose.DIRECT) {
+			return nil, nil, ItCryptoError{Des: "Malformed data: Token contains a capsule but does not use direct encryption.", Class: ClassMalformed}
+		}
+		key, err = decapsulate(capsule, receiver)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	header, plaintext, err := decryptMulti(object, key)
+	if err != nil {
+		return nil, nil, ItCryptoError{Des: "Failed to decrypt JWE", Err: err, Class: ClassDecryption}
+	}
+	headers := extraHeaders(header)
+	headers["alg"] = header.Algorithm
+	return plaintext, headers, nil
+}
+
+// decryptMulti decrypts the JWE object with the given key. go-jose panics on some malformed tokens, e.g. if the
+// encrypted key of a recipient is empty. Such panics are returned as errors.
+func decryptMulti(object *jose.JSONWebEncryption, key interface{}) (header jose.Header, plaintext []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("malformed JWE: %v", r)
+		}
+	}()
+	_, header, plaintext, err = object.DecryptMulti(key)
+	return header, plaintext, err
+}
+
+// TokenDigest returns the base64url-encoded SHA-256 digest of a JWE token. The digest covers the protected header,
+// the initialization vector, the ciphertext and the authentication tag as they appear in the token, such that
+// the compact and the JSON serialization of the same token have the same digest.
+func TokenDigest(jwe string) (string, error) {
+	_, err := jose.ParseEncrypted(jwe)
+	if err != nil {
+		return "", ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+	}
+
+	var raw rawJwe
+	jwe = strings.TrimSpace(jwe)
+	if strings.HasPrefix(jwe, "{") {
+		err = json.Unmarshal([]byte(jwe), &raw)
+		if err != nil {
+			return "", ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+		}
+	} else {
+		parts := strings.Split(jwe, ".")
+		raw = rawJwe{Protected: parts[0], Iv: parts[2], Ciphertext: parts[3], Tag: parts[4]}
+	}
+
+	digest := sha256.Sum256([]byte(strings.Join([]string{raw.Protected, raw.Iv, raw.Ciphertext, raw.Tag}, ".")))
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+// signJson signs the json-encoded value in the name of the signer.
+func signJson(signer AuthenticatedUser, value interface{}) (JWS, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return JWS{}, ItCryptoError{Des: "Could not serialize data", Err: err}
+	}
+
+	signedData, err := signer.SignData(data)
+	if err != nil {
+		return JWS{}, ItCryptoError{Des: "Could not sign data", Err: err}
+	}
+	return JwsFromBytes([]byte(signedData))
+}
+
+// verifyJson verifies that the JWS token was signed by the signer and deserializes its payload into value.
+func verifyJson(jws JWS, signer RemoteUser, value interface{}) error {
+	data, err := json.Marshal(jws)
+	if err != nil {
+		return ItCryptoError{Des: "Failed to serialize JWS", Err: err}
+	}
+
+	payload, err := signer.VerifyData(string(data))
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(payload, value)
+	if err != nil {
+		return ItCryptoError{Des: "Could not deserialize payload", Err: err, Class: ClassMalformed}
+	}
+	return nil
+}
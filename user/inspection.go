@@ -0,0 +1,197 @@
+package user
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// UnverifiedMetadata holds the public metadata of a JWE token, which can be read without any private key.
+//
+// **NOTE**: None of these values are verified. Anybody can create a JWE token with arbitrary metadata.
+// Only use them for tasks like routing and always confirm them by decrypting the token with Decrypt.
+//
+// If the token was created with hidden recipients, Recipients is empty and RecipientsHidden is set.
+// RecipientCount still reveals the number of recipients.
+type UnverifiedMetadata struct {
+	Owner             string
+	Recipients        []string
+	RecipientsHidden  bool
+	RecipientCount    int
+	Version           int
+	ContentEncryption string
+	KeyAlgorithms     []string
+	KeyIds            []string
+}
+
+// rawJwe represents the JSON serialization of a JWE token. It is used to read the headers of a token.
+type rawJwe struct {
+	Protected   string                 `json:"protected"`
+	Unprotected map[string]interface{} `json:"unprotected,omitempty"`
+	Header      map[string]interface{} `json:"header,omitempty"`
+	Recipients  []struct {
+		Header map[string]interface{} `json:"header,omitempty"`
+	} `json:"recipients,omitempty"`
+	Iv         string `json:"iv"`
+	Ciphertext string `json:"ciphertext"`
+	Tag        string `json:"tag"`
+}
+
+// InspectToken parses the given JWE token and returns its public metadata without decrypting it.
+// *NOTE*: This function does not verify the token by any means. Use Decrypt to verify the returned metadata.
+func InspectToken(jwe string) (UnverifiedMetadata, error) {
+	raw, err := parseRawJwe(jwe)
+	if err != nil {
+		return UnverifiedMetadata{}, err
+	}
+
+	var protected map[string]interface{}
+	rawProtected, err := base64.RawURLEncoding.DecodeString(raw.Protected)
+	if err != nil {
+		return UnverifiedMetadata{}, ItCryptoError{Des: "Could not base64 decode protected header", Err: err, Class: ClassMalformed}
+	}
+	err = json.Unmarshal(rawProtected, &protected)
+	if err != nil {
+		return UnverifiedMetadata{}, ItCryptoError{Des: "Could not deserialize protected header", Err: err, Class: ClassMalformed}
+	}
+
+	// Shared headers are stored in the protected and unprotected header
+	shared := map[string]interface{}{}
+	for key, value := range raw.Unprotected {
+		shared[key] = value
+	}
+	for key, value := range protected {
+		shared[key] = value
+	}
+
+	// Each recipient has its own header. A token with a single recipient stores it in the top-level header.
+	recipientHeaders := []map[string]interface{}{raw.Header}
+	if len(raw.Recipients) > 0 {
+		recipientHeaders = nil
+		for _, recipient := range raw.Recipients {
+			recipientHeaders = append(recipientHeaders, recipient.Header)
+		}
+	}
+
+	metadata := UnverifiedMetadata{RecipientCount: len(recipientHeaders)}
+	metadata.ContentEncryption, _ = shared["enc"].(string)
+
+	metadata.Version, err = versionFromHeader(shared)
+	if err != nil {
+		return UnverifiedMetadata{}, err
+	}
+	metadata.Owner, err = ownerFromHeader(shared)
+	if err != nil {
+		return UnverifiedMetadata{}, err
+	}
+	metadata.RecipientsHidden, err = hiddenRecipientsFromHeader(shared)
+	if err != nil {
+		return UnverifiedMetadata{}, err
+	}
+	if !metadata.RecipientsHidden {
+		metadata.Recipients, err = recipientsFromHeader(shared)
+		if err != nil {
+			return UnverifiedMetadata{}, err
+		}
+	}
+
+	for _, header := range recipientHeaders {
+		merged := map[string]interface{}{}
+		for key, value := range shared {
+			merged[key] = value
+		}
+		for key, value := range header {
+			merged[key] = value
+		}
+		algorithm, _ := merged["alg"].(string)
+		keyId, _ := merged["kid"].(string)
+		metadata.KeyAlgorithms = append(metadata.KeyAlgorithms, algorithm)
+		metadata.KeyIds = append(metadata.KeyIds, keyId)
+	}
+
+	return metadata, nil
+}
+
+// parseRawJwe parses the given JWE token (compact or JSON serialization) into a rawJwe object.
+func parseRawJwe(jwe string) (rawJwe, error) {
+	object, err := jose.ParseEncrypted(jwe)
+	if err != nil {
+		return rawJwe{}, ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+	}
+
+	var raw rawJwe
+	err = json.Unmarshal([]byte(object.FullSerialize()), &raw)
+	if err != nil {
+		return rawJwe{}, ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+	}
+	return raw, nil
+}
+
+// extraHeaders returns the non-standard values of the given JWE header.
+func extraHeaders(header jose.Header) map[string]interface{} {
+	extra := map[string]interface{}{}
+	for key, value := range header.ExtraHeaders {
+		extra[string(key)] = value
+	}
+	return extra
+}
+
+// protocolHeaders returns the headers of this protocol, e.g. the owner and the recipients, without the headers
+// go-jose adds to each token.
+func protocolHeaders(header map[string]interface{}) map[string]interface{} {
+	headers := map[string]interface{}{}
+	for key, value := range header {
+		switch key {
+		case "alg", "enc", "epk", CapsuleHeader, SharesHeader:
+		default:
+			headers[key] = value
+		}
+	}
+	return headers
+}
+
+// ownerFromHeader extracts the owner stored in the given JWE header.
+func ownerFromHeader(header map[string]interface{}) (string, error) {
+	owner, ok := header["owner"].(string)
+	if !ok {
+		return "", ItCryptoError{Des: "Could not extract owner from metadata", Err: nil}
+	}
+	return owner, nil
+}
+
+// hiddenRecipientsFromHeader returns true if the given JWE header indicates that the recipients are hidden.
+// A header must not specify hidden recipients and list recipients at the same time.
+func hiddenRecipientsFromHeader(header map[string]interface{}) (bool, error) {
+	rawHidden, ok := header["hiddenRecipients"]
+	if !ok {
+		return false, nil
+	}
+	hidden, ok := rawHidden.(bool)
+	if !ok {
+		return false, ItCryptoError{Des: "Could not extract hiddenRecipients from metadata", Err: nil}
+	}
+	if _, listed := header["recipients"]; hidden && listed {
+		return false, ItCryptoError{Des: "Malformed data: Recipients are hidden and listed in metadata!", Class: ClassMalformed}
+	}
+	return hidden, nil
+}
+
+// recipientsFromHeader extracts the recipients stored in the given JWE header.
+func recipientsFromHeader(header map[string]interface{}) ([]string, error) {
+	rawRecipients, ok := header["recipients"].([]interface{})
+	if !ok {
+		return nil, ItCryptoError{Des: "Could not extract recipients from metadata", Err: nil}
+	}
+
+	recipients := make([]string, len(rawRecipients))
+	for i := range rawRecipients {
+		recipient, ok := rawRecipients[i].(string)
+		if !ok {
+			return nil, ItCryptoError{Des: "Could not extract recipients from metadata", Err: nil}
+		}
+		recipients[i] = recipient
+	}
+	return recipients, nil
+}
@@ -0,0 +1,36 @@
+package user
+
+import (
+	"encoding/json"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// MigrateToken re-encrypts a token to new keys of its receiver, e.g. after the receiver rotated its encryption key.
+// The token is decrypted with the current keys of the receiver and verified like Decrypt. The signed SharedLog of
+// the token is then encrypted for the EncryptionCertificate of newKeys without signing it again, such that the
+// signatures of the creator, the monitors and the delegation chain are preserved. The headers of the token, e.g.
+// its owner, recipients and protocol version, are kept.
+// newKeys needs to belong to the receiver, i.e. have the same id.
+func MigrateToken(jwe string, receiver AuthenticatedUser, newKeys RemoteUser, fetchUser FetchUser, options Options) (string, error) {
+	if newKeys.Id != receiver.Id {
+		return "", ItCryptoError{Des: "Tokens can only be migrated to new keys of the same user.", Class: ClassAuthorization}
+	}
+	if newKeys.EncryptionCertificate == nil {
+		return "", ItCryptoError{Des: "Could not resolve encryption certificate of new keys", Class: ClassCertificate}
+	}
+
+	token, err := decryptToken(jwe, receiver, fetchUser, options)
+	if err != nil {
+		return "", err
+	}
+	if token.delegator != "" {
+		return "", ItCryptoError{Des: "Tokens which were re-encrypted by a proxy can not be migrated.", Class: ClassAuthorization}
+	}
+
+	jwsSharedLog, err := json.Marshal(token.jwsSharedLog)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize sharedLog.", Err: err}
+	}
+	return encryptPayload(jwsSharedLog, []RemoteUser{newKeys}, protocolHeaders(token.headers))
+}
@@ -0,0 +1,208 @@
+package user
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+)
+
+// Values of the "typ" header of JWE tokens which contain objections or responses.
+const (
+	objectionType         = "objection"
+	objectionResponseType = "objectionResponse"
+)
+
+// CreateObjection creates an objection of the owner against the given log. The log must be signed by a monitor
+// and the objecting user must be the owner of the log.
+func CreateObjection(log SingedLog, reason string, owner AuthenticatedUser, fetchUser FetchUser) (SignedObjection, error) {
+	accessLog, err := verifyEmbeddedLog(SharedLog{Log: log}, fetchUser, Options{})
+	if err != nil {
+		return SignedObjection{}, err
+	}
+	if accessLog.Owner != owner.Id {
+		return SignedObjection{}, ItCryptoError{Des: "Malformed data: Only the owner of a log can object to it.", Class: ClassAuthorization}
+	}
+
+	jws, err := signJson(owner, Objection{
+		Log:       log,
+		LogDigest: JWS(log).Digest(),
+		Owner:     owner.Id,
+		Reason:    reason,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return SignedObjection{}, ItCryptoError{Des: "Could not sign objection", Err: err}
+	}
+	return SignedObjection(jws), nil
+}
+
+// VerifyObjection verifies that the objection is signed by the owner of the referenced log and that the log is
+// signed by its monitor. It returns the verified Objection and the AccessLog it objects to.
+func VerifyObjection(objection SignedObjection, fetchUser FetchUser) (Objection, AccessLog, error) {
+	claimed, err := objection.Extract()
+	if err != nil {
+		return Objection{}, AccessLog{}, ItCryptoError{Des: "Failed to extract owner", Err: err, Class: ClassMalformed}
+	}
+
+	var result Objection
+	err = verifyJson(JWS(objection), fetchUser(claimed.Owner), &result)
+	if err != nil {
+		return Objection{}, AccessLog{}, ItCryptoError{Des: "Could not verify signature of objection", Err: err, Class: ClassSignature}
+	}
+
+	accessLog, err := verifyEmbeddedLog(SharedLog{Log: result.Log}, fetchUser, Options{})
+	if err != nil {
+		return Objection{}, AccessLog{}, err
+	}
+	if accessLog.Owner != result.Owner {
+		return Objection{}, AccessLog{}, ItCryptoError{Des: "Malformed data: Only the owner of a log can object to it.", Class: ClassAuthorization}
+	}
+	if JWS(result.Log).Digest() != result.LogDigest {
+		return Objection{}, AccessLog{}, ItCryptoError{Des: "Malformed data: Objection does not reference its log.", Class: ClassMalformed}
+	}
+	return result, accessLog, nil
+}
+
+// EncryptObjection encrypts an objection of the sender for the monitor of the log and the given officers,
+// e.g. a data-protection officer.
+func EncryptObjection(objection SignedObjection, sender AuthenticatedUser, fetchUser FetchUser, officers ...RemoteUser) (string, error) {
+	result, accessLog, err := VerifyObjection(objection, fetchUser)
+	if err != nil {
+		return "", err
+	}
+	if result.Owner != sender.Id {
+		return "", ItCryptoError{Des: "Malformed data: Only the owner of a log can object to it.", Class: ClassAuthorization}
+	}
+
+	receivers, err := normalizeReceivers(append([]RemoteUser{fetchUser(accessLog.Monitor)}, officers...))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(objection)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize objection", Err: err}
+	}
+	return encryptPayload(data, receivers, map[string]interface{}{"typ": objectionType, "owner": result.Owner})
+}
+
+// DecryptObjection decrypts a JWE token created by EncryptObjection and verifies the contained objection.
+func DecryptObjection(jwe string, receiver AuthenticatedUser, fetchUser FetchUser) (SignedObjection, Objection, error) {
+	plaintext, metadata, err := decryptPayload(jwe, receiver)
+	if err != nil {
+		return SignedObjection{}, Objection{}, err
+	}
+	if metadata["typ"] != objectionType {
+		return SignedObjection{}, Objection{}, ItCryptoError{Des: "Malformed data: Token does not contain an objection.", Class: ClassMalformed}
+	}
+
+	var objection SignedObjection
+	err = json.Unmarshal(plaintext, &objection)
+	if err != nil {
+		return SignedObjection{}, Objection{}, ItCryptoError{Des: "Could not deserialize objection", Err: err, Class: ClassMalformed}
+	}
+
+	result, _, err := VerifyObjection(objection, fetchUser)
+	if err != nil {
+		return SignedObjection{}, Objection{}, err
+	}
+	return objection, result, nil
+}
+
+// RespondToObjection creates the response of the monitor to the given objection. The decision should be either
+// ObjectionAccepted or ObjectionRejected. The response references the objection by its digest.
+func RespondToObjection(objection SignedObjection, decision string, message string, monitor AuthenticatedUser, fetchUser FetchUser) (SignedObjectionResponse, error) {
+	_, accessLog, err := VerifyObjection(objection, fetchUser)
+	if err != nil {
+		return SignedObjectionResponse{}, err
+	}
+	if accessLog.Monitor != monitor.Id {
+		return SignedObjectionResponse{}, ItCryptoError{Des: "Malformed data: Only the monitor of a log can respond to objections.", Class: ClassAuthorization}
+	}
+
+	jws, err := signJson(monitor, ObjectionResponse{
+		Objection: JWS(objection).Digest(),
+		Monitor:   monitor.Id,
+		Decision:  decision,
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return SignedObjectionResponse{}, ItCryptoError{Des: "Could not sign objection response", Err: err}
+	}
+	return SignedObjectionResponse(jws), nil
+}
+
+// VerifyObjectionResponse verifies that the response was signed by the monitor of the objected log and that it
+// answers the given objection.
+func VerifyObjectionResponse(response SignedObjectionResponse, objection SignedObjection, fetchUser FetchUser) (ObjectionResponse, error) {
+	_, accessLog, err := VerifyObjection(objection, fetchUser)
+	if err != nil {
+		return ObjectionResponse{}, err
+	}
+
+	var result ObjectionResponse
+	err = verifyJson(JWS(response), fetchUser(accessLog.Monitor), &result)
+	if err != nil {
+		return ObjectionResponse{}, ItCryptoError{Des: "Could not verify signature of objection response", Err: err, Class: ClassSignature}
+	}
+	if result.Monitor != accessLog.Monitor {
+		return ObjectionResponse{}, ItCryptoError{Des: "Malformed data: Only the monitor of a log can respond to objections.", Class: ClassAuthorization}
+	}
+	if result.Objection != JWS(objection).Digest() {
+		return ObjectionResponse{}, ItCryptoError{Des: "Malformed data: Response does not belong to the objection.", Class: ClassMalformed}
+	}
+	return result, nil
+}
+
+// EncryptObjectionResponse encrypts the response of the sender to the given objection for the objecting owner.
+func EncryptObjectionResponse(response SignedObjectionResponse, objection SignedObjection, sender AuthenticatedUser, fetchUser FetchUser) (string, error) {
+	result, err := VerifyObjectionResponse(response, objection, fetchUser)
+	if err != nil {
+		return "", err
+	}
+	if result.Monitor != sender.Id {
+		return "", ItCryptoError{Des: "Malformed data: Only the monitor of a log can respond to objections.", Class: ClassAuthorization}
+	}
+
+	claimed, err := objection.Extract()
+	if err != nil {
+		return "", err
+	}
+	receivers, err := normalizeReceivers([]RemoteUser{fetchUser(claimed.Owner)})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize objection response", Err: err}
+	}
+	return encryptPayload(data, receivers, map[string]interface{}{"typ": objectionResponseType})
+}
+
+// DecryptObjectionResponse decrypts a JWE token created by EncryptObjectionResponse and verifies that the contained
+// response answers the given objection.
+func DecryptObjectionResponse(jwe string, objection SignedObjection, receiver AuthenticatedUser, fetchUser FetchUser) (SignedObjectionResponse, ObjectionResponse, error) {
+	plaintext, metadata, err := decryptPayload(jwe, receiver)
+	if err != nil {
+		return SignedObjectionResponse{}, ObjectionResponse{}, err
+	}
+	if metadata["typ"] != objectionResponseType {
+		return SignedObjectionResponse{}, ObjectionResponse{}, ItCryptoError{Des: "Malformed data: Token does not contain an objection response.", Class: ClassMalformed}
+	}
+
+	var response SignedObjectionResponse
+	err = json.Unmarshal(plaintext, &response)
+	if err != nil {
+		return SignedObjectionResponse{}, ObjectionResponse{}, ItCryptoError{Des: "Could not deserialize objection response", Err: err, Class: ClassMalformed}
+	}
+
+	result, err := VerifyObjectionResponse(response, objection, fetchUser)
+	if err != nil {
+		return SignedObjectionResponse{}, ObjectionResponse{}, err
+	}
+	return response, result, nil
+}
@@ -0,0 +1,88 @@
+package user
+
+import (
+	"crypto/x509"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/observability"
+	"github.com/haggj/go-it-crypto/tsa"
+)
+
+// Options configures optional behaviour of the encryption and decryption functions.
+// The zero value selects the default behaviour.
+type Options struct {
+	// Policy decides whether a log may be shared. The DefaultPolicy is used if no policy is provided.
+	Policy SharingPolicy
+
+	// HideRecipients removes the ids of the recipients from the public JWE header. They are only listed within the
+	// encrypted SharedLog, such that only recipients learn with whom a log was shared.
+	HideRecipients bool
+	// MaxHops is the maximum number of times a log may be forwarded by recipients in delegation mode.
+	MaxHops int
+
+	// Timestamper obtains a trusted timestamp over the signature of logs signed with SignLogWithOptions.
+	Timestamper tsa.Timestamper
+	// TimestampAuthority is the certificate of the trusted time-stamping authority. If it is set, logs are only
+	// accepted if they contain a valid timestamp of this authority.
+	TimestampAuthority *x509.Certificate
+
+	// Threshold is the number of distinct monitors which need to sign a log (k-of-n). Defaults to 1, such that the
+	// signature of the monitor specified in the log is sufficient.
+	Threshold int
+	// Monitors restricts the monitors which count towards the Threshold (the n of k-of-n). All monitors count if it
+	// is nil. The monitor specified in the log always needs to sign it.
+	Monitors []string
+
+	// CanonicalJson signs the canonical JSON form (RFC 8785) of the AccessLog in SignLogWithOptions and of the
+	// SharedLog in the encryption functions, such that the signed bytes do not depend on this implementation.
+	CanonicalJson bool
+	// UnencodedPayload signs the AccessLog in SignLogWithOptions with an unencoded payload ("b64": false, RFC 7797).
+	// The payload is always canonical JSON, such that it can be detached and restored with SingedLog.Attach.
+	// Such logs require protocol version 3.
+	UnencodedPayload bool
+
+	// ProxyReEncryption encrypts tokens for a single receiver, such that a proxy, e.g. a mailbox, can re-encrypt
+	// them with a ReEncryptionKey of the receiver for its delegates. Such tokens require protocol version 4.
+	ProxyReEncryption bool
+	// Quorum encrypts logs such that they can only be decrypted if this number of receivers combine their partial
+	// decryptions (k-of-n, see CombineDecrypt). Such tokens require protocol version 5. Zero disables it.
+	Quorum int
+
+	// Observer receives the outcome and the latency of operations and their stages. Operations are not
+	// instrumented if it is nil.
+	Observer observability.Observer
+}
+
+// threshold returns the configured Threshold, which is at least 1.
+func (options Options) threshold() int {
+	if options.Threshold < 1 {
+		return 1
+	}
+	return options.Threshold
+}
+
+// policy returns the configured SharingPolicy or the DefaultPolicy.
+func (options Options) policy() SharingPolicy {
+	if options.Policy == nil {
+		return DefaultPolicy()
+	}
+	return options.Policy
+}
+
+// observedFetchUser wraps fetchUser, such that each call is measured as stage of the operation. Calls which do not
+// resolve the certificates of a user are reported as failures.
+func observedFetchUser(operation *observability.Operation, fetchUser FetchUser) FetchUser {
+	if operation == nil {
+		return fetchUser
+	}
+	return func(id string) RemoteUser {
+		finish := operation.Stage(observability.StageFetchUser)
+		remoteUser := fetchUser(id)
+		if remoteUser.EncryptionCertificate == nil && remoteUser.VerificationCertificate == nil {
+			finish(ItCryptoError{Des: "Could not resolve user", Class: ClassCertificate})
+		} else {
+			finish(nil)
+		}
+		return remoteUser
+	}
+}
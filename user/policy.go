@@ -0,0 +1,125 @@
+package user
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/slices"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+)
+
+// SharingContext contains all data a SharingPolicy can base its decision on.
+// During decryption all values are verified, during encryption they are provided by the sender.
+type SharingContext struct {
+	// AccessLog is the log which is shared.
+	AccessLog AccessLog
+	// SharedLog is the SharedLog which embeds the AccessLog.
+	SharedLog SharedLog
+	// Chain contains the SharedLogs the SharedLog was forwarded from, starting with the SharedLog of the
+	// original sharer. It is empty if the log was not forwarded.
+	Chain []SharedLog
+	// Creator is the user who created the SharedLog.
+	Creator RemoteUser
+	// Recipients are the ids of the users the SharedLog is intended for.
+	Recipients []string
+	// Receiver is the id of the decrypting user. It is empty if the policy is evaluated during encryption.
+	// If the token was re-encrypted by a proxy, Receiver is the recipient who issued the ReEncryptionKey.
+	Receiver string
+	// Delegate is the id of the decrypting user if the token was re-encrypted by a proxy. Otherwise it is equal
+	// to Receiver.
+	Delegate string
+}
+
+// Root returns the SharedLog of the original sharer.
+func (context SharingContext) Root() SharedLog {
+	if len(context.Chain) > 0 {
+		return context.Chain[0]
+	}
+	return context.SharedLog
+}
+
+// SharingPolicy decides whether a log may be shared. It is evaluated during encryption and decryption.
+// A policy returns an error if the sharing operation is not allowed.
+type SharingPolicy interface {
+	Evaluate(context SharingContext) error
+}
+
+// PolicyFunc is an adapter to use ordinary functions as SharingPolicy.
+type PolicyFunc func(context SharingContext) error
+
+// Evaluate calls fn(context).
+func (fn PolicyFunc) Evaluate(context SharingContext) error {
+	return fn(context)
+}
+
+// DefaultPolicy returns the policy which is applied if no other policy is configured. It enforces that:
+// - only the owner or the monitor of the AccessLog share the log
+// - monitors share the log only with the owner
+//
+// Independently of the configured policy, a log can only be decrypted by one of its recipients.
+func DefaultPolicy() SharingPolicy {
+	return PolicyFunc(defaultPolicy)
+}
+
+func defaultPolicy(context SharingContext) error {
+	root := context.Root()
+
+	// Verify if either accessLog.owner or accessLog.monitor shared the log
+	if !(root.Creator == context.AccessLog.Monitor || root.Creator == context.AccessLog.Owner) {
+		return ItCryptoError{Des: "Malformed data: Only the owner or the monitor of the AccessLog are allowed to share.", Class: ClassAuthorization}
+	}
+	if root.Creator == context.AccessLog.Monitor {
+		if len(root.Recipients) != 1 || root.Recipients[0] != context.AccessLog.Owner {
+			return ItCryptoError{Des: "Malformed data: Monitors can only share the data with the owner of the log.", Class: ClassAuthorization}
+		}
+	}
+	return nil
+}
+
+// AllPolicies combines the given policies. The returned policy allows sharing only if all policies allow it.
+// Use it to extend the DefaultPolicy with additional rules.
+func AllPolicies(policies ...SharingPolicy) SharingPolicy {
+	return PolicyFunc(func(context SharingContext) error {
+		for _, policy := range policies {
+			err := policy.Evaluate(context)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RequireQuorum returns a policy which only allows sharing logs that contain one of the given data types if at least
+// quorum recipients need to combine their partial decryptions (see Options.Quorum). The monitor can still share such
+// logs with the owner.
+func RequireQuorum(quorum int, dataTypes ...string) SharingPolicy {
+	return PolicyFunc(func(context SharingContext) error {
+		if context.SharedLog.Creator == context.AccessLog.Monitor && len(context.Chain) == 0 {
+			return nil
+		}
+		for _, dataType := range context.AccessLog.DataType {
+			if slices.Contains(dataTypes, dataType) && context.SharedLog.Quorum < quorum {
+				return ItCryptoError{Des: fmt.Sprintf("Policy violation: Logs containing %s require a quorum of %d recipients.", dataType, quorum), Class: ClassAuthorization}
+			}
+		}
+		return nil
+	})
+}
+
+// DenyResharing returns a policy which forbids re-sharing logs that contain one of the given data types.
+// Such logs can only be shared by the monitor with the owner.
+func DenyResharing(dataTypes ...string) SharingPolicy {
+	return PolicyFunc(func(context SharingContext) error {
+		if context.SharedLog.Creator == context.AccessLog.Monitor && len(context.Chain) == 0 {
+			return nil
+		}
+		for _, dataType := range context.AccessLog.DataType {
+			if slices.Contains(dataTypes, dataType) {
+				return ItCryptoError{Des: "Policy violation: Logs containing " + dataType + " must not be re-shared.", Class: ClassAuthorization}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,390 @@
+package user
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+	"golang.org/x/exp/slices"
+)
+
+// CapsuleHeader is the unprotected JWE header which holds the encapsulated content encryption key of a token which
+// was encrypted in proxy re-encryption mode. A proxy transforms the capsule to re-encrypt the token, such that the
+// protected header and the ciphertext stay unchanged.
+const CapsuleHeader = "capsule"
+
+// Capsule encapsulates the content encryption key of a token for a single receiver (see Options.ProxyReEncryption).
+// The key is derived from (r+u)·A, where A is the encryption key of the receiver, E = r·G and V = u·G.
+// S = u + r·h(E, V) proves that the capsule was created by the sender and not modified.
+// A re-encrypted capsule contains E' = rk·E and V' = rk·V, the Precursor of the ReEncryptionKey and the Grant of
+// the owner, but no S.
+type Capsule struct {
+	E         string       `json:"e"`
+	V         string       `json:"v"`
+	S         string       `json:"s,omitempty"`
+	Precursor string       `json:"precursor,omitempty"`
+	Grant     *SignedGrant `json:"grant,omitempty"`
+}
+
+// ReEncryptionKey allows a proxy, e.g. a mailbox, to re-encrypt the tokens of the owner for the delegate with
+// ReEncrypt. The proxy can not decrypt the tokens and the key does not reveal the keys of the owner or the delegate.
+//
+// *NOTE*: The key is derived from the long-term decryption key a of the owner. A proxy which colludes with the
+// delegate recovers a = rk·d and can decrypt all tokens of the owner, including tokens which were not encrypted in
+// proxy re-encryption mode. Thus, the owner needs to trust that the proxy and the delegate do not collude.
+type ReEncryptionKey struct {
+	Owner    string `json:"owner"`
+	Delegate string `json:"delegate"`
+	// Key is the base64url-encoded scalar rk = a·d⁻¹, where a is the decryption key of the owner and d is derived
+	// from the Precursor and the encryption key of the delegate.
+	Key string `json:"key"`
+	// Precursor is the base64url-encoded point X = x·G of a random scalar x.
+	Precursor string `json:"precursor"`
+	// Grant is the ReEncryptionGrant signed by the owner, which authorizes the delegate.
+	Grant SignedGrant `json:"grant"`
+}
+
+// NewReEncryptionKey creates a ReEncryptionKey, which allows a proxy to re-encrypt all tokens the owner receives in
+// proxy re-encryption mode for the delegate. If lifetime is not zero, the delegate only accepts re-encrypted tokens
+// within this lifetime.
+func NewReEncryptionKey(owner AuthenticatedUser, delegate RemoteUser, lifetime time.Duration) (ReEncryptionKey, error) {
+	if delegate.EncryptionCertificate == nil {
+		return ReEncryptionKey{}, ItCryptoError{Des: "Could not resolve encryption certificate of delegate", Class: ClassCertificate}
+	}
+	curve := owner.DecryptionKey.Curve
+	if delegate.EncryptionCertificate.Curve != curve {
+		return ReEncryptionKey{}, ItCryptoError{Des: "Owner and delegate need to use the same curve for proxy re-encryption.", Class: ClassCertificate}
+	}
+
+	// d = h(X, B, x·B) can be computed by the delegate as h(X, B, b·X)
+	x, err := randomScalar(curve)
+	if err != nil {
+		return ReEncryptionKey{}, err
+	}
+	precursor := newPoint(curve.ScalarBaseMult(x.Bytes()))
+	d := delegationScalar(curve, precursor, delegate.EncryptionCertificate, newPoint(curve.ScalarMult(delegate.EncryptionCertificate.X, delegate.EncryptionCertificate.Y, x.Bytes())))
+	rk := new(big.Int).Mul(owner.DecryptionKey.D, new(big.Int).ModInverse(d, curve.Params().N))
+	rk.Mod(rk, curve.Params().N)
+
+	grant := ReEncryptionGrant{Owner: owner.Id, Delegate: delegate.Id, Precursor: precursor.encode(curve)}
+	if lifetime != 0 {
+		grant.Expires = time.Now().Add(lifetime).Unix()
+	}
+	signedGrant, err := signJson(owner, grant)
+	if err != nil {
+		return ReEncryptionKey{}, ItCryptoError{Des: "Could not sign re-encryption grant", Err: err}
+	}
+
+	return ReEncryptionKey{
+		Owner:     owner.Id,
+		Delegate:  delegate.Id,
+		Key:       base64.RawURLEncoding.EncodeToString(rk.FillBytes(make([]byte, scalarSize(curve)))),
+		Precursor: grant.Precursor,
+		Grant:     SignedGrant(signedGrant),
+	}, nil
+}
+
+// VerifyReEncryptionKey verifies that the grant of the key was signed by the owner, belongs to the key and did not
+// expire. Proxies use it before they accept a key. It does not verify the Key itself, which only the owner knows.
+func VerifyReEncryptionKey(key ReEncryptionKey, owner RemoteUser) error {
+	var grant ReEncryptionGrant
+	err := verifyJson(JWS(key.Grant), owner, &grant)
+	if err != nil {
+		return ItCryptoError{Des: "Could not verify signature of re-encryption grant", Err: err, Class: ClassSignature}
+	}
+	if grant.Owner != owner.Id || grant.Owner != key.Owner || grant.Delegate != key.Delegate || grant.Precursor != key.Precursor {
+		return ItCryptoError{Des: "Malformed data: Re-encryption grant does not belong to the key.", Class: ClassMalformed}
+	}
+	if grant.Expires != 0 && time.Now().Unix() > grant.Expires {
+		return ItCryptoError{Des: "Re-encryption grant expired.", Class: ClassAuthorization}
+	}
+	return nil
+}
+
+// ReEncrypt transforms a token, which was encrypted for the owner of the key in proxy re-encryption mode, into a
+// token for the delegate of the key. It only replaces the capsule in the unprotected header, such that the
+// ciphertext and the signatures within the token stay unchanged.
+// *NOTE*: ReEncrypt does not decrypt the token, so the proxy can not verify the token.
+func ReEncrypt(jwe string, key ReEncryptionKey) (string, error) {
+	var token map[string]json.RawMessage
+	err := json.Unmarshal([]byte(jwe), &token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Token is not encrypted in proxy re-encryption mode", Err: err, Class: ClassMalformed}
+	}
+	metadata, err := InspectToken(jwe)
+	if err != nil {
+		return "", err
+	}
+	if metadata.RecipientsHidden || len(metadata.Recipients) != 1 || metadata.Recipients[0] != key.Owner {
+		return "", ItCryptoError{Des: "Token is not addressed to the owner of the re-encryption key.", Class: ClassAuthorization}
+	}
+
+	var unprotected map[string]json.RawMessage
+	err = json.Unmarshal(token["unprotected"], &unprotected)
+	if err != nil {
+		return "", ItCryptoError{Des: "Token is not encrypted in proxy re-encryption mode", Err: err, Class: ClassMalformed}
+	}
+	var capsule Capsule
+	err = json.Unmarshal(unprotected[CapsuleHeader], &capsule)
+	if err != nil {
+		return "", ItCryptoError{Des: "Token is not encrypted in proxy re-encryption mode", Err: err, Class: ClassMalformed}
+	}
+	if capsule.Precursor != "" {
+		return "", ItCryptoError{Des: "Token was already re-encrypted.", Class: ClassMalformed}
+	}
+
+	curve := elliptic.P256()
+	e, v, err := capsule.verify(curve)
+	if err != nil {
+		return "", err
+	}
+	rawKey, err := base64.RawURLEncoding.DecodeString(key.Key)
+	if err != nil || len(rawKey) != scalarSize(curve) {
+		return "", ItCryptoError{Des: "Could not decode re-encryption key", Err: err, Class: ClassMalformed}
+	}
+
+	grant := key.Grant
+	reEncrypted := Capsule{
+		E:         newPoint(curve.ScalarMult(e.x, e.y, rawKey)).encode(curve),
+		V:         newPoint(curve.ScalarMult(v.x, v.y, rawKey)).encode(curve),
+		Precursor: key.Precursor,
+		Grant:     &grant,
+	}
+	unprotected[CapsuleHeader], err = json.Marshal(reEncrypted)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize capsule", Err: err}
+	}
+	token["unprotected"], err = json.Marshal(unprotected)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	result, err := json.Marshal(token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	return string(result), nil
+}
+
+// encryptReEncryptable encrypts the given payload for a single receiver in proxy re-encryption mode.
+func encryptReEncryptable(payload []byte, receiver RemoteUser, headers map[string]interface{}) (string, error) {
+	curve := receiver.EncryptionCertificate.Curve
+	if curve != elliptic.P256() {
+		return "", ItCryptoError{Des: "Proxy re-encryption requires P-256 keys.", Class: ClassCertificate}
+	}
+
+	// Encapsulate the content encryption key (r+u)·A
+	r, err := randomScalar(curve)
+	if err != nil {
+		return "", err
+	}
+	u, err := randomScalar(curve)
+	if err != nil {
+		return "", err
+	}
+	e := newPoint(curve.ScalarBaseMult(r.Bytes()))
+	v := newPoint(curve.ScalarBaseMult(u.Bytes()))
+	s := new(big.Int).Mul(r, capsuleScalar(curve, e, v))
+	s.Add(s, u).Mod(s, curve.Params().N)
+	sum := new(big.Int).Add(r, u)
+	sum.Mod(sum, curve.Params().N)
+	key := capsuleKey(curve, newPoint(curve.ScalarMult(receiver.EncryptionCertificate.X, receiver.EncryptionCertificate.Y, sum.Bytes())))
+
+	// The capsule is stored in the unprotected header, such that a proxy can replace it
+	return encryptDirect(payload, key, headers, map[string]interface{}{CapsuleHeader: Capsule{
+		E: e.encode(curve),
+		V: v.encode(curve),
+		S: base64.RawURLEncoding.EncodeToString(s.FillBytes(make([]byte, scalarSize(curve)))),
+	}})
+}
+
+// capsuleFromHeader extracts the capsule of a token in proxy re-encryption mode from the given JWE header.
+// The second return value is false if the token does not contain a capsule.
+func capsuleFromHeader(header map[string]interface{}) (Capsule, bool, error) {
+	rawCapsule, ok := header[CapsuleHeader]
+	if !ok {
+		return Capsule{}, false, nil
+	}
+	data, err := json.Marshal(rawCapsule)
+	if err != nil {
+		return Capsule{}, true, ItCryptoError{Des: "Could not serialize capsule", Err: err}
+	}
+	var capsule Capsule
+	err = json.Unmarshal(data, &capsule)
+	if err != nil {
+		return Capsule{}, true, ItCryptoError{Des: "Could not deserialize capsule", Err: err, Class: ClassMalformed}
+	}
+	return capsule, true, nil
+}
+
+// decapsulate derives the content encryption key of a token in proxy re-encryption mode with the keys of the
+// receiver. Original capsules are decapsulated with a·(E+V), re-encrypted capsules with d·(E'+V').
+func decapsulate(capsule Capsule, receiver AuthenticatedUser) ([]byte, error) {
+	curve := receiver.DecryptionKey.Curve
+	if curve != elliptic.P256() {
+		return nil, ItCryptoError{Des: "Proxy re-encryption requires P-256 keys.", Class: ClassDecryption}
+	}
+
+	if capsule.Precursor == "" {
+		e, v, err := capsule.verify(curve)
+		if err != nil {
+			return nil, err
+		}
+		sum := newPoint(curve.Add(e.x, e.y, v.x, v.y))
+		return capsuleKey(curve, newPoint(curve.ScalarMult(sum.x, sum.y, receiver.DecryptionKey.D.Bytes()))), nil
+	}
+
+	// d = h(X, B, b·X) was computed by the owner as h(X, B, x·B)
+	e, err := decodePoint(curve, capsule.E)
+	if err != nil {
+		return nil, err
+	}
+	v, err := decodePoint(curve, capsule.V)
+	if err != nil {
+		return nil, err
+	}
+	precursor, err := decodePoint(curve, capsule.Precursor)
+	if err != nil {
+		return nil, err
+	}
+	d := delegationScalar(curve, precursor, &receiver.DecryptionKey.PublicKey, newPoint(curve.ScalarMult(precursor.x, precursor.y, receiver.DecryptionKey.D.Bytes())))
+	sum := newPoint(curve.Add(e.x, e.y, v.x, v.y))
+	return capsuleKey(curve, newPoint(curve.ScalarMult(sum.x, sum.y, d.Bytes()))), nil
+}
+
+// verifyGrant verifies that the grant of a re-encrypted capsule was issued by a recipient of the SharedLog for the
+// receiver and belongs to the capsule. It returns the id of the recipient who issued the grant.
+func verifyGrant(capsule Capsule, sharedLog SharedLog, receiver AuthenticatedUser, fetchUser FetchUser) (string, error) {
+	if capsule.Grant == nil {
+		return "", ItCryptoError{Des: "Malformed data: Re-encrypted token does not contain a grant.", Class: ClassMalformed}
+	}
+	claimed, err := capsule.Grant.Extract()
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not deserialize re-encryption grant", Err: err, Class: ClassMalformed}
+	}
+	var grant ReEncryptionGrant
+	err = verifyJson(JWS(*capsule.Grant), fetchUser(claimed.Owner), &grant)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not verify signature of re-encryption grant", Err: err, Class: ClassSignature}
+	}
+
+	if grant.Precursor != capsule.Precursor {
+		return "", ItCryptoError{Des: "Malformed data: Re-encryption grant does not belong to the token.", Class: ClassMalformed}
+	}
+	if grant.Delegate != receiver.Id {
+		return "", ItCryptoError{Des: "Malformed data: Re-encryption grant was issued for another user.", Class: ClassAuthorization}
+	}
+	if !slices.Contains(sharedLog.Recipients, grant.Owner) {
+		return "", ItCryptoError{Des: "Malformed data: Re-encryption grant was not issued by a recipient.", Class: ClassAuthorization}
+	}
+	if grant.Expires != 0 && time.Now().Unix() > grant.Expires {
+		return "", ItCryptoError{Des: "Re-encryption grant expired.", Class: ClassAuthorization}
+	}
+	return grant.Owner, nil
+}
+
+// point is a point on an elliptic curve.
+type point struct {
+	x, y *big.Int
+}
+
+func newPoint(x *big.Int, y *big.Int) point {
+	return point{x: x, y: y}
+}
+
+func (p point) encode(curve elliptic.Curve) string {
+	return base64.RawURLEncoding.EncodeToString(elliptic.Marshal(curve, p.x, p.y))
+}
+
+// decodePoint decodes a point and verifies that it is on the curve.
+func decodePoint(curve elliptic.Curve, encoded string) (point, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return point{}, ItCryptoError{Des: "Could not base64 decode point", Err: err, Class: ClassMalformed}
+	}
+	x, y := elliptic.Unmarshal(curve, data)
+	if x == nil {
+		return point{}, ItCryptoError{Des: "Capsule contains an invalid point", Class: ClassMalformed}
+	}
+	return newPoint(x, y), nil
+}
+
+// verify decodes the points of an original capsule and verifies that s·G = V + h(E, V)·E.
+func (capsule Capsule) verify(curve elliptic.Curve) (point, point, error) {
+	e, err := decodePoint(curve, capsule.E)
+	if err != nil {
+		return point{}, point{}, err
+	}
+	v, err := decodePoint(curve, capsule.V)
+	if err != nil {
+		return point{}, point{}, err
+	}
+	s, err := base64.RawURLEncoding.DecodeString(capsule.S)
+	if err != nil || len(s) != scalarSize(curve) {
+		return point{}, point{}, ItCryptoError{Des: "Could not decode capsule", Err: err, Class: ClassMalformed}
+	}
+
+	left := newPoint(curve.ScalarBaseMult(s))
+	hx, hy := curve.ScalarMult(e.x, e.y, capsuleScalar(curve, e, v).Bytes())
+	right := newPoint(curve.Add(v.x, v.y, hx, hy))
+	if left.x.Cmp(right.x) != 0 || left.y.Cmp(right.y) != 0 {
+		return point{}, point{}, ItCryptoError{Des: "Capsule is invalid", Class: ClassDecryption}
+	}
+	return e, v, nil
+}
+
+// capsuleKey derives the content encryption key from the encapsulated point.
+func capsuleKey(curve elliptic.Curve, p point) []byte {
+	key := sha256.Sum256(append([]byte("it-crypto capsule key"), elliptic.Marshal(curve, p.x, p.y)...))
+	return key[:]
+}
+
+// capsuleScalar returns h(E, V), which binds S to the points of a capsule.
+func capsuleScalar(curve elliptic.Curve, e point, v point) *big.Int {
+	return hashToScalar(curve, "it-crypto capsule", elliptic.Marshal(curve, e.x, e.y), elliptic.Marshal(curve, v.x, v.y))
+}
+
+// delegationScalar returns d = h(X, B, shared), which can be computed by the owner with x and by the delegate with b.
+func delegationScalar(curve elliptic.Curve, precursor point, delegate *ecdsa.PublicKey, shared point) *big.Int {
+	return hashToScalar(curve, "it-crypto delegation", elliptic.Marshal(curve, precursor.x, precursor.y),
+		elliptic.Marshal(curve, delegate.X, delegate.Y), elliptic.Marshal(curve, shared.x, shared.y))
+}
+
+// hashToScalar hashes the given data to a non-zero scalar of the curve.
+func hashToScalar(curve elliptic.Curve, domain string, data ...[]byte) *big.Int {
+	hash := sha512.New()
+	hash.Write([]byte(domain))
+	for _, value := range data {
+		hash.Write(value)
+	}
+	n := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	scalar := new(big.Int).SetBytes(hash.Sum(nil))
+	return scalar.Mod(scalar, n).Add(scalar, big.NewInt(1))
+}
+
+// randomScalar returns a random non-zero scalar of the curve.
+func randomScalar(curve elliptic.Curve) (*big.Int, error) {
+	n := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	scalar, err := rand.Int(rand.Reader, n)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate random scalar", Err: err}
+	}
+	return scalar.Add(scalar, big.NewInt(1)), nil
+}
+
+func scalarSize(curve elliptic.Curve) int {
+	return (curve.Params().BitSize + 7) / 8
+}
+
+// String returns a short description of the key, which does not contain the key itself.
+func (key ReEncryptionKey) String() string {
+	return fmt.Sprintf("ReEncryptionKey{Owner: %s, Delegate: %s}", key.Owner, key.Delegate)
+}
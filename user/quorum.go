@@ -0,0 +1,345 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/observability"
+	"golang.org/x/exp/slices"
+	"gopkg.in/square/go-jose.v2"
+)
+
+const (
+	// QuorumHeader is the JWE header which stores the number of recipients who need to combine their partial
+	// decryptions to decrypt a token (see Options.Quorum).
+	QuorumHeader = "quorum"
+	// SharesHeader is the unprotected JWE header which holds the shares of the content encryption key of a token
+	// which requires a quorum. Each share is encrypted for one recipient.
+	SharesHeader = "shares"
+)
+
+const (
+	// shareType is the value of the "typ" header of JWE tokens which contain a KeyShare.
+	shareType = "key-share"
+	// partialType is the value of the "typ" header of JWE tokens which contain a SignedKeyShare.
+	partialType = "partial-decryption"
+)
+
+// encryptQuorum encrypts the given payload such that quorum of the receivers need to combine their shares of the
+// content encryption key to decrypt it. The key is split with Shamir's secret sharing and each share is encrypted
+// for its receiver.
+func encryptQuorum(payload []byte, receivers []RemoteUser, headers map[string]interface{}, quorum int) (string, error) {
+	if len(receivers) > math.MaxUint8 {
+		return "", ItCryptoError{Des: fmt.Sprintf("A quorum can be required from at most %d receivers.", math.MaxUint8)}
+	}
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not generate content encryption key", Err: err}
+	}
+	jwe, err := encryptDirect(payload, key, headers, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// Each share is bound to the token by its digest
+	digest, err := TokenDigest(jwe)
+	if err != nil {
+		return "", err
+	}
+	shares, err := splitSecret(key, len(receivers), quorum)
+	if err != nil {
+		return "", err
+	}
+	var encryptedShares []string
+	for i, receiver := range receivers {
+		data, err := json.Marshal(KeyShare{
+			Token:     digest,
+			Recipient: receiver.Id,
+			Index:     i + 1,
+			Share:     base64.RawURLEncoding.EncodeToString(shares[i]),
+		})
+		if err != nil {
+			return "", ItCryptoError{Des: "Could not serialize key share", Err: err}
+		}
+		encryptedShare, err := encryptPayload(data, []RemoteUser{receiver}, map[string]interface{}{"typ": shareType})
+		if err != nil {
+			return "", err
+		}
+		encryptedShares = append(encryptedShares, encryptedShare)
+	}
+
+	var token map[string]interface{}
+	err = json.Unmarshal([]byte(jwe), &token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	token["unprotected"] = map[string]interface{}{SharesHeader: encryptedShares}
+	result, err := json.Marshal(token)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize token", Err: err}
+	}
+	return string(result), nil
+}
+
+// PartialDecrypt decrypts the share of the content encryption key of a token, which requires a quorum, with the
+// keys of the recipient. The share is signed by the recipient and encrypted for the combiner, who combines the
+// partial decryptions of the quorum with CombineDecrypt.
+// *NOTE*: The token itself can not be verified before a quorum of partial decryptions is combined.
+func PartialDecrypt(jwe string, recipient AuthenticatedUser, combiner RemoteUser) (string, error) {
+	if combiner.EncryptionCertificate == nil {
+		return "", ItCryptoError{Des: "Could not resolve encryption certificate of combiner", Class: ClassCertificate}
+	}
+	raw, err := parseRawJwe(jwe)
+	if err != nil {
+		return "", err
+	}
+	digest, err := TokenDigest(jwe)
+	if err != nil {
+		return "", err
+	}
+	encryptedShares, _ := raw.Unprotected[SharesHeader].([]interface{})
+	if len(encryptedShares) == 0 {
+		return "", ItCryptoError{Des: "Token does not require a quorum", Class: ClassMalformed}
+	}
+
+	// Each recipient can only decrypt its own share
+	for _, encryptedShare := range encryptedShares {
+		rawShare, ok := encryptedShare.(string)
+		if !ok {
+			return "", ItCryptoError{Des: "Could not extract key shares from metadata", Class: ClassMalformed}
+		}
+		plaintext, metadata, err := decryptPayload(rawShare, recipient)
+		if err != nil {
+			continue
+		}
+		if metadata["typ"] != shareType {
+			return "", ItCryptoError{Des: "Malformed data: Token does not contain a key share.", Class: ClassMalformed}
+		}
+
+		var share KeyShare
+		err = json.Unmarshal(plaintext, &share)
+		if err != nil {
+			return "", ItCryptoError{Des: "Could not deserialize key share", Err: err, Class: ClassMalformed}
+		}
+		if share.Token != digest || share.Recipient != recipient.Id {
+			return "", ItCryptoError{Des: "Malformed data: Key share does not belong to the token.", Class: ClassMalformed}
+		}
+
+		signedShare, err := signJson(recipient, share)
+		if err != nil {
+			return "", ItCryptoError{Des: "Could not sign key share", Err: err}
+		}
+		data, err := json.Marshal(signedShare)
+		if err != nil {
+			return "", ItCryptoError{Des: "Could not serialize key share", Err: err}
+		}
+		return encryptPayload(data, []RemoteUser{combiner}, map[string]interface{}{"typ": partialType})
+	}
+	return "", ItCryptoError{Des: "Token does not contain a key share for the user", Class: ClassDecryption}
+}
+
+// CombineDecrypt decrypts a token, which requires a quorum, with the partial decryptions of the recipients created
+// by PartialDecrypt for the combiner. It performs the same verification steps as Decrypt, such that the owner, the
+// recipients and all signatures of the token are verified. Additionally, it verifies that the partial decryptions
+// were signed by the required number of distinct recipients.
+func CombineDecrypt(jwe string, partials []string, combiner AuthenticatedUser, fetchUser FetchUser, options Options) (result VerifiedLog, err error) {
+	operation := observability.Begin(options.Observer, "combine_decrypt")
+	defer func() { operation.End(err) }()
+	fetchUser = observedFetchUser(operation, fetchUser)
+
+	finish := operation.Stage(observability.StageJweDecrypt)
+	plaintext, metadata, quorum, err := combinePartials(jwe, partials, combiner, fetchUser)
+	finish(err)
+	if err != nil {
+		return VerifiedLog{}, err
+	}
+
+	token, err := verifyToken(operation, plaintext, metadata, combiner, quorum, fetchUser, options)
+	if err != nil {
+		return VerifiedLog{}, err
+	}
+	return token.verified(), nil
+}
+
+// combinePartials verifies the partial decryptions, combines their shares and decrypts the token with the
+// resulting content encryption key. It returns the plaintext and the headers of the token together with the ids of
+// the recipients whose partial decryptions were combined.
+func combinePartials(jwe string, partials []string, combiner AuthenticatedUser, fetchUser FetchUser) ([]byte, map[string]interface{}, []string, error) {
+	object, err := jose.ParseEncrypted(jwe)
+	if err != nil {
+		return nil, nil, nil, ItCryptoError{Des: "Failed to parse JWE", Err: err, Class: ClassDecryption}
+	}
+	required, err := quorumFromHeader(extraHeaders(object.Header))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if required == 0 {
+		return nil, nil, nil, ItCryptoError{Des: "Token does not require a quorum", Class: ClassMalformed}
+	}
+	digest, err := TokenDigest(jwe)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var recipients []string
+	var indices []byte
+	var shares [][]byte
+	for _, partial := range partials {
+		plaintext, metadata, err := decryptPayload(partial, combiner)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if metadata["typ"] != partialType {
+			return nil, nil, nil, ItCryptoError{Des: "Malformed data: Token does not contain a partial decryption.", Class: ClassMalformed}
+		}
+
+		var signedShare SignedKeyShare
+		err = json.Unmarshal(plaintext, &signedShare)
+		if err != nil {
+			return nil, nil, nil, ItCryptoError{Des: "Could not deserialize partial decryption", Err: err, Class: ClassMalformed}
+		}
+		claimed, err := signedShare.Extract()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		var share KeyShare
+		err = verifyJson(JWS(signedShare), fetchUser(claimed.Recipient), &share)
+		if err != nil {
+			return nil, nil, nil, ItCryptoError{Des: "Could not verify signature of partial decryption", Err: err, Class: ClassSignature}
+		}
+
+		if share.Token != digest {
+			return nil, nil, nil, ItCryptoError{Des: "Malformed data: Partial decryption does not belong to the token.", Class: ClassMalformed}
+		}
+		value, err := base64.RawURLEncoding.DecodeString(share.Share)
+		if err != nil || share.Index < 1 || share.Index > math.MaxUint8 {
+			return nil, nil, nil, ItCryptoError{Des: "Could not decode key share", Err: err, Class: ClassMalformed}
+		}
+		if slices.Contains(recipients, share.Recipient) || slices.Contains(indices, byte(share.Index)) {
+			return nil, nil, nil, ItCryptoError{Des: "Malformed data: Partial decryptions are specified multiple times!", Class: ClassMalformed}
+		}
+		if len(shares) > 0 && len(value) != len(shares[0]) {
+			return nil, nil, nil, ItCryptoError{Des: "Malformed data: Key shares have different lengths.", Class: ClassMalformed}
+		}
+		recipients = append(recipients, share.Recipient)
+		indices = append(indices, byte(share.Index))
+		shares = append(shares, value)
+	}
+	if len(shares) < required {
+		return nil, nil, nil, ItCryptoError{Des: fmt.Sprintf("Token requires the partial decryptions of %d recipients, but only %d were provided.", required, len(shares)), Class: ClassAuthorization}
+	}
+
+	header, plaintext, err := decryptMulti(object, combineShares(indices, shares))
+	if err != nil {
+		return nil, nil, nil, ItCryptoError{Des: "Failed to decrypt JWE", Err: err, Class: ClassDecryption}
+	}
+	headers := extraHeaders(header)
+	headers["alg"] = header.Algorithm
+	return plaintext, headers, recipients, nil
+}
+
+// verifyQuorum verifies that the quorum in the metadata is equal to the quorum of the SharedLog and that a token,
+// which requires a quorum, was decrypted with the partial decryptions of enough recipients.
+func verifyQuorum(sharedLog SharedLog, metadata map[string]interface{}, quorum []string) error {
+	metaQuorum, err := quorumFromHeader(metadata)
+	if err != nil {
+		return err
+	}
+	if metaQuorum != sharedLog.Quorum {
+		return ItCryptoError{Des: "Malformed data: The specified quorums are not equal!", Class: ClassMalformed}
+	}
+	if len(quorum) < sharedLog.Quorum {
+		return ItCryptoError{Des: fmt.Sprintf("Malformed data: Log requires the partial decryptions of %d recipients.", sharedLog.Quorum), Class: ClassAuthorization}
+	}
+	for _, recipient := range quorum {
+		if !slices.Contains(sharedLog.Recipients, recipient) {
+			return ItCryptoError{Des: "Malformed data: Partial decryption was created by a user who is not a recipient.", Class: ClassAuthorization}
+		}
+	}
+	return nil
+}
+
+// quorumFromHeader extracts the quorum stored in the given JWE header. It returns 0 if the token does not require
+// a quorum.
+func quorumFromHeader(header map[string]interface{}) (int, error) {
+	rawQuorum, ok := header[QuorumHeader]
+	if !ok {
+		return 0, nil
+	}
+	number, ok := rawQuorum.(float64)
+	if !ok || number != math.Trunc(number) || number < 1 || number > math.MaxUint8 {
+		return 0, ItCryptoError{Des: "Could not extract quorum from metadata", Class: ClassMalformed}
+	}
+	return int(number), nil
+}
+
+// splitSecret splits the secret into n shares, such that any k of them can restore it (Shamir's secret sharing
+// over GF(256)). The share at position i belongs to the x-coordinate i+1.
+func splitSecret(secret []byte, n int, k int) ([][]byte, error) {
+	coefficients := make([]byte, len(secret)*(k-1))
+	_, err := rand.Read(coefficients)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not generate random coefficients", Err: err}
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		x := byte(i + 1)
+		shares[i] = make([]byte, len(secret))
+		for j := range secret {
+			// Horner's method: secret + c1·x + ... + c(k-1)·x^(k-1)
+			var y byte
+			for d := k - 2; d >= 0; d-- {
+				y = gfMul(y, x) ^ coefficients[j*(k-1)+d]
+			}
+			shares[i][j] = gfMul(y, x) ^ secret[j]
+		}
+	}
+	return shares, nil
+}
+
+// combineShares restores the secret from the shares at the given x-coordinates by Lagrange interpolation at 0.
+func combineShares(indices []byte, shares [][]byte) []byte {
+	secret := make([]byte, len(shares[0]))
+	for i, xi := range indices {
+		// basis = prod xj / (xj - xi), subtraction is xor in GF(256)
+		basis := byte(1)
+		for j, xj := range indices {
+			if i != j {
+				basis = gfMul(basis, gfMul(xj, gfInverse(xj^xi)))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= gfMul(shares[i][b], basis)
+		}
+	}
+	return secret
+}
+
+// gfMul multiplies two elements of GF(256) with the reduction polynomial x^8 + x^4 + x^3 + x + 1.
+func gfMul(a byte, b byte) byte {
+	var product byte
+	for i := 0; i < 8; i++ {
+		product ^= a & -(b & 1)
+		a = (a << 1) ^ (0x1b & -(a >> 7))
+		b >>= 1
+	}
+	return product
+}
+
+// gfInverse returns the multiplicative inverse a^254 of a non-zero element of GF(256).
+func gfInverse(a byte) byte {
+	result := byte(1)
+	for i := 0; i < 7; i++ {
+		a = gfMul(a, a)
+		result = gfMul(result, a)
+	}
+	return result
+}
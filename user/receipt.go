@@ -0,0 +1,113 @@
+package user
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+)
+
+// receiptType is the value of the "typ" header of JWE tokens which contain a SignedReceipt.
+const receiptType = "receipt"
+
+// CreateReceipt decrypts and verifies the given JWE token like Decrypt and returns a receipt signed by the recipient.
+// The receipt binds the digest of the token, the recipient, the sharer and the current time.
+func CreateReceipt(jwe string, recipient AuthenticatedUser, fetchUser FetchUser, options Options) (SignedReceipt, error) {
+	token, err := decryptToken(jwe, recipient, fetchUser, options)
+	if err != nil {
+		return SignedReceipt{}, err
+	}
+
+	digest, err := TokenDigest(jwe)
+	if err != nil {
+		return SignedReceipt{}, err
+	}
+
+	jws, err := signJson(recipient, Receipt{
+		Token:     digest,
+		Recipient: recipient.Id,
+		Sharer:    token.sharedLog.Creator,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return SignedReceipt{}, ItCryptoError{Des: "Could not sign receipt", Err: err}
+	}
+	return SignedReceipt(jws), nil
+}
+
+// VerifyReceipt verifies that the receipt was signed by the given recipient. If jwe is not empty, it also verifies
+// that the receipt belongs to this JWE token.
+func VerifyReceipt(receipt SignedReceipt, jwe string, recipient RemoteUser) (Receipt, error) {
+	var result Receipt
+	err := verifyJson(JWS(receipt), recipient, &result)
+	if err != nil {
+		return Receipt{}, ItCryptoError{Des: "Could not verify signature of receipt", Err: err, Class: ClassSignature}
+	}
+
+	if result.Recipient != recipient.Id {
+		return Receipt{}, ItCryptoError{Des: "Malformed data: Receipt was signed by another user than its recipient.", Class: ClassAuthorization}
+	}
+
+	if jwe != "" {
+		digest, err := TokenDigest(jwe)
+		if err != nil {
+			return Receipt{}, err
+		}
+		if digest != result.Token {
+			return Receipt{}, ItCryptoError{Des: "Malformed data: Receipt does not belong to the token.", Class: ClassMalformed}
+		}
+	}
+	return result, nil
+}
+
+// EncryptReceipt encrypts a receipt created by the sender for the sharer of the acknowledged token.
+func EncryptReceipt(receipt SignedReceipt, sender AuthenticatedUser, fetchUser FetchUser) (string, error) {
+	result, err := VerifyReceipt(receipt, "", sender.RemoteUser)
+	if err != nil {
+		return "", err
+	}
+
+	sharer := fetchUser(result.Sharer)
+	if sharer.EncryptionCertificate == nil {
+		return "", ItCryptoError{Des: "Could not resolve encryption certificate of sharer", Class: ClassCertificate}
+	}
+
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return "", ItCryptoError{Des: "Could not serialize receipt", Err: err}
+	}
+	return encryptPayload(data, []RemoteUser{sharer}, map[string]interface{}{"typ": receiptType})
+}
+
+// DecryptReceipt decrypts a JWE token created by EncryptReceipt and verifies the contained receipt.
+// Use VerifyReceipt with the shared JWE token to check that the receipt acknowledges this token.
+func DecryptReceipt(jwe string, receiver AuthenticatedUser, fetchUser FetchUser) (SignedReceipt, Receipt, error) {
+	plaintext, metadata, err := decryptPayload(jwe, receiver)
+	if err != nil {
+		return SignedReceipt{}, Receipt{}, err
+	}
+	if metadata["typ"] != receiptType {
+		return SignedReceipt{}, Receipt{}, ItCryptoError{Des: "Malformed data: Token does not contain a receipt.", Class: ClassMalformed}
+	}
+
+	var receipt SignedReceipt
+	err = json.Unmarshal(plaintext, &receipt)
+	if err != nil {
+		return SignedReceipt{}, Receipt{}, ItCryptoError{Des: "Could not deserialize receipt", Err: err, Class: ClassMalformed}
+	}
+
+	claimed, err := receipt.Extract()
+	if err != nil {
+		return SignedReceipt{}, Receipt{}, err
+	}
+	result, err := VerifyReceipt(receipt, "", fetchUser(claimed.Recipient))
+	if err != nil {
+		return SignedReceipt{}, Receipt{}, err
+	}
+
+	if result.Sharer != receiver.Id {
+		return SignedReceipt{}, Receipt{}, ItCryptoError{Des: "Malformed data: Receipt is not intended for the decrypting user.", Class: ClassAuthorization}
+	}
+	return receipt, result, nil
+}
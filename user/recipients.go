@@ -0,0 +1,67 @@
+package user
+
+import (
+	"sort"
+
+	. "github.com/haggj/go-it-crypto/error"
+)
+
+// normalizeReceivers turns the given receivers into a canonical set: Receivers are sorted by their id and
+// duplicates are removed. The function fails if the set is empty, if a receiver has no encryption certificate or if
+// the same id is specified with different keys.
+func normalizeReceivers(receivers []RemoteUser) ([]RemoteUser, error) {
+	if len(receivers) == 0 {
+		return nil, ItCryptoError{Des: "Malformed data: No recipients specified.", Class: ClassMalformed}
+	}
+
+	seen := map[string]RemoteUser{}
+	var normalized []RemoteUser
+	for _, receiver := range receivers {
+		if receiver.EncryptionCertificate == nil {
+			return nil, ItCryptoError{Des: "Malformed data: Recipient " + receiver.Id + " has no encryption certificate.", Class: ClassMalformed}
+		}
+		if previous, ok := seen[receiver.Id]; ok {
+			if !previous.EncryptionCertificate.Equal(receiver.EncryptionCertificate) {
+				return nil, ItCryptoError{Des: "Malformed data: Recipient " + receiver.Id + " is specified multiple times with different keys.", Class: ClassMalformed}
+			}
+			continue
+		}
+		seen[receiver.Id] = receiver
+		normalized = append(normalized, receiver)
+	}
+
+	sort.SliceStable(normalized, func(i, j int) bool {
+		return normalized[i].Id < normalized[j].Id
+	})
+	return normalized, nil
+}
+
+// hasDuplicates returns true if the given set of recipients contains an id multiple times.
+func hasDuplicates(recipients []string) bool {
+	seen := map[string]bool{}
+	for _, recipient := range recipients {
+		if seen[recipient] {
+			return true
+		}
+		seen[recipient] = true
+	}
+	return false
+}
+
+// sameRecipients returns true if both sets of recipients contain the same ids, regardless of their order.
+// Both sets are expected to be free of duplicates.
+func sameRecipients(first []string, second []string) bool {
+	if len(first) != len(second) {
+		return false
+	}
+	ids := map[string]bool{}
+	for _, recipient := range first {
+		ids[recipient] = true
+	}
+	for _, recipient := range second {
+		if !ids[recipient] {
+			return false
+		}
+	}
+	return true
+}
@@ -6,9 +6,11 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 
 	"github.com/google/uuid"
 	. "github.com/haggj/go-it-crypto/error"
+	"gopkg.in/square/go-jose.v2"
 )
 
 // RemoteUser represents a remote User, which has access to the certificates of the user.
@@ -23,49 +25,86 @@ type RemoteUser struct {
 	EncryptionCertificate   *ecdsa.PublicKey
 	VerificationCertificate *ecdsa.PublicKey
 	IsMonitor               bool
+	// Versions are the protocol versions the user supports. If it is nil, the user is assumed to support all
+	// SupportedVersions.
+	Versions []int
 }
 
 // ImportRemoteUser imports a user based on its public certificates. This function also verifies if the provided
 // certificates are singed by the trusted certificate authority.
 func ImportRemoteUser(id string, encryptionCertificate string, VerificationCertificate string, isMonitor bool, trustedCertificate string) (RemoteUser, error) {
 
-	rawTrustedCert, _ := pem.Decode([]byte(trustedCertificate))
-	trustedCert, err := x509.ParseCertificate([]byte(rawTrustedCert.Bytes))
+	trustedCert, err := parseCertificate(trustedCertificate)
+	if err != nil {
+		return RemoteUser{}, ItCryptoError{Des: "Can not parse trusted certificate", Err: err, Class: ClassCertificate}
+	}
 
 	// Parse encryption certificate
-	rawEncCert, _ := pem.Decode([]byte(encryptionCertificate))
-	encCert, err := x509.ParseCertificate([]byte(rawEncCert.Bytes))
+	encCert, err := parseCertificate(encryptionCertificate)
 	if err != nil {
-		return RemoteUser{}, ItCryptoError{Des: "Can not parse encryption certificate", Err: err}
+		return RemoteUser{}, ItCryptoError{Des: "Can not parse encryption certificate", Err: err, Class: ClassCertificate}
+	}
+	encKey, ok := encCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return RemoteUser{}, ItCryptoError{Des: "Encryption certificate does not contain an ECDSA key", Class: ClassCertificate}
 	}
 
 	// Verify encryption certificate
 	err = encCert.CheckSignatureFrom(trustedCert)
 	if err != nil {
-		return RemoteUser{}, ItCryptoError{Des: "Can not verify encryption certificate", Err: err}
+		return RemoteUser{}, ItCryptoError{Des: "Can not verify encryption certificate", Err: err, Class: ClassCertificate}
 	}
 
 	// Parse verification certificate
-	rawVrfCert, _ := pem.Decode([]byte(VerificationCertificate))
-	vrfCert, err := x509.ParseCertificate([]byte(rawVrfCert.Bytes))
+	vrfCert, err := parseCertificate(VerificationCertificate)
 	if err != nil {
-		return RemoteUser{}, ItCryptoError{Des: "Can not parse verification certificate", Err: err}
+		return RemoteUser{}, ItCryptoError{Des: "Can not parse verification certificate", Err: err, Class: ClassCertificate}
+	}
+	vrfKey, ok := vrfCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return RemoteUser{}, ItCryptoError{Des: "Verification certificate does not contain an ECDSA key", Class: ClassCertificate}
 	}
 
 	// Verify verification certificate
-	err = encCert.CheckSignatureFrom(trustedCert)
+	err = vrfCert.CheckSignatureFrom(trustedCert)
 	if err != nil {
-		return RemoteUser{}, ItCryptoError{Des: "Can not verify verification certificate", Err: err}
+		return RemoteUser{}, ItCryptoError{Des: "Can not verify verification certificate", Err: err, Class: ClassCertificate}
 	}
 
 	return RemoteUser{
 		Id:                      id,
-		EncryptionCertificate:   encCert.PublicKey.(*ecdsa.PublicKey),
-		VerificationCertificate: vrfCert.PublicKey.(*ecdsa.PublicKey),
+		EncryptionCertificate:   encKey,
+		VerificationCertificate: vrfKey,
 		IsMonitor:               isMonitor,
 	}, nil
 }
 
+// parseCertificate parses a PEM-encoded x509 certificate.
+func parseCertificate(certificate string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// VerifyData verifies that the given JWS token was signed by this user with SignData and returns the signed data.
+func (user RemoteUser) VerifyData(jws string) ([]byte, error) {
+	if user.VerificationCertificate == nil {
+		return nil, ItCryptoError{Des: "Could not resolve verification certificate of user", Err: nil, Class: ClassCertificate}
+	}
+
+	object, err := jose.ParseSigned(jws)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not parse JWS", Err: err, Class: ClassMalformed}
+	}
+	data, err := object.Verify(user.VerificationCertificate)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not verify signature of data", Err: err, Class: ClassSignature}
+	}
+	return data, nil
+}
+
 // GenerateRemoteUser generates a random RemoteUser. It is used during testing.
 func GenerateRemoteUser() (RemoteUser, error) {
 	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
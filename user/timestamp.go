@@ -0,0 +1,74 @@
+package user
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/tsa"
+)
+
+// TimestampHeader is the unprotected JWS header which holds the base64-encoded RFC 3161 TimeStampToken of a log.
+const TimestampHeader = "timestampToken"
+
+// TimestampLog obtains a trusted timestamp over the original signature of the given log and embeds it into the
+// unprotected header of this signature. The signature of the monitor stays valid.
+func TimestampLog(log SingedLog, timestamper tsa.Timestamper) (SingedLog, error) {
+	digest, err := signatureDigest(log)
+	if err != nil {
+		return SingedLog{}, err
+	}
+
+	token, err := timestamper.Timestamp(digest)
+	if err != nil {
+		return SingedLog{}, ItCryptoError{Des: "Could not obtain timestamp", Err: err}
+	}
+
+	// The timestamp is stored in the unprotected header of the original signature
+	signatures := append([]Signature{}, JWS(log).AllSignatures()...)
+	header := map[string]interface{}{}
+	for key, value := range signatures[0].Header {
+		header[key] = value
+	}
+	header[TimestampHeader] = base64.StdEncoding.EncodeToString(token)
+	signatures[0].Header = header
+	return SingedLog(JWS(log).WithSignatures(signatures)), nil
+}
+
+// VerifyTimestamp verifies the timestamp embedded in the given log against the certificate of the trusted
+// time-stamping authority. It returns the time the authority certified the signature of the log at.
+// *NOTE*: This function does not verify the signature of the log itself.
+func VerifyTimestamp(log SingedLog, authority *x509.Certificate) (time.Time, error) {
+	encoded, ok := JWS(log).AllSignatures()[0].Header[TimestampHeader].(string)
+	if !ok {
+		return time.Time{}, ItCryptoError{Des: "Log does not contain a timestamp", Class: ClassSignature}
+	}
+	token, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, ItCryptoError{Des: "Could not base64 decode timestamp", Err: err, Class: ClassMalformed}
+	}
+
+	digest, err := signatureDigest(log)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	info, err := tsa.Verify(token, digest, authority)
+	if err != nil {
+		return time.Time{}, ItCryptoError{Des: "Could not verify timestamp", Err: err, Class: ClassSignature}
+	}
+	return info.Time, nil
+}
+
+// signatureDigest returns the SHA-256 digest of the original signature of the given log.
+func signatureDigest(log SingedLog) ([]byte, error) {
+	signature, err := base64.RawURLEncoding.DecodeString(JWS(log).AllSignatures()[0].Signature)
+	if err != nil {
+		return nil, ItCryptoError{Des: "Could not base64 decode signature", Err: err, Class: ClassMalformed}
+	}
+	digest := sha256.Sum256(signature)
+	return digest[:], nil
+}
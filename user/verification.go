@@ -0,0 +1,168 @@
+package user
+
+import (
+	"time"
+
+	. "github.com/haggj/go-it-crypto/logs"
+	"golang.org/x/exp/slices"
+)
+
+// Check is a verification step which was performed during decryption.
+type Check string
+
+const (
+	// CheckJweDecryption: the token was decrypted with the key of the receiver and its integrity was verified.
+	CheckJweDecryption Check = "jwe-decryption"
+	// CheckVersion: the token uses a supported protocol version.
+	CheckVersion Check = "protocol-version"
+	// CheckCreatorSignature: the SharedLog is signed by its creator.
+	CheckCreatorSignature Check = "creator-signature"
+	// CheckDelegationChain: the SharedLogs the log was forwarded from are valid.
+	CheckDelegationChain Check = "delegation-chain"
+	// CheckMonitorSignatures: the AccessLog is signed by its monitor and the required number of further monitors.
+	CheckMonitorSignatures Check = "monitor-signatures"
+	// CheckTimestamp: the AccessLog contains a valid timestamp of the trusted time-stamping authority.
+	CheckTimestamp Check = "timestamp"
+	// CheckDisclosures: the disclosed fields belong to the AccessLog.
+	CheckDisclosures Check = "disclosures"
+	// CheckRecipients: the recipients in the JWE header match the recipients of the SharedLog.
+	CheckRecipients Check = "recipients"
+	// CheckOwner: the owner in the JWE header matches the owner of the AccessLog.
+	CheckOwner Check = "owner"
+	// CheckPolicy: the SharingPolicy allows the sharing operation.
+	CheckPolicy Check = "policy"
+	// CheckQuorum: the partial decryptions of the required number of recipients were combined to decrypt the token.
+	CheckQuorum Check = "quorum"
+	// CheckReEncryptionGrant: a recipient authorized the receiver to decrypt the token re-encrypted by a proxy.
+	CheckReEncryptionGrant Check = "re-encryption-grant"
+)
+
+// Signer is a user who signed a verified object, together with the algorithm of the signature.
+type Signer struct {
+	User      RemoteUser
+	Algorithm string
+}
+
+// VerifiedLog is the result of a successful decryption. Besides the AccessLog it contains the provenance of the
+// log, such that applications can display who signed and who shared it and which checks were performed.
+type VerifiedLog struct {
+	// AccessLog is the verified log. If the log was signed in selective disclosure mode, only disclosed fields are set.
+	AccessLog AccessLog
+	// Log is the signed log as it was embedded in the token.
+	Log SingedLog
+	// SharedLog is the verified SharedLog, which lists the creator and the recipients of the token.
+	SharedLog SharedLog
+	// Chain contains the SharedLogs the log was forwarded from, starting with the SharedLog of the original sharer.
+	Chain []SharedLog
+
+	// Creator is the user who shared the log.
+	Creator Signer
+	// Monitor is the monitor specified in the AccessLog.
+	Monitor Signer
+	// Monitors are all monitors who signed the log, in the order of their signatures.
+	Monitors []Signer
+	// Timestamp is the time of the trusted timestamp. It is zero if no TimestampAuthority was configured.
+	Timestamp time.Time
+
+	// Version is the protocol version of the token.
+	Version int
+	// KeyAlgorithm is the algorithm which was used to encrypt the content encryption key for the receiver.
+	KeyAlgorithm string
+	// ContentEncryption is the algorithm which was used to encrypt the content of the token.
+	ContentEncryption string
+	// Headers contains the non-standard JWE headers of the token, e.g. owner and recipients.
+	Headers map[string]interface{}
+	// Delegator is the recipient who authorized the receiver with a ReEncryptionKey if the token was re-encrypted
+	// by a proxy. It is empty otherwise.
+	Delegator string
+	// Quorum lists the recipients whose partial decryptions were combined to decrypt the token. It is empty if
+	// the token did not require a quorum.
+	Quorum []string
+
+	// Checks lists the verification steps which passed, in the order they were performed.
+	Checks []Check
+}
+
+// VerifiedAccessLog is the result of the verification of a SingedLog.
+type VerifiedAccessLog struct {
+	// AccessLog is the verified log. If the log was signed in selective disclosure mode, only the monitor and the
+	// owner are set.
+	AccessLog AccessLog
+	// Monitor is the monitor specified in the AccessLog.
+	Monitor Signer
+	// Monitors are all monitors who signed the log, in the order of their signatures.
+	Monitors []Signer
+	// Timestamp is the time of the trusted timestamp. It is zero if no TimestampAuthority was configured.
+	Timestamp time.Time
+}
+
+// VerifyLog verifies a SingedLog which was received without encryption. It checks that the log is signed by the
+// monitor it specifies, that all signers are authorized monitors and returns the AccessLog with its signers.
+// The keys of the monitors are resolved with fetchUser.
+func VerifyLog(log SingedLog, fetchUser FetchUser) (VerifiedAccessLog, error) {
+	return VerifyLogWithOptions(log, fetchUser, Options{})
+}
+
+// VerifyLogWithOptions works like VerifyLog but additionally applies the Threshold, Monitors and
+// TimestampAuthority of the options.
+func VerifyLogWithOptions(log SingedLog, fetchUser FetchUser, options Options) (VerifiedAccessLog, error) {
+	verified, err := verifyEmbeddedLogDetails(SharedLog{Log: log}, fetchUser, options)
+	if err != nil {
+		return VerifiedAccessLog{}, err
+	}
+	return VerifiedAccessLog{
+		AccessLog: verified.accessLog,
+		Monitor:   verified.monitor,
+		Monitors:  verified.signers,
+		Timestamp: verified.timestamp,
+	}, nil
+}
+
+// DecryptVerified decrypts the given JWE token like Decrypt and returns the verified log together with its
+// provenance.
+func DecryptVerified(jwe string, receiver AuthenticatedUser, fetchUser FetchUser, options Options) (VerifiedLog, error) {
+	token, err := decryptToken(jwe, receiver, fetchUser, options)
+	if err != nil {
+		return VerifiedLog{}, err
+	}
+	return token.verified(), nil
+}
+
+// verified returns the VerifiedLog of the decrypted token.
+func (token decryptedToken) verified() VerifiedLog {
+	headers := protocolHeaders(token.headers)
+	keyAlgorithm, _ := token.headers["alg"].(string)
+	contentEncryption, _ := token.headers["enc"].(string)
+
+	return VerifiedLog{
+		AccessLog:         token.accessLog,
+		Log:               token.sharedLog.Log,
+		SharedLog:         token.sharedLog,
+		Chain:             token.chain,
+		Creator:           token.creator,
+		Monitor:           token.log.monitor,
+		Monitors:          token.log.signers,
+		Timestamp:         token.log.timestamp,
+		Version:           token.version,
+		KeyAlgorithm:      keyAlgorithm,
+		ContentEncryption: contentEncryption,
+		Headers:           headers,
+		Delegator:         token.delegator,
+		Quorum:            token.quorum,
+		Checks:            token.checks,
+	}
+}
+
+// Passed returns true if the given check was performed and passed.
+func (log VerifiedLog) Passed(check Check) bool {
+	return slices.Contains(log.Checks, check)
+}
+
+// signatureAlgorithm returns the algorithm of the first signature of the JWS token.
+func signatureAlgorithm(jws JWS) string {
+	object, err := jws.ToJsonWebSignature()
+	if err != nil || len(object.Signatures) == 0 {
+		return ""
+	}
+	return object.Signatures[0].Protected.Algorithm
+}
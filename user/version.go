@@ -0,0 +1,85 @@
+package user
+
+import (
+	"fmt"
+	"math"
+
+	. "github.com/haggj/go-it-crypto/error"
+	. "github.com/haggj/go-it-crypto/logs"
+	"golang.org/x/exp/slices"
+)
+
+// VersionHeader is the JWE header which stores the protocol version of a token.
+const VersionHeader = "itv"
+
+const (
+	// Version1 is the original protocol. Its tokens do not contain a VersionHeader and only contain a SharedLog
+	// with a single signed AccessLog, which is shared with recipients listed in the JWE header.
+	Version1 = 1
+	// Version2 adds hidden recipients, forwarded logs, selective disclosure and logs signed by multiple monitors.
+	Version2 = 2
+	// Version3 adds logs with an unencoded payload ("b64": false, RFC 7797).
+	Version3 = 3
+	// Version4 adds tokens in proxy re-encryption mode, whose content encryption key is stored in a capsule.
+	Version4 = 4
+	// Version5 adds tokens which can only be decrypted by a quorum of recipients.
+	Version5 = 5
+
+	// ProtocolVersion is the latest version of the protocol supported by this library.
+	ProtocolVersion = Version5
+)
+
+// SupportedVersions lists all protocol versions this library can read and write.
+var SupportedVersions = []int{Version1, Version2, Version3, Version4, Version5}
+
+// verifySupportedVersion verifies that all receivers support the given protocol version.
+// Receivers which do not publish their versions are assumed to support all SupportedVersions.
+func verifySupportedVersion(receivers []RemoteUser, version int) error {
+	for _, receiver := range receivers {
+		if receiver.Versions != nil && !slices.Contains(receiver.Versions, version) {
+			return ItCryptoError{Des: fmt.Sprintf("Receivers do not support protocol version %d which is required to share this log.", version), Class: ClassVersion}
+		}
+	}
+	return nil
+}
+
+// requiredVersion returns the minimal protocol version which can represent the given SharedLog.
+func requiredVersion(sharedLog SharedLog, hiddenRecipients bool) int {
+	if sharedLog.Quorum > 0 {
+		return Version5
+	}
+	if JWS(sharedLog.Log).Unencoded() {
+		return Version3
+	}
+	if hiddenRecipients || sharedLog.Parent != nil || len(sharedLog.Disclosures) > 0 || len(JWS(sharedLog.Log).Signatures) > 0 {
+		return Version2
+	}
+	return Version1
+}
+
+// versionFromHeader extracts the protocol version stored in the given JWE header.
+// Tokens without a VersionHeader were created with Version1.
+func versionFromHeader(header map[string]interface{}) (int, error) {
+	rawVersion, ok := header[VersionHeader]
+	if !ok {
+		return Version1, nil
+	}
+	number, ok := rawVersion.(float64)
+	if !ok || number != math.Trunc(number) || number < 1 || number > math.MaxInt32 {
+		return 0, ItCryptoError{Des: "Could not extract protocol version from metadata", Class: ClassMalformed}
+	}
+	version := int(number)
+	if !slices.Contains(SupportedVersions, version) {
+		return 0, ItCryptoError{Des: fmt.Sprintf("Unsupported protocol version %d. Supported versions are %v.", version, SupportedVersions), Class: ClassVersion}
+	}
+	return version, nil
+}
+
+// verifyVersion verifies that the SharedLog of a token only uses features of the protocol version of the token.
+func verifyVersion(version int, sharedLog SharedLog, hiddenRecipients bool) error {
+	required := requiredVersion(sharedLog, hiddenRecipients)
+	if required > version {
+		return ItCryptoError{Des: fmt.Sprintf("Malformed data: Token of protocol version %d uses features of version %d.", version, required), Class: ClassVersion}
+	}
+	return nil
+}
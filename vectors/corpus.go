@@ -0,0 +1,103 @@
+// Package vectors contains the conformance test vectors of the it-crypto protocol.
+// The vectors are stored in a versioned JSON corpus which is shared with the other implementations of the protocol.
+// Each vector contains a JWE token, the user which decrypts it and the expected outcome of the decryption.
+package vectors
+
+import (
+	_ "embed"
+	"encoding/json"
+	"io"
+	"os"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+)
+
+// Version is the version of the corpus format.
+const Version = 1
+
+//go:embed v1.json
+var defaultCorpus []byte
+
+// Corpus is a set of test vectors together with the keys of all users referenced by the vectors.
+type Corpus struct {
+	Version int               `json:"version"`
+	Keysets map[string]Keyset `json:"keysets"`
+	Vectors []Vector          `json:"vectors"`
+}
+
+// Keyset contains the certificates and keys of a group of users and the CA which signed their certificates.
+type Keyset struct {
+	TrustedCertificate string `json:"trustedCertificate"`
+	Users              []User `json:"users"`
+}
+
+// User contains the PEM-encoded certificates and keys of a user.
+type User struct {
+	Id                      string `json:"id"`
+	EncryptionCertificate   string `json:"encryptionCertificate"`
+	VerificationCertificate string `json:"verificationCertificate"`
+	DecryptionKey           string `json:"decryptionKey"`
+	SigningKey              string `json:"signingKey"`
+	IsMonitor               bool   `json:"isMonitor"`
+}
+
+// Vector is a single test vector. The Receiver decrypts the Token with the Options and expects the outcome
+// specified in Expected.
+type Vector struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Source      string      `json:"source"`
+	Keyset      string      `json:"keyset"`
+	Receiver    string      `json:"receiver"`
+	Token       string      `json:"token"`
+	Options     Options     `json:"options"`
+	Expected    Expectation `json:"expected"`
+}
+
+// Options configures the decryption of a vector.
+type Options struct {
+	Threshold int      `json:"threshold,omitempty"`
+	Monitors  []string `json:"monitors,omitempty"`
+}
+
+// Expectation is the expected outcome of a vector. Valid tokens yield the Log, invalid tokens an error of the
+// ErrorClass.
+type Expectation struct {
+	Valid      bool            `json:"valid"`
+	Log        *logs.AccessLog `json:"log,omitempty"`
+	ErrorClass Class           `json:"errorClass,omitempty"`
+}
+
+// Default returns the corpus which is shipped with this module.
+func Default() (Corpus, error) {
+	return parse(defaultCorpus)
+}
+
+// Load reads the corpus stored at the given path.
+func Load(path string) (Corpus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Corpus{}, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (Corpus, error) {
+	var corpus Corpus
+	err := json.Unmarshal(data, &corpus)
+	if err != nil {
+		return Corpus{}, ItCryptoError{Des: "Could not deserialize corpus", Err: err, Class: ClassMalformed}
+	}
+	if corpus.Version != Version {
+		return Corpus{}, ItCryptoError{Des: "Unsupported corpus version", Class: ClassMalformed}
+	}
+	return corpus, nil
+}
+
+// Write writes the corpus as indented JSON.
+func (corpus Corpus) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(corpus)
+}
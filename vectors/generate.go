@@ -0,0 +1,368 @@
+package vectors
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/logs"
+	"github.com/haggj/go-it-crypto/user"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// GeneratedKeyset is the name of the keyset which is created by Generate.
+const GeneratedKeyset = "go-it-crypto"
+
+// Source identifies the vectors created by this implementation.
+const Source = "go"
+
+// generator holds the users of a generated keyset.
+type generator struct {
+	keyset  Keyset
+	users   map[string]user.AuthenticatedUser
+	vectors []Vector
+}
+
+// Generate creates a new keyset and the vectors of this implementation.
+// Existing vectors of other implementations can be kept with Merge.
+func Generate() (Keyset, []Vector, error) {
+	g, err := newGenerator("monitor", "witness", "owner", "friend", "mallory")
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	monitor, witness, owner, friend, mallory := g.users["monitor"], g.users["witness"], g.users["owner"], g.users["friend"], g.users["mallory"]
+
+	accessLog := logs.AccessLog{
+		Monitor:       monitor.Id,
+		Owner:         owner.Id,
+		Tool:          "conformance",
+		Justification: "go-it-crypto",
+		Timestamp:     1672531200,
+		AccessKind:    "Aggregate",
+		DataType:      []string{"Email", "Address"},
+	}
+	signedLog, err := monitor.SignLog(accessLog)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	fetchUser := g.fetchUser()
+
+	// Valid tokens
+	token, err := monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.valid("monitor-to-owner", "The monitor shares a log with its owner.", owner, token, Options{}, accessLog)
+
+	token, err = owner.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser, friend.RemoteUser}, fetchUser)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.valid("owner-to-recipients", "The owner shares a log with multiple recipients.", friend, token, Options{}, accessLog)
+
+	token, err = owner.EncryptLogWithOptions(signedLog, []user.RemoteUser{friend.RemoteUser}, fetchUser, user.Options{HideRecipients: true})
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.valid("hidden-recipients", "The owner shares a log without listing the recipients in the JWE header.", friend, token, Options{}, accessLog)
+
+	countersignedLog, err := witness.CountersignLog(signedLog, fetchUser)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	thresholdOptions := Options{Threshold: 2, Monitors: []string{monitor.Id, witness.Id}}
+	token, err = monitor.EncryptLogWithOptions(countersignedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{Threshold: 2})
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.valid("countersigned-log", "A log signed by two monitors satisfies a threshold of two.", owner, token, thresholdOptions, accessLog)
+
+	unencodedLog, err := monitor.SignLogWithOptions(accessLog, user.Options{UnencodedPayload: true})
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	token, err = monitor.EncryptLogWithOptions(unencodedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser, user.Options{CanonicalJson: true})
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.valid("unencoded-canonical-log", "The log is signed over its canonical JSON form with an unencoded payload.", owner, token, Options{}, accessLog)
+
+	// Invalid tokens
+	token, err = monitor.EncryptLog(signedLog, []user.RemoteUser{owner.RemoteUser}, fetchUser)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("threshold-not-reached", "A log signed by a single monitor does not satisfy a threshold of two.", owner, token, thresholdOptions, ClassSignature)
+	g.invalid("not-encrypted-for-receiver", "The token is not encrypted for the decrypting user.", friend, token, Options{}, ClassDecryption)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": friend.Id, "recipients": []string{owner.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("wrong-owner", "The owner in the JWE header differs from the owner of the log.", owner, token, Options{}, ClassMalformed)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id, friend.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("recipient-mismatch", "The recipients in the JWE header differ from the recipients of the SharedLog.", owner, token, Options{}, ClassMalformed)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id, owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id, owner.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("duplicate-recipients", "The recipients are specified multiple times.", owner, token, Options{}, ClassMalformed)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{friend.Id}, Creator: owner.Id}, owner, []user.RemoteUser{mallory.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{friend.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("receiver-not-recipient", "The token is encrypted for a user who is not listed as recipient.", mallory, token, Options{}, ClassAuthorization)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{friend.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{friend.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{friend.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("monitor-shares-with-non-owner", "The monitor shares a log with a user who is not its owner.", friend, token, Options{}, ClassAuthorization)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{mallory.Id}, Creator: friend.Id}, friend, []user.RemoteUser{mallory.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{mallory.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("non-owner-shares", "A user who is neither owner nor monitor of the log shares it.", mallory, token, Options{}, ClassAuthorization)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id}}, true)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("tampered-shared-log-signature", "The signature of the SharedLog was modified.", owner, token, Options{}, ClassSignature)
+
+	token, err = seal(logs.SharedLog{Log: logs.SingedLog(tamper(logs.JWS(signedLog))), Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("tampered-log-signature", "The signature of the AccessLog was modified.", owner, token, Options{}, ClassSignature)
+
+	unauthorizedLog := accessLog
+	unauthorizedLog.Monitor = mallory.Id
+	signedUnauthorizedLog, err := mallory.SignLog(unauthorizedLog)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	token, err = seal(logs.SharedLog{Log: signedUnauthorizedLog, Recipients: []string{owner.Id}, Creator: mallory.Id}, mallory, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("unauthorized-monitor", "The log is signed by a user who is not a monitor.", owner, token, Options{}, ClassAuthorization)
+
+	forgedLog, err := mallory.SignLog(accessLog)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	token, err = seal(logs.SharedLog{Log: forgedLog, Recipients: []string{owner.Id}, Creator: mallory.Id}, mallory, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id}}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("forged-monitor-signature", "The log claims a monitor but is signed by another user.", owner, token, Options{}, ClassSignature)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "recipients": []string{owner.Id}, user.VersionHeader: 99}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("unsupported-version", "The token uses a protocol version which is not supported.", owner, token, Options{}, ClassVersion)
+
+	token, err = seal(logs.SharedLog{Log: signedLog, Recipients: []string{owner.Id}, Creator: monitor.Id}, monitor, []user.RemoteUser{owner.RemoteUser},
+		map[string]interface{}{"owner": owner.Id, "hiddenRecipients": true}, false)
+	if err != nil {
+		return Keyset{}, nil, err
+	}
+	g.invalid("version-1-hidden-recipients", "A token without version header hides its recipients, which requires version 2.", owner, token, Options{}, ClassVersion)
+
+	return g.keyset, g.vectors, nil
+}
+
+// Merge replaces the generated keyset and its vectors in the corpus. Vectors of other keysets are kept.
+func (corpus Corpus) Merge(keyset Keyset, vectors []Vector) Corpus {
+	merged := Corpus{Version: Version, Keysets: map[string]Keyset{GeneratedKeyset: keyset}}
+	for name, other := range corpus.Keysets {
+		if name != GeneratedKeyset {
+			merged.Keysets[name] = other
+		}
+	}
+	for _, vector := range corpus.Vectors {
+		if vector.Keyset != GeneratedKeyset {
+			merged.Vectors = append(merged.Vectors, vector)
+		}
+	}
+	merged.Vectors = append(merged.Vectors, vectors...)
+	return merged
+}
+
+func (g *generator) valid(name string, description string, receiver user.AuthenticatedUser, token string, options Options, accessLog logs.AccessLog) {
+	g.vectors = append(g.vectors, Vector{
+		Name: name, Description: description, Source: Source, Keyset: GeneratedKeyset,
+		Receiver: receiver.Id, Token: token, Options: options,
+		Expected: Expectation{Valid: true, Log: &accessLog},
+	})
+}
+
+func (g *generator) invalid(name string, description string, receiver user.AuthenticatedUser, token string, options Options, class Class) {
+	g.vectors = append(g.vectors, Vector{
+		Name: name, Description: description, Source: Source, Keyset: GeneratedKeyset,
+		Receiver: receiver.Id, Token: token, Options: options,
+		Expected: Expectation{Valid: false, ErrorClass: class},
+	})
+}
+
+func (g *generator) fetchUser() user.FetchUser {
+	return func(id string) user.RemoteUser {
+		return g.users[id].RemoteUser
+	}
+}
+
+// newGenerator creates a CA and users with the given ids. The users "monitor" and "witness" are monitors.
+func newGenerator(ids ...string) (*generator, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := certificateTemplate("it-crypto conformance CA")
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDer)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &generator{
+		keyset: Keyset{TrustedCertificate: encodePem("CERTIFICATE", caDer)},
+		users:  map[string]user.AuthenticatedUser{},
+	}
+	for _, id := range ids {
+		u := User{Id: id, IsMonitor: id == "monitor" || id == "witness"}
+		u.EncryptionCertificate, u.DecryptionKey, err = issue(id, ca, caKey)
+		if err != nil {
+			return nil, err
+		}
+		u.VerificationCertificate, u.SigningKey, err = issue(id, ca, caKey)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedUser, err := user.ImportAuthenticatedUser(u.Id, u.EncryptionCertificate, u.VerificationCertificate, u.DecryptionKey, u.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		authenticatedUser.IsMonitor = u.IsMonitor
+		g.keyset.Users = append(g.keyset.Users, u)
+		g.users[id] = authenticatedUser
+	}
+	return g, nil
+}
+
+// issue creates a key pair and a certificate for the public key signed by the CA. It returns the PEM-encoded
+// certificate and private key.
+func issue(id string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (string, string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, certificateTemplate(id), ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+	rawKey, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return encodePem("CERTIFICATE", der), encodePem("PRIVATE KEY", rawKey), nil
+}
+
+func certificateTemplate(commonName string) *x509.Certificate {
+	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	return &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2123, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func encodePem(blockType string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+// seal signs the SharedLog in the name of the creator and encrypts it with the given headers. In contrast to
+// user.Encrypt it does not perform any checks, such that it can create invalid tokens.
+// If tamperSignature is set, the signature of the SharedLog is modified.
+func seal(sharedLog logs.SharedLog, creator user.AuthenticatedUser, receivers []user.RemoteUser, headers map[string]interface{}, tamperSignature bool) (string, error) {
+	data, err := json.Marshal(sharedLog)
+	if err != nil {
+		return "", err
+	}
+	signed, err := creator.SignData(data)
+	if err != nil {
+		return "", err
+	}
+	if tamperSignature {
+		jws, err := logs.JwsFromBytes([]byte(signed))
+		if err != nil {
+			return "", err
+		}
+		data, err = json.Marshal(tamper(jws))
+		if err != nil {
+			return "", err
+		}
+		signed = string(data)
+	}
+
+	var recipients []jose.Recipient
+	for _, receiver := range receivers {
+		recipients = append(recipients, jose.Recipient{Algorithm: jose.ECDH_ES_A256KW, Key: receiver.EncryptionCertificate})
+	}
+	var options jose.EncrypterOptions
+	for key, value := range headers {
+		options.WithHeader(jose.HeaderKey(key), value)
+	}
+	encrypter, err := jose.NewMultiEncrypter(jose.A256GCM, recipients, &options)
+	if err != nil {
+		return "", err
+	}
+	jwe, err := encrypter.Encrypt([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return jwe.FullSerialize(), nil
+}
+
+// tamper flips a bit in the first signature of the JWS token.
+func tamper(jws logs.JWS) logs.JWS {
+	signatures := append([]logs.Signature{}, jws.AllSignatures()...)
+	signature, _ := base64.RawURLEncoding.DecodeString(signatures[0].Signature)
+	signature[len(signature)-1] ^= 1
+	signatures[0].Signature = base64.RawURLEncoding.EncodeToString(signature)
+	return jws.WithSignatures(signatures)
+}
@@ -0,0 +1,86 @@
+package vectors
+
+import (
+	"encoding/json"
+	"fmt"
+
+	. "github.com/haggj/go-it-crypto/error"
+	"github.com/haggj/go-it-crypto/user"
+)
+
+// Run decrypts the token of the vector and checks the outcome against the expectation of the vector.
+// It returns nil if the outcome matches.
+func (corpus Corpus) Run(vector Vector) error {
+	keyset, ok := corpus.Keysets[vector.Keyset]
+	if !ok {
+		return fmt.Errorf("unknown keyset %q", vector.Keyset)
+	}
+	receiver, fetchUser, err := keyset.importUsers(vector.Receiver)
+	if err != nil {
+		return err
+	}
+
+	options := user.Options{Threshold: vector.Options.Threshold, Monitors: vector.Options.Monitors}
+	signedLog, err := receiver.DecryptLogWithOptions(vector.Token, fetchUser, options)
+
+	if !vector.Expected.Valid {
+		if err == nil {
+			return fmt.Errorf("expected an error of class %q, but decryption succeeded", vector.Expected.ErrorClass)
+		}
+		if ClassOf(err) != vector.Expected.ErrorClass {
+			return fmt.Errorf("expected an error of class %q, got class %q: %s", vector.Expected.ErrorClass, ClassOf(err), err)
+		}
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("expected a valid token, got error of class %q: %s", ClassOf(err), err)
+	}
+	if vector.Expected.Log == nil {
+		return nil
+	}
+	accessLog, err := signedLog.Extract()
+	if err != nil {
+		return fmt.Errorf("could not extract log: %s", err)
+	}
+	got, _ := json.Marshal(accessLog)
+	want, _ := json.Marshal(vector.Expected.Log)
+	if string(got) != string(want) {
+		return fmt.Errorf("expected log %s, got %s", want, got)
+	}
+	return nil
+}
+
+// importUsers imports the users of the keyset. It returns the user with the given id as receiver and a
+// FetchUser function which resolves all users of the keyset.
+func (keyset Keyset) importUsers(receiverId string) (user.AuthenticatedUser, user.FetchUser, error) {
+	var receiver *user.AuthenticatedUser
+	users := map[string]user.RemoteUser{}
+	for _, u := range keyset.Users {
+		remoteUser, err := user.ImportRemoteUser(u.Id, u.EncryptionCertificate, u.VerificationCertificate, u.IsMonitor, keyset.TrustedCertificate)
+		if err != nil {
+			return user.AuthenticatedUser{}, nil, fmt.Errorf("could not import user %q: %s", u.Id, err)
+		}
+		users[u.Id] = remoteUser
+
+		if u.Id == receiverId {
+			authenticatedUser, err := user.ImportAuthenticatedUser(u.Id, u.EncryptionCertificate, u.VerificationCertificate, u.DecryptionKey, u.SigningKey)
+			if err != nil {
+				return user.AuthenticatedUser{}, nil, fmt.Errorf("could not import receiver %q: %s", u.Id, err)
+			}
+			authenticatedUser.IsMonitor = u.IsMonitor
+			receiver = &authenticatedUser
+		}
+	}
+	if receiver == nil {
+		return user.AuthenticatedUser{}, nil, fmt.Errorf("unknown receiver %q", receiverId)
+	}
+
+	fetchUser := func(id string) user.RemoteUser {
+		if remoteUser, ok := users[id]; ok {
+			return remoteUser
+		}
+		return user.RemoteUser{Id: id}
+	}
+	return *receiver, fetchUser, nil
+}